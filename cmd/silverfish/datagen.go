@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"runtime"
+	"silverfish/engine"
+	"sync"
+	"time"
+)
+
+// runDatagenCommand handles `silverfish datagen ...`: self-play games at a
+// fixed node count across several goroutines, written as packed positions
+// (see engine/packed.go) to one file. Returns the process exit code.
+//
+// An interrupt stops handing out new games; the games in progress are
+// finished and written before exiting.
+func runDatagenCommand(args []string) int {
+	cfg := engine.DefaultDatagenConfig
+	fs := flag.NewFlagSet("datagen", flag.ContinueOnError)
+	out := fs.String("out", "", "append packed positions to this file")
+	games := fs.Int("games", 1000, "games to play")
+	threads := fs.Int("threads", runtime.NumCPU(), "games played in parallel")
+	seed := fs.Int64("seed", 0, "seed for the random openings (default: from the clock)")
+	evalFile := fs.String("evalfile", "", "network to play with (default: the embedded net)")
+	fs.IntVar(&cfg.Nodes, "nodes", cfg.Nodes, "search nodes per move")
+	fs.IntVar(&cfg.Hash, "hash", cfg.Hash, "transposition table size in MB, per thread")
+	fs.IntVar(&cfg.RandomPlies, "random-plies", cfg.RandomPlies, "random moves opening each game")
+	fs.IntVar(&cfg.MaxPlies, "max-plies", cfg.MaxPlies, "adjudicate games this long as draws")
+	winScore := fs.Int("win-score", int(cfg.WinScore), "adjudicate a win once the score stays beyond this")
+	drawScore := fs.Int("draw-score", int(cfg.DrawScore), "adjudicate a draw once the score stays within this")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: silverfish datagen -out <file> [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *out == "" || fs.NArg() != 0 || *games < 1 || *threads < 1 || cfg.Nodes < 1 || cfg.Hash < 1 {
+		fs.Usage()
+		return 2
+	}
+	cfg.WinScore, cfg.DrawScore = int32(*winScore), int32(*drawScore)
+
+	engine.Init()
+	if *evalFile != "" {
+		if err := engine.LoadDefaultNetwork(*evalFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", *evalFile, err)
+			return 1
+		}
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	engine.Rng.Seed(*seed)
+
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	w := bufio.NewWriter(f)
+	fmt.Printf("datagen: %d games, %d threads, %d nodes per move, seed %d, network %s\n",
+		*games, *threads, cfg.Nodes, *seed, engine.DefaultNetwork().Describe())
+
+	// every game is played from its own seed, drawn from Rng up front, so
+	// which games a run plays doesn't depend on scheduling -- only the
+	// order they're written in does
+	seeds := make(chan int64, *games)
+	for i := 0; i < *games; i++ {
+		seeds <- engine.Rng.Int63()
+	}
+	close(seeds)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	results := make(chan engine.SelfPlayGame)
+	var wg sync.WaitGroup
+	for i := 0; i < *threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			player := engine.NewSelfPlayer(cfg)
+			for seed := range seeds {
+				if ctx.Err() != nil {
+					return
+				}
+				results <- player.PlayGame(rand.New(rand.NewSource(seed)))
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	start := time.Now()
+	var played, positions int
+	var outcomes [4]int
+	report := func() {
+		elapsed := time.Since(start).Seconds()
+		fmt.Printf("%d games (+%d =%d -%d), %d positions, %.1f positions/s\n",
+			played, outcomes[engine.WhiteWins], outcomes[engine.Drawn], outcomes[engine.BlackWins],
+			positions, float64(positions)/elapsed)
+	}
+	for game := range results {
+		if err == nil {
+			err = engine.WritePackedPositions(w, game.Positions)
+		}
+		played++
+		positions += len(game.Positions)
+		outcomes[game.Result.Outcome]++
+		if played%100 == 0 {
+			report()
+		}
+	}
+	report()
+
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", *out, err)
+		return 1
+	}
+	return 0
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -13,6 +14,7 @@ import (
 )
 
 var shouldProfile *bool = flag.Bool("profile", false, "Enable profiling. Outputs results to cpu.prof")
+var spsaFormat *string = flag.String("spsa", "", "Print an SPSA config for the tunable search parameters (openbench or weather) and exit")
 
 func HandleMessages(channel chan engine.UciClientMessage) {
 	stdinScanner := bufio.NewScanner(os.Stdin)
@@ -52,15 +54,24 @@ func executeGoCommand(channel chan bool, position *engine.Position, command *eng
 	case command.Movetime != 0:
 		moveTime = time.Duration(command.Movetime) * time.Millisecond
 
+	case command.Nodes != 0:
+		// keep defaults: NodeLimit (below) ends the search
+
 	case command.Depth != 0:
 		depth = int(command.Depth)
 
+	case command.Mate != 0:
+		// keep defaults: mate mode runs until it proves the mate (see
+		// Search.MateLimit), like an infinite search that ends itself
+
 	default:
 		moveTime = engine.TimeLimit(position, command) * time.Millisecond
 	}
 	search := engine.Search{
 		MaxDepth:  depth,
 		TimeLimit: moveTime,
+		MateLimit: int(command.Mate),
+		NodeLimit: command.Nodes,
 	}
 	search.Init(position)
 
@@ -81,6 +92,18 @@ func executeGoCommand(channel chan bool, position *engine.Position, command *eng
 func main() {
 	flag.Parse()
 
+	if *spsaFormat != "" {
+		printSPSAConfig(*spsaFormat)
+		return
+	}
+
+	switch flag.Arg(0) {
+	case "net":
+		os.Exit(runNetCommand(flag.Args()[1:]))
+	case "datagen":
+		os.Exit(runDatagenCommand(flag.Args()[1:]))
+	}
+
 	if *shouldProfile {
 		engine.UciLog("Started profiling")
 		profFile, err := os.Create("cpu.prof")
@@ -133,6 +156,7 @@ mainloop:
 				engine.UciSetAuthor("李能和赵梁越")
 				engine.UciOptions()
 				engine.UciOk()
+				engine.UciLog("NNUE " + engine.DefaultNetwork().Describe())
 			case engine.UciIsReadyClientMessage:
 				engine.UciReadyOk()
 			case engine.UciPositionClientMessage:
@@ -146,6 +170,27 @@ mainloop:
 				go executeGoCommand(actionAlertChannel, &position, message.GoMessage)
 			case engine.UciSetOptionClientMessage:
 				handleSetOption(message.SetOption, &position)
+			case engine.UciSaveHashClientMessage:
+				if err := engine.SaveTTFile(message.Path); err != nil {
+					engine.UciError(fmt.Sprintf("failed to save hash to %q: %v", message.Path, err))
+				} else {
+					engine.UciLog(fmt.Sprintf("saved hash to %s", message.Path))
+				}
+			case engine.UciLoadHashClientMessage:
+				if err := engine.LoadTTFile(message.Path); err != nil {
+					engine.UciError(fmt.Sprintf("failed to load hash from %q: %v", message.Path, err))
+				} else {
+					engine.UciLog(fmt.Sprintf("loaded hash from %s (Hash %d MB)", message.Path, engine.TTSize()))
+				}
+			case engine.UciEvalClientMessage:
+				trace := engine.TraceEval(&position)
+				if message.JSON {
+					enc := json.NewEncoder(os.Stdout)
+					enc.SetEscapeHTML(false)
+					enc.Encode(&trace)
+				} else {
+					trace.Write(os.Stdout)
+				}
 			}
 
 		case <-actionAlertChannel:
@@ -169,6 +214,56 @@ func handleSetOption(opt *engine.UciSetOptionMessage, position *engine.Position)
 		return
 	}
 
+	if strings.EqualFold(opt.Name, "Hash") {
+		n, err := strconv.Atoi(opt.Value)
+		if err != nil || n < 1 || n > engine.MaxTTSizeMB {
+			engine.UciError(fmt.Sprintf("invalid Hash value %q", opt.Value))
+			return
+		}
+		engine.ResizeTT(n)
+		return
+	}
+
+	if strings.EqualFold(opt.Name, "Deterministic") {
+		enabled, err := strconv.ParseBool(opt.Value)
+		if err != nil {
+			engine.UciError(fmt.Sprintf("invalid Deterministic value %q", opt.Value))
+			return
+		}
+		engine.Deterministic = enabled
+		return
+	}
+
+	if strings.EqualFold(opt.Name, "Contempt") {
+		n, err := strconv.Atoi(opt.Value)
+		if err != nil || n < -200 || n > 200 {
+			engine.UciError(fmt.Sprintf("invalid Contempt value %q", opt.Value))
+			return
+		}
+		engine.Contempt = int32(n)
+		return
+	}
+
+	if strings.EqualFold(opt.Name, "DynamicContempt") {
+		enabled, err := strconv.ParseBool(opt.Value)
+		if err != nil {
+			engine.UciError(fmt.Sprintf("invalid DynamicContempt value %q", opt.Value))
+			return
+		}
+		engine.DynamicContempt = enabled
+		return
+	}
+
+	if tunable := engine.FindTunable(opt.Name); engine.TuningBuild && tunable != nil {
+		n, err := strconv.Atoi(opt.Value)
+		if err != nil || n < tunable.Min || n > tunable.Max {
+			engine.UciError(fmt.Sprintf("invalid %s value %q", tunable.Name, opt.Value))
+			return
+		}
+		tunable.Set(n)
+		return
+	}
+
 	if !strings.EqualFold(opt.Name, "EvalFile") {
 		return
 	}
@@ -182,6 +277,7 @@ func handleSetOption(opt *engine.UciSetOptionMessage, position *engine.Position)
 		engine.UciError(fmt.Sprintf("failed to load EvalFile %q: %v", opt.Value, err))
 		return
 	}
+	engine.UciLog("NNUE " + engine.DefaultNetwork().Describe())
 
 	// The current position's accumulator was built from the old network,
 	// so it can't just be re-pointed at the new one -- reset to a position
@@ -189,3 +285,19 @@ func handleSetOption(opt *engine.UciSetOptionMessage, position *engine.Position)
 	// `position` command before the next `go`.
 	*position = engine.StartingPosition()
 }
+
+func printSPSAConfig(format string) {
+	var err error
+	switch format {
+	case "openbench":
+		err = engine.WriteOpenBenchSPSA(os.Stdout)
+	case "weather":
+		err = engine.WriteWeatherFactorySPSA(os.Stdout)
+	default:
+		err = fmt.Errorf("unknown SPSA config format %q (want openbench or weather)", format)
+	}
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"silverfish/engine"
+)
+
+// runNetCommand handles `silverfish net <subcommand> ...`, returning the
+// process exit code.
+func runNetCommand(args []string) int {
+	if len(args) != 2 || args[0] != "info" {
+		fmt.Fprintln(os.Stderr, "usage: silverfish net info <file>")
+		return 2
+	}
+	net, err := engine.LoadNNUEFile(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s: %v\n", args[1], err)
+		return 1
+	}
+	printNetInfo(net)
+	return 0
+}
+
+// formatVersions names what each network file format version added (see
+// engine/nnue.go); float and quantized files share the numbering. Version 4
+// is the first with a metadata block and a stored checksum.
+var formatVersions = map[int]string{
+	1: "original",
+	2: "input layout",
+	3: "architecture header",
+	4: "metadata and checksum",
+}
+
+func printNetInfo(net *engine.Network) {
+	format := "float"
+	if net.WInput == nil {
+		format = "quantized"
+	}
+	checksum := "computed over the file"
+	if net.FileVersion >= 4 {
+		checksum = "verified"
+	}
+	field := func(name string, value any) {
+		if value != "" && value != 0 {
+			fmt.Printf("%-15s %v\n", name+":", value)
+		}
+	}
+
+	field("file", net.Source)
+	field("format", fmt.Sprintf("%s, version %d (%s)", format, net.FileVersion, formatVersions[net.FileVersion]))
+	field("crc32", fmt.Sprintf("%08x (%s)", net.Checksum, checksum))
+	field("name", net.Info.Name)
+	field("training data", net.Info.TrainingData)
+	field("epochs", net.Info.Epochs)
+	field("date", net.Info.Date)
+	field("architecture", net.Architecture())
+	activations := net.Activation.String()
+	if net.WInput != nil && net.FloatActivation != net.Activation {
+		activations = fmt.Sprintf("%v (evaluated as %v)", net.FloatActivation, net.Activation)
+	}
+	for _, l := range net.Layers[:max(len(net.Layers)-1, 0)] {
+		activations += ", " + l.Activation.String()
+	}
+	field("activations", activations)
+	if !net.Layout.IsPlain() {
+		field("input layout", net.Layout)
+	}
+	field("scale", net.Info.Scale)
+	field("quantization", fmt.Sprintf("QA=%d QB=%d", net.QA, net.QB))
+}
@@ -0,0 +1,75 @@
+package engine
+
+// Contempt is the score, in Evaluate's units (roughly centipawns), by which
+// the side to move at the root considers a draw worse than an equal
+// position: positive to play on for a win against weaker opposition,
+// negative to steer toward a draw when not losing is what matters. Set via
+// the UCI "Contempt" option. 0 (the default) scores every draw as exactly
+// 0, as before.
+var Contempt int32 = 0
+
+// DynamicContempt, if set, shifts Contempt by up to DynamicContemptMax
+// toward the side that's better at the root: the further ahead the root
+// side is on static eval, the less it wants a draw, and the further
+// behind, the more it welcomes one. Set via the UCI "DynamicContempt"
+// option.
+var DynamicContempt = false
+
+// DynamicContemptMax bounds the dynamic adjustment, approached
+// asymptotically as the root eval grows (see initContempt).
+var DynamicContemptMax int32 = 50
+
+// contemptStep quantizes the effective contempt. Every distinct value gets
+// its own TT key space (see initContempt), so without this, dynamic
+// contempt would hand almost every search a fresh, empty TT.
+const contemptStep = 5
+
+// ContemptKeys are mixed into the TT key (see initContempt), one per root
+// side to move.
+var ContemptKeys [2]uint64
+
+// initContempt fixes this search's draw score before it starts: Contempt,
+// plus the dynamic adjustment if enabled, from the point of view of the side
+// to move at the root.
+//
+// A draw score is relative to the root side, not to the side to move at the
+// node where it's found, so every score backed up through a draw depends on
+// both the contempt in force and who was to move at the root. Reusing such
+// a score from a search with a different setting would silently apply the
+// wrong contempt, so each (contempt, root side) pair gets its own key space
+// in the TT: ttKey XORs a key derived from both into the position hash.
+// With zero contempt the key is 0, and the TT behaves exactly as it did
+// before contempt existed.
+func (search *Search) initContempt() {
+	contempt := Contempt
+	if DynamicContempt && search.Pos.Checkers(search.Pos.Turn) == 0 {
+		eval := Evaluate(&search.Pos)
+		contempt += DynamicContemptMax * eval / (abs32(eval) + 200)
+	}
+	contempt = contempt / contemptStep * contemptStep
+
+	search.contempt = contempt
+	search.contemptKey = ContemptKeys[search.Pos.Turn] * uint64(int64(contempt))
+}
+
+// drawScore is the score of a drawn position ply plies from the root, from
+// the point of view of the side to move there.
+func (search *Search) drawScore(ply int) int32 {
+	if ply%2 == 0 {
+		return -search.contempt
+	}
+	return search.contempt
+}
+
+// ttKey is the current position's TT key: its Zobrist hash, separated by
+// contempt setting (see initContempt).
+func (search *Search) ttKey() uint64 {
+	return search.Pos.Hash ^ search.contemptKey
+}
+
+func abs32(x int32) int32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
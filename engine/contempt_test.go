@@ -0,0 +1,40 @@
+package engine_test
+
+import (
+	"testing"
+	"time"
+
+	"silverfish/engine"
+)
+
+// Every move from a KNvK position is an immediate draw by insufficient
+// material, so the root score is exactly the draw score -- -Contempt from
+// the root side's point of view, whichever side that is. A search without
+// contempt afterward, on the same (uncleared) TT, must still score 0: the
+// first search's draw scores mustn't leak into it.
+func TestContemptDrawScore(t *testing.T) {
+	defer func(old int32) { engine.Contempt = old }(engine.Contempt)
+
+	for _, fen := range []string{
+		"4k3/8/8/8/8/8/8/4KN2 w - - 0 1",
+		"4k3/8/8/8/8/8/8/4KN2 b - - 0 1",
+	} {
+		engine.ClearTT()
+		for _, contempt := range []int32{20, 0, -15} {
+			engine.Contempt = contempt
+
+			pos := engine.FromFEN(fen)
+			search := engine.Search{MaxDepth: 3, TimeLimit: 4 * time.Second}
+			search.Init(&pos)
+			var score int32
+			captureStdout(t, func() { score, _ = search.Search() })
+
+			if score != -contempt {
+				t.Errorf("%s: Contempt = %d: score = %d, want %d", fen, contempt, score, -contempt)
+			}
+			if _, hit := engine.TTProbe(pos.Hash); contempt == 20 && hit {
+				t.Errorf("%s: search with contempt stored its root entry under the plain position hash", fen)
+			}
+		}
+	}
+}
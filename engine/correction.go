@@ -0,0 +1,77 @@
+package engine
+
+// Correction history: a running estimate of how far the static eval tends
+// to be from what the search actually finds, learned per pawn structure
+// and per material balance. Static evals are systematically off in ways
+// that correlate with both -- a pawn structure the network misjudges
+// stays misjudged in every position that shares it -- so after a search
+// resolves a node, the gap between its score and its raw static eval is
+// folded into the entries for its PawnHash and MaterialKey, and later
+// static evals are shifted by what those entries have learned
+// (correctedEval). Sharper static evals make every eval-based pruning
+// decision in alphaBetaInner more accurate.
+
+const (
+	// corrHistSize is the number of entries per side to move in each
+	// table, indexed by the low bits of the key. Collisions just blend two
+	// structures' corrections; no verification is worth the memory.
+	corrHistSize = 16384
+
+	// Entries are kept in 1/corrHistGrain units of eval, so the running
+	// average below doesn't lose small corrections to integer rounding.
+	corrHistGrain = 256
+
+	// An update moves an entry weight/corrHistWeightScale of the way
+	// toward the newly observed gap, with weight growing with depth
+	// (deeper searches are more trustworthy) up to corrHistMaxWeight.
+	corrHistWeightScale = 256
+	corrHistMaxWeight   = 16
+
+	// corrHistMax bounds each entry (in grain units), so no correction
+	// can exceed 32 eval units per table.
+	corrHistMax = corrHistGrain * 32
+)
+
+// correctedEval returns rawEval shifted by the correction history entries
+// for the current position: the average of what the pawn-structure and
+// material tables have learned, kept clear of the mate score range.
+func (search *Search) correctedEval(rawEval int32) int32 {
+	turn := search.Pos.Turn
+	pawn := search.pawnCorrHist[turn][search.Pos.PawnHash%corrHistSize]
+	material := search.materialCorrHist[turn][search.Pos.MaterialKey%corrHistSize]
+	eval := rawEval + (pawn+material)/(2*corrHistGrain)
+	return max(-MateScoreThreshold+1, min(MateScoreThreshold-1, eval))
+}
+
+// updateCorrectionHistory folds a finished node's result into the
+// correction tables. bestScore is only a bound unless bound is
+// BoundExact, so it's only informative on the side of staticEval (the
+// corrected eval the node worked with) that the bound points to: a fail
+// high above the eval says the eval was too low, but a fail high below it
+// says nothing. Skipped in check (no static eval), for mate scores (not an
+// eval error), and when the best move was a capture or promotion -- the
+// static eval isn't meant to see tactics, so a tactical best move isn't
+// evidence it was wrong.
+func (search *Search) updateCorrectionHistory(bestMove Move, rawEval, staticEval, bestScore int32, bound uint8, depth int) {
+	if rawEval == noEval || bestScore >= MateScoreThreshold || bestScore <= -MateScoreThreshold {
+		return
+	}
+	if bestMove != 0 && !isQuietMove(&search.Pos, bestMove) {
+		return
+	}
+	if (bound == BoundLower && bestScore <= staticEval) || (bound == BoundUpper && bestScore >= staticEval) {
+		return
+	}
+
+	diff := max(-corrHistMax, min(corrHistMax, (bestScore-rawEval)*corrHistGrain))
+	weight := int32(min(depth+1, corrHistMaxWeight))
+
+	turn := search.Pos.Turn
+	for _, entry := range [2]*int32{
+		&search.pawnCorrHist[turn][search.Pos.PawnHash%corrHistSize],
+		&search.materialCorrHist[turn][search.Pos.MaterialKey%corrHistSize],
+	} {
+		updated := (*entry*(corrHistWeightScale-weight) + diff*weight) / corrHistWeightScale
+		*entry = max(-corrHistMax, min(corrHistMax, updated))
+	}
+}
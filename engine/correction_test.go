@@ -0,0 +1,63 @@
+package engine_test
+
+import (
+	"testing"
+
+	"silverfish/engine"
+)
+
+// Searches that keep finding a position better than its static eval should
+// pull the corrected eval up toward what they found, one step at a time,
+// but never past the per-table clamp; and the same for worse. Results that
+// say nothing about the eval's error -- a fail high below it, a tactical
+// best move -- must leave it alone.
+func TestCorrectionHistory(t *testing.T) {
+	pos := engine.FromFEN("r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4")
+	search := engine.Search{}
+	search.Init(&pos)
+
+	// The most one table can correct by, in eval units (see corrHistMax);
+	// correctedEval averages two of them.
+	const maxCorrection = 32
+	const raw = 50
+
+	if got := search.CorrectedEval(raw); got != raw {
+		t.Fatalf("corrected eval %d before any update, want the raw eval %d", got, raw)
+	}
+
+	// A fail high below the eval, and a capture as best move, are no
+	// evidence about the eval.
+	capture := engine.NewMoveFromStr("c4f7")
+	search.UpdateCorrectionHistory(0, raw, raw, raw-200, engine.BoundLower, 8)
+	search.UpdateCorrectionHistory(capture, raw, raw, raw+200, engine.BoundExact, 8)
+	if got := search.CorrectedEval(raw); got != raw {
+		t.Errorf("corrected eval %d after uninformative updates, want %d", got, raw)
+	}
+
+	prev := int32(raw)
+	for i := 0; i < 40; i++ {
+		staticEval := search.CorrectedEval(raw)
+		search.UpdateCorrectionHistory(0, raw, staticEval, raw+300, engine.BoundExact, 8)
+		got := search.CorrectedEval(raw)
+		if got < prev || got > raw+maxCorrection {
+			t.Fatalf("update %d toward +300: corrected eval %d, want in [%d, %d]", i+1, got, prev, raw+maxCorrection)
+		}
+		prev = got
+	}
+	if prev <= raw+maxCorrection/2 {
+		t.Errorf("corrected eval %d after 40 updates toward +300, want it close to the clamp %d", prev, raw+maxCorrection)
+	}
+
+	for i := 0; i < 80; i++ {
+		staticEval := search.CorrectedEval(raw)
+		search.UpdateCorrectionHistory(0, raw, staticEval, raw-300, engine.BoundUpper, 8)
+		got := search.CorrectedEval(raw)
+		if got > prev || got < raw-maxCorrection {
+			t.Fatalf("update %d toward -300: corrected eval %d, want in [%d, %d]", i+1, got, raw-maxCorrection, prev)
+		}
+		prev = got
+	}
+	if prev >= raw {
+		t.Errorf("corrected eval %d after 80 fail lows at -300, want it below the raw eval %d", prev, raw)
+	}
+}
@@ -0,0 +1,185 @@
+package engine
+
+import "math/rand"
+
+// Self-play data generation: games of the engine against itself at a fixed
+// node count per move, played in-process, each position labeled with its
+// search score and, once the game is over, the game's result -- the
+// training data for the next network (see the trainer package).
+//
+// Games open with a few uniformly random moves, so no two games (from a
+// well-seeded generator) play the same opening, and end by the rules or by
+// adjudication: once both sides' searches agree one side is winning by a
+// wide margin, or that the game is dead level, playing on adds nothing but
+// time. Not every position is kept: positions in check, or whose best move
+// is a capture or promotion, are in the middle of a tactic that a static
+// evaluation shouldn't be asked to see through -- their score belongs to
+// the quiet position at the end of it -- and mate scores say nothing about
+// how good a position looks.
+//
+// A SelfPlayer plays one game at a time with a Search and a transposition
+// table of its own, so any number of them can run in parallel, and each
+// game -- starting from fresh history tables and an empty table, searching
+// to a node count single-threaded -- is decided entirely by the rng it's
+// played with. Sharing one table between players, as Lazy SMP threads do,
+// would make every game depend on how the others happened to be scheduled.
+
+// DatagenConfig is how self-play games are played and adjudicated.
+type DatagenConfig struct {
+	Nodes int // search nodes per move
+	Hash  int // transposition table megabytes per SelfPlayer
+
+	// RandomPlies random moves open each game; openings the search then
+	// scores beyond MaxOpeningScore for either side are replaced.
+	RandomPlies     int
+	MaxOpeningScore int32
+
+	// A game is adjudicated won once the score has stayed at least
+	// WinScore for the same side for WinPlies plies in a row, drawn once
+	// it has stayed within DrawScore of zero for DrawPlies plies in a row
+	// (from ply DrawMinPly on), and drawn at MaxPlies regardless.
+	WinScore   int32
+	WinPlies   int
+	DrawScore  int32
+	DrawPlies  int
+	DrawMinPly int
+	MaxPlies   int
+}
+
+// DefaultDatagenConfig is the datagen subcommand's default.
+var DefaultDatagenConfig = DatagenConfig{
+	Nodes:           5000,
+	Hash:            16,
+	RandomPlies:     8,
+	MaxOpeningScore: 400,
+	WinScore:        2000,
+	WinPlies:        4,
+	DrawScore:       10,
+	DrawPlies:       12,
+	DrawMinPly:      80,
+	MaxPlies:        400,
+}
+
+// SelfPlayGame is one finished self-play game: the positions kept from it,
+// labeled with their scores and the result, and how it ended.
+type SelfPlayGame struct {
+	Positions []PackedPosition
+	Result    GameResult
+	Plies     int
+}
+
+// SelfPlayer plays self-play games. It isn't safe for concurrent use; run
+// one per goroutine.
+type SelfPlayer struct {
+	Config DatagenConfig
+	search Search
+	tt     ttTable
+}
+
+// NewSelfPlayer returns a SelfPlayer playing games as cfg says.
+func NewSelfPlayer(cfg DatagenConfig) *SelfPlayer {
+	sp := &SelfPlayer{Config: cfg}
+	sp.tt.alloc(max(cfg.Hash, 1))
+	return sp
+}
+
+// PlayGame plays one game, with its opening drawn from rng.
+func (sp *SelfPlayer) PlayGame(rng *rand.Rand) SelfPlayGame {
+	cfg := &sp.Config
+	// every game starts from fresh history tables and an empty table, so
+	// games don't depend on which player played what before them
+	sp.tt.reset()
+	sp.search = Search{silent: true, tt: &sp.tt}
+	pos := sp.opening(rng)
+
+	var game SelfPlayGame
+	winPlies, drawPlies := 0, 0
+	for ; ; game.Plies++ {
+		if game.Result = pos.Result(); game.Result.Outcome != Ongoing {
+			break
+		}
+		if game.Plies >= cfg.MaxPlies {
+			game.Result = GameResult{Drawn, Adjudication}
+			break
+		}
+
+		score, move := sp.searchMove(&pos)
+		if pos.Turn == Black {
+			score = -score
+		}
+		if pos.Checkers(pos.Turn) == 0 && isQuietMove(&pos, move) && abs32(score) < MateScoreThreshold {
+			game.Positions = append(game.Positions, pos.Pack(score))
+		}
+
+		// adjudicate on the scores of consecutive plies, so both sides'
+		// searches have to agree
+		switch {
+		case score >= cfg.WinScore:
+			winPlies = max(winPlies, 0) + 1
+		case score <= -cfg.WinScore:
+			winPlies = min(winPlies, 0) - 1
+		default:
+			winPlies = 0
+		}
+		if abs32(score) <= cfg.DrawScore && game.Plies >= cfg.DrawMinPly {
+			drawPlies++
+		} else {
+			drawPlies = 0
+		}
+		if winPlies >= cfg.WinPlies {
+			game.Result = GameResult{WhiteWins, Adjudication}
+			break
+		}
+		if -winPlies >= cfg.WinPlies {
+			game.Result = GameResult{BlackWins, Adjudication}
+			break
+		}
+		if drawPlies >= cfg.DrawPlies {
+			game.Result = GameResult{Drawn, Adjudication}
+			break
+		}
+
+		pos.DoMove(move)
+	}
+
+	for i := range game.Positions {
+		game.Positions[i].SetResult(game.Result.Outcome)
+	}
+	return game
+}
+
+// opening plays RandomPlies random moves from the starting position, until
+// it finds an opening that isn't over and isn't already lopsided.
+func (sp *SelfPlayer) opening(rng *rand.Rand) Position {
+	for {
+		pos := StartingPosition()
+		for ply := 0; ply < sp.Config.RandomPlies; ply++ {
+			moves := pos.LegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			pos.DoMove(moves[rng.Intn(len(moves))])
+		}
+		if pos.Result().Outcome != Ongoing {
+			continue
+		}
+		if score, _ := sp.searchMove(&pos); abs32(score) <= sp.Config.MaxOpeningScore {
+			return pos
+		}
+	}
+}
+
+// searchMove searches pos to the node limit, returning the score from the
+// side to move's point of view and the best move. Each search is a new
+// table generation, as a game's searches are in UCI play, so entries from
+// earlier moves are the first to go.
+func (sp *SelfPlayer) searchMove(pos *Position) (int32, Move) {
+	sp.tt.newSearch()
+	search := &sp.search
+	search.Init(pos)
+	search.Nodes, search.timedOut = 0, false
+	search.MaxDepth = InfiniteDepth
+	search.noTimeLimit = true
+	search.NodeLimit = sp.Config.Nodes
+	return search.Search()
+}
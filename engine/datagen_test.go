@@ -0,0 +1,162 @@
+package engine_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+
+	"silverfish/engine"
+)
+
+func TestPackedPositionRoundTrip(t *testing.T) {
+	corpus := nnueCorpus(2000)
+	for _, fen := range []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+		"8/8/4k3/8/8/4K3/8/8 b - - 99 250",
+	} {
+		corpus = append(corpus, engine.FromFEN(fen))
+	}
+
+	buf := make([]byte, engine.PackedSize)
+	for i := range corpus {
+		pos := &corpus[i]
+		packed := pos.Pack(int32(i) - 1000)
+		packed.SetResult(engine.BlackWins)
+		packed.Encode(buf)
+		decoded := engine.DecodePackedPosition(buf)
+		if decoded != packed {
+			t.Fatalf("%s: decoded %+v, packed %+v", pos.ToFEN(), decoded, packed)
+		}
+		unpacked, err := decoded.Unpack()
+		if err != nil {
+			t.Fatalf("%s: %v", pos.ToFEN(), err)
+		}
+		if unpacked.ToFEN() != pos.ToFEN() || unpacked.Hash != pos.Hash || unpacked.MaterialKey != pos.MaterialKey {
+			t.Fatalf("unpacked %s, packed %s", unpacked.ToFEN(), pos.ToFEN())
+		}
+		if decoded.Score != int16(i-1000) || decoded.Result != engine.PackedBlackWins {
+			t.Fatalf("%s: labels %d, %d", pos.ToFEN(), decoded.Score, decoded.Result)
+		}
+	}
+
+	pos := engine.StartingPosition()
+	if p := pos.Pack(100000); p.Score != 32767 {
+		t.Errorf("score 100000 packed as %d, want clamped to 32767", p.Score)
+	}
+	bad := pos.Pack(0)
+	bad.Pieces[0] = 0x7 // piece type 7
+	if _, err := bad.Unpack(); err == nil {
+		t.Errorf("unpacked an invalid piece code")
+	}
+}
+
+func TestPackedReaderWriter(t *testing.T) {
+	corpus := nnueCorpus(100)
+	var buf bytes.Buffer
+	w := engine.NewPackedWriter(&buf)
+	for i := range corpus {
+		p := corpus[i].Pack(int32(i))
+		if err := w.Write(&p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != len(corpus)*engine.PackedSize {
+		t.Fatalf("wrote %d bytes, want %d", buf.Len(), len(corpus)*engine.PackedSize)
+	}
+
+	r := engine.NewPackedReader(bytes.NewReader(buf.Bytes()))
+	for i := range corpus {
+		p, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != corpus[i].Pack(int32(i)) {
+			t.Fatalf("position %d: read %+v", i, p)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("read past the end: %v, want io.EOF", err)
+	}
+	r = engine.NewPackedReader(bytes.NewReader(buf.Bytes()[:engine.PackedSize+5]))
+	r.Read()
+	if _, err := r.Read(); err != io.ErrUnexpectedEOF {
+		t.Errorf("read a truncated record: %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+// Self-play games have to finish, keep only quiet positions, and label
+// every one with the game's result -- with several players at once, as
+// the datagen subcommand runs them.
+func TestSelfPlay(t *testing.T) {
+	cfg := engine.DefaultDatagenConfig
+	cfg.Nodes = 400
+	cfg.MaxPlies = 160
+
+	games := make([]engine.SelfPlayGame, 2)
+	var wg sync.WaitGroup
+	for i := range games {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			games[i] = engine.NewSelfPlayer(cfg).PlayGame(rand.New(rand.NewSource(int64(i))))
+		}()
+	}
+	wg.Wait()
+
+	for i, game := range games {
+		if game.Result.Outcome == engine.Ongoing || game.Plies > cfg.MaxPlies {
+			t.Errorf("game %d: %v after %d plies", i, game.Result, game.Plies)
+		}
+		if len(game.Positions) == 0 {
+			t.Errorf("game %d: no positions kept", i)
+		}
+		t.Logf("game %d: %v by %v after %d plies, %d positions", i, game.Result, game.Result.Termination, game.Plies, len(game.Positions))
+
+		want := map[engine.Outcome]uint8{
+			engine.WhiteWins: engine.PackedWhiteWins,
+			engine.BlackWins: engine.PackedBlackWins,
+			engine.Drawn:     engine.PackedDraw,
+		}[game.Result.Outcome]
+		for _, p := range game.Positions {
+			pos, err := p.Unpack()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pos.Checkers(pos.Turn) != 0 {
+				t.Errorf("game %d: kept %s, which is in check", i, pos.ToFEN())
+			}
+			if p.Result != want {
+				t.Errorf("game %d: %s labeled %d, want %d", i, pos.ToFEN(), p.Result, want)
+			}
+		}
+	}
+}
+
+// A game is decided by the rng it's played with: the same seed has to
+// give the same positions, scores and result, whether it's the same
+// player's next game or another player's.
+func TestSelfPlayDeterministic(t *testing.T) {
+	cfg := engine.DefaultDatagenConfig
+	cfg.Nodes = 400
+	cfg.MaxPlies = 60
+
+	player := engine.NewSelfPlayer(cfg)
+	want := player.PlayGame(rand.New(rand.NewSource(7)))
+	if len(want.Positions) == 0 {
+		t.Fatalf("no positions kept")
+	}
+	for name, p := range map[string]*engine.SelfPlayer{"same player": player, "new player": engine.NewSelfPlayer(cfg)} {
+		got := p.PlayGame(rand.New(rand.NewSource(7)))
+		if got.Result != want.Result || got.Plies != want.Plies || !slices.Equal(got.Positions, want.Positions) {
+			t.Errorf("%s: %v after %d plies, %d positions; want %v after %d plies, %d positions",
+				name, got.Result, got.Plies, len(got.Positions), want.Result, want.Plies, len(want.Positions))
+		}
+	}
+}
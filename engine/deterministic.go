@@ -0,0 +1,36 @@
+package engine
+
+// Deterministic, when set, makes SearchLazySMP reproducible: the same
+// position and limits always give the same best move, score, PV and node
+// count. Normally none of those are stable from run to run -- helper
+// threads race each other, a time limit ends the search after however many
+// nodes the machine managed, and the TT carries over whatever earlier
+// searches left in it -- which makes regression debugging painful. In
+// deterministic mode the search runs single-threaded regardless of
+// Threads, starts from an empty TT and a freshly-seeded Rng, and stops on
+// node count only (see prepareDeterministic). Set via the UCI
+// "Deterministic" option.
+var Deterministic = false
+
+// DeterministicNPS converts a time limit into a node limit in deterministic
+// mode: a search given t seconds gets t*DeterministicNPS nodes. Roughly
+// this engine's single-threaded speed, so time controls still play at
+// about the intended strength.
+var DeterministicNPS = 150000
+
+// prepareDeterministic puts the state a search depends on into a fixed
+// starting point: an empty TT, Rng at its seed, and a node budget in place
+// of the wall-clock one -- the clock isn't looked at at all, so however
+// long a depth-limited search takes on a slow machine, it ends the same
+// way. A search with neither a node limit nor a finite time limit (depth-
+// or mate-limited, or infinite) keeps its own stopping rule, which is
+// deterministic already.
+func (search *Search) prepareDeterministic() {
+	search.tt.reset()
+	ResetRng()
+
+	if search.NodeLimit == 0 && search.TimeLimit < InfiniteMovetime {
+		search.NodeLimit = max(1, int(search.TimeLimit.Seconds()*float64(DeterministicNPS)))
+	}
+	search.noTimeLimit = true
+}
@@ -63,6 +63,10 @@ func (pos *Position) DoMove(move Move) {
 	}
 	pos.Hash ^= CastleKeys[pos.CastlingRights]
 
+	// the accumulators aren't touched here: the pieces the move changes are
+	// recorded on the stack and applied when the position is evaluated
+	dirty := pos.Accs.push()
+
 	if move.IsCastling() {
 		pos.RemovePiece(from)
 		rookFromSquare := RookSquares[move]
@@ -70,22 +74,37 @@ func (pos *Position) DoMove(move Move) {
 		rookToSquare := Square(int(to) - KingCastlingDirection(move))
 		pos.PutPiece(rookToSquare, Rook, ourColor)
 		pos.PutPiece(to, King, ourColor)
+		dirty.remove(ourColor, King, from)
+		dirty.remove(ourColor, Rook, rookFromSquare)
+		dirty.add(ourColor, Rook, rookToSquare)
+		dirty.add(ourColor, King, to)
 	} else if move.IsEnPassant() {
 		pos.RemovePiece(from)
 		capturedPawnSq := Square(int(to) - PawnDisplacement(ourColor))
 		pos.RemovePiece(capturedPawnSq)
 		pos.PutPiece(to, movingPiece, ourColor)
+		dirty.remove(ourColor, Pawn, from)
+		dirty.remove(ourColor^1, Pawn, capturedPawnSq)
+		dirty.add(ourColor, Pawn, to)
 	} else if move.IsPromotion() {
 		pos.RemovePiece(from)
+		dirty.remove(ourColor, Pawn, from)
 		if capturedPiece != NoPiece { // is a capture
 			pos.RemovePiece(to)
+			dirty.remove(ourColor^1, capturedPiece, to)
 		}
 		pos.PutPiece(to, move.Promotion(), ourColor)
-	} else if capturedPiece != NoPiece { // is a capture: fuse remove(from)+remove(to)+put(to) into one accumulator pass
+		dirty.add(ourColor, move.Promotion(), to)
+	} else if capturedPiece != NoPiece { // is a capture
 		pos.Rule50 = 0
 		pos.CapturePiece(from, to, movingPiece, ourColor, capturedPiece)
-	} else { // plain quiet move: fuse remove(from)+put(to) into one accumulator pass
+		dirty.remove(ourColor, movingPiece, from)
+		dirty.remove(ourColor^1, capturedPiece, to)
+		dirty.add(ourColor, movingPiece, to)
+	} else { // plain quiet move
 		pos.MovePiece(from, to, movingPiece, ourColor)
+		dirty.remove(ourColor, movingPiece, from)
+		dirty.add(ourColor, movingPiece, to)
 	}
 
 	pos.Ply++
@@ -130,6 +149,10 @@ func (pos *Position) UndoMove(move Move) {
 	pos.Ply--
 	// pos.Turn is now the side that did the move
 
+	// the parent ply's accumulator was never modified, so undoing the move
+	// for evaluation is just dropping this ply's
+	pos.Accs.pop()
+
 	pos.CastlingRights = lastState.CastlingRights
 	pos.EnPassantSquare = lastState.EnPassantSquare
 	pos.Rule50 = lastState.Rule50
@@ -152,9 +175,9 @@ func (pos *Position) UndoMove(move Move) {
 		if lastState.CapturedPiece != NoPiece {            // capture
 			pos.PutPiece(to, lastState.CapturedPiece, pos.Turn^1) // put piece back
 		}
-	} else if lastState.CapturedPiece != NoPiece { // capture: fuse put(from)+remove(to)+put(to) into one accumulator pass
+	} else if lastState.CapturedPiece != NoPiece { // capture
 		pos.UncapturePiece(from, to, lastState.MovedPiece, pos.Turn, lastState.CapturedPiece)
-	} else { // quiet move: fuse put(from)+remove(to) into one accumulator pass
+	} else { // quiet move
 		pos.MovePiece(to, from, lastState.MovedPiece, pos.Turn)
 	}
 
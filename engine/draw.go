@@ -0,0 +1,183 @@
+package engine
+
+import "math/bits"
+
+// IsDraw reports whether the search should score the current position as a
+// draw. ply is the distance from the search root, as in alphaBetaInner; it
+// decides how strictly repetitions are judged (see repetitionDraw). Covers
+// the fifty-move rule, dead positions with insufficient mating material,
+// and repetitions -- but not stalemate, which needs a full move generation
+// and is found by the search itself when a node has no legal moves.
+func (pos *Position) IsDraw(ply int) bool {
+	if pos.Rule50 >= 100 && !pos.isCheckmate() {
+		return true
+	}
+	return pos.HasInsufficientMaterial() || pos.repetitionDraw(ply)
+}
+
+// repetitionDraw is IsDraw's repetition test. A repetition inside the
+// search tree -- the earlier occurrence came after the root -- is scored as
+// a draw on the first repeat, like IsRepetition: whichever side is
+// steering toward it could force it again, so there's nothing to gain by
+// searching on until a literal threefold. A repetition of a position from
+// the game before the root is different: that earlier occurrence really
+// happened and can't be "un-chosen", but it's only one of the three a
+// draw claim needs, so it's scored as a draw only if the position has
+// already occurred twice, making this a true threefold.
+func (pos *Position) repetitionDraw(ply int) bool {
+	n := len(pos.History)
+	limit := min(int(pos.Rule50), n)
+	count := 0
+	for i := 2; i <= limit; i += 2 {
+		if pos.History[n-i].Hash != pos.Hash {
+			continue
+		}
+		if i < ply {
+			return true
+		}
+		count++
+		if count == 2 {
+			return true
+		}
+	}
+	return false
+}
+
+// repetitionCount returns how many times the current position has occurred
+// in the game so far, counting the current occurrence.
+func (pos *Position) repetitionCount() int {
+	n := len(pos.History)
+	limit := min(int(pos.Rule50), n)
+	count := 1
+	for i := 2; i <= limit; i += 2 {
+		if pos.History[n-i].Hash == pos.Hash {
+			count++
+		}
+	}
+	return count
+}
+
+// HasInsufficientMaterial reports whether neither side can possibly
+// checkmate: a bare king against a bare king or a lone minor piece (KvK,
+// KNvK, KBvK), or any number of bishops, all on squares of one color.
+// Positions that are merely impossible to win by force, like KNNvK, are
+// left to the search.
+func (pos *Position) HasInsufficientMaterial() bool {
+	for color := White; color <= Black; color++ {
+		if pos.Pieces[color][Pawn]|pos.Pieces[color][Rook]|pos.Pieces[color][Queen] != 0 {
+			return false
+		}
+	}
+
+	knights := pos.Pieces[White][Knight] | pos.Pieces[Black][Knight]
+	bishops := pos.Pieces[White][Bishop] | pos.Pieces[Black][Bishop]
+	if bits.OnesCount64(uint64(knights|bishops)) <= 1 {
+		return true
+	}
+	return knights == 0 && (bishops&BB_DarkSquares == 0 || bishops&BB_LightSquares == 0)
+}
+
+// isCheckmate reports whether the side to move is checkmated.
+func (pos *Position) isCheckmate() bool {
+	return pos.Checkers(pos.Turn) != 0 && !pos.hasLegalMove()
+}
+
+// hasLegalMove reports whether the side to move has any legal move.
+func (pos *Position) hasLegalMove() bool {
+	moveList := GenMoves(pos, BB_Full)
+	for i := uint8(0); i < moveList.Count; i++ {
+		if pos.MoveIsLegal(moveList.Moves[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Outcome is the game-theoretic state of a position: still in progress, or
+// won by one side, or drawn.
+type Outcome uint8
+
+const (
+	Ongoing Outcome = iota
+	WhiteWins
+	BlackWins
+	Drawn
+)
+
+// Termination is why a game ended.
+type Termination uint8
+
+const (
+	NotTerminated Termination = iota
+	Checkmate
+	Stalemate
+	FiftyMoveRule
+	InsufficientMaterial
+	ThreefoldRepetition
+	// Adjudication ends a game before the rules do, when playing it out
+	// would tell nothing new (see SelfPlayer).
+	Adjudication
+)
+
+// GameResult is what Position.Result reports: the outcome, and for a
+// finished game, the rule that ended it.
+type GameResult struct {
+	Outcome     Outcome
+	Termination Termination
+}
+
+// String returns the result in PGN notation: "1-0", "0-1", "1/2-1/2", or
+// "*" for a game still in progress.
+func (result GameResult) String() string {
+	switch result.Outcome {
+	case WhiteWins:
+		return "1-0"
+	case BlackWins:
+		return "0-1"
+	case Drawn:
+		return "1/2-1/2"
+	}
+	return "*"
+}
+
+var terminationNames = [...]string{
+	NotTerminated:        "none",
+	Checkmate:            "checkmate",
+	Stalemate:            "stalemate",
+	FiftyMoveRule:        "fifty-move rule",
+	InsufficientMaterial: "insufficient material",
+	ThreefoldRepetition:  "threefold repetition",
+	Adjudication:         "adjudication",
+}
+
+func (termination Termination) String() string {
+	return terminationNames[termination]
+}
+
+// Result reports whether the game has ended in the current position, and
+// how, by the rules of chess rather than the search's heuristics: unlike
+// IsDraw, a repetition only ends the game on its third occurrence. History
+// must cover the whole game, as it does for a position built by replaying
+// moves with DoMove. Meant for match and data-generation tools that play
+// games out move by move; the search itself uses IsDraw.
+func (pos *Position) Result() GameResult {
+	if !pos.hasLegalMove() {
+		if pos.Checkers(pos.Turn) == 0 {
+			return GameResult{Drawn, Stalemate}
+		}
+		if pos.Turn == White {
+			return GameResult{BlackWins, Checkmate}
+		}
+		return GameResult{WhiteWins, Checkmate}
+	}
+	if pos.Rule50 >= 100 {
+		return GameResult{Drawn, FiftyMoveRule}
+	}
+	if pos.HasInsufficientMaterial() {
+		return GameResult{Drawn, InsufficientMaterial}
+	}
+	if pos.repetitionCount() >= 3 {
+		return GameResult{Drawn, ThreefoldRepetition}
+	}
+	return GameResult{Ongoing, NotTerminated}
+}
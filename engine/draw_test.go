@@ -0,0 +1,131 @@
+package engine_test
+
+import (
+	"testing"
+
+	"silverfish/engine"
+)
+
+// playUCI plays each move (in UCI notation) on pos, failing the test if one
+// isn't legal.
+func playUCI(t *testing.T, pos *engine.Position, moves ...string) {
+	t.Helper()
+	for _, uci := range moves {
+		want := engine.NewMoveFromStr(uci)
+		var legal engine.Move
+		for _, lm := range pos.LegalMoves() {
+			if lm.From() == want.From() && lm.To() == want.To() && (!want.IsPromotion() || lm == want) {
+				legal = lm
+				break
+			}
+		}
+		if legal == engine.Move(0) {
+			t.Fatalf("%s not legal in %s", uci, pos.ToFEN())
+		}
+		pos.DoMove(legal)
+	}
+}
+
+func TestHasInsufficientMaterial(t *testing.T) {
+	cases := []struct {
+		name string
+		fen  string
+		want bool
+	}{
+		{"KvK", "4k3/8/8/8/8/8/8/4K3 w - - 0 1", true},
+		{"KNvK", "4k3/8/8/8/8/8/8/4KN2 w - - 0 1", true},
+		{"KvKB", "4kb2/8/8/8/8/8/8/4K3 w - - 0 1", true},
+		{"KBvKB same color", "2b1k3/8/8/8/8/8/8/4KB2 w - - 0 1", true},
+		{"KBBvK opposite colors", "4k3/8/8/8/8/8/3B4/4KB2 w - - 0 1", false},
+		{"KBBvK same color", "4k3/8/8/8/8/8/6B1/4KB2 w - - 0 1", true},
+		{"KBvKB opposite colors", "3bk3/8/8/8/8/8/8/4KB2 w - - 0 1", false},
+		{"KNvKN", "4kn2/8/8/8/8/8/8/4KN2 w - - 0 1", false},
+		{"KNNvK", "4k3/8/8/8/8/8/8/3NKN2 w - - 0 1", false},
+		{"KBNvK", "4k3/8/8/8/8/8/8/3BKN2 w - - 0 1", false},
+		{"KPvK", "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", false},
+		{"KRvK", "4k3/8/8/8/8/8/8/4K2R w - - 0 1", false},
+	}
+	for _, tc := range cases {
+		pos := engine.FromFEN(tc.fen)
+		if got := pos.HasInsufficientMaterial(); got != tc.want {
+			t.Errorf("%s: HasInsufficientMaterial() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestIsDrawFiftyMoveRule(t *testing.T) {
+	pos := engine.FromFEN("4k3/8/8/8/8/8/8/R3K3 w - - 99 80")
+	if pos.IsDraw(0) {
+		t.Errorf("drawn at Rule50 = 99")
+	}
+	playUCI(t, &pos, "a1a2")
+	if !pos.IsDraw(1) {
+		t.Errorf("not drawn at Rule50 = 100")
+	}
+
+	// Checkmate on the hundredth ply still counts as checkmate.
+	pos = engine.FromFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 99 80")
+	playUCI(t, &pos, "a1a8")
+	if pos.IsDraw(1) {
+		t.Errorf("checkmate on the fiftieth move scored as a draw")
+	}
+	if got := pos.Result(); got.Outcome != engine.WhiteWins || got.Termination != engine.Checkmate {
+		t.Errorf("Result() = %v (%v), want 1-0 by checkmate", got, got.Termination)
+	}
+}
+
+func TestIsDrawRepetition(t *testing.T) {
+	cycle := []string{"e1d1", "e8d8", "d1e1", "d8e8"}
+
+	// A repetition whose first occurrence is inside the search tree is a
+	// draw straight away...
+	pos := engine.FromFEN("4k3/8/8/8/8/8/8/R3K3 w - - 0 1")
+	playUCI(t, &pos, cycle...)
+	if !pos.IsDraw(len(cycle) + 1) {
+		t.Errorf("in-tree repetition not scored as a draw")
+	}
+
+	// ...but the same single repeat reaching back before the root isn't
+	// until the position has occurred three times.
+	if pos.IsDraw(1) {
+		t.Errorf("twofold repetition of a pre-root position scored as a draw")
+	}
+	if got := pos.Result(); got.Outcome != engine.Ongoing {
+		t.Errorf("Result() = %v after a twofold repetition, want *", got)
+	}
+
+	playUCI(t, &pos, cycle...)
+	if !pos.IsDraw(1) {
+		t.Errorf("threefold repetition not scored as a draw")
+	}
+	if got := pos.Result(); got.Outcome != engine.Drawn || got.Termination != engine.ThreefoldRepetition {
+		t.Errorf("Result() = %v (%v), want 1/2-1/2 by threefold repetition", got, got.Termination)
+	}
+}
+
+func TestResult(t *testing.T) {
+	cases := []struct {
+		name        string
+		fen         string
+		outcome     engine.Outcome
+		termination engine.Termination
+		pgn         string
+	}{
+		{"start position", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", engine.Ongoing, engine.NotTerminated, "*"},
+		{"white mated", "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", engine.BlackWins, engine.Checkmate, "0-1"},
+		{"black mated", "R5k1/5ppp/8/8/8/8/8/6K1 b - - 1 1", engine.WhiteWins, engine.Checkmate, "1-0"},
+		{"stalemate", "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", engine.Drawn, engine.Stalemate, "1/2-1/2"},
+		{"fifty-move rule", "4k3/8/8/8/8/8/8/R3K3 b - - 100 80", engine.Drawn, engine.FiftyMoveRule, "1/2-1/2"},
+		{"insufficient material", "4k3/8/8/8/8/8/8/4KN2 b - - 0 1", engine.Drawn, engine.InsufficientMaterial, "1/2-1/2"},
+	}
+	for _, tc := range cases {
+		pos := engine.FromFEN(tc.fen)
+		got := pos.Result()
+		if got.Outcome != tc.outcome || got.Termination != tc.termination {
+			t.Errorf("%s: Result() = {%d %v}, want {%d %v}", tc.name, got.Outcome, got.Termination, tc.outcome, tc.termination)
+		}
+		if got.String() != tc.pgn {
+			t.Errorf("%s: Result().String() = %q, want %q", tc.name, got.String(), tc.pgn)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Evaluation traces: an evaluation broken down into where it comes from,
+// for the UCI `eval` command. A network's output can't be split into terms
+// the way a hand-crafted eval can, so each piece's share of it is measured
+// instead: the piece's features are taken out of both accumulators and the
+// network evaluated again, and the piece's contribution is how much the
+// output drops without it. The output bucket stays the full position's,
+// so the difference is the piece's features alone; and in a king-bucketed
+// layout a king keeps its side's orientation while it's taken out. The
+// contributions don't add up to the evaluation -- the network isn't linear
+// -- but they show what it makes of each piece.
+//
+// Every score in a trace is in centipawns from White's point of view, as
+// they're easier to read off a board that way.
+
+// EvalTrace is a position's evaluation, broken down.
+type EvalTrace struct {
+	FEN string `json:"fen"`
+
+	// NNUE is the network's evaluation (EvaluateNNUE's), and Pieces each
+	// piece's contribution to it
+	Network      string              `json:"network"`
+	OutputBucket int                 `json:"output_bucket"`
+	NNUE         int32               `json:"nnue"`
+	Pieces       []PieceTrace        `json:"pieces"`
+	Accumulators [2]AccumulatorStats `json:"accumulators"` // White's and Black's perspectives
+
+	// HCE is the hand-crafted evaluation (EvaluateHCE's), term by term
+	HCE HCETrace `json:"hce"`
+}
+
+// PieceTrace is one piece's contribution to the network's evaluation.
+type PieceTrace struct {
+	Square       string `json:"square"`
+	Piece        string `json:"piece"` // as in a FEN: uppercase for White
+	Contribution int32  `json:"contribution"`
+}
+
+// AccumulatorStats describes one perspective's accumulator, in the first
+// layer's quantized units (QA is 1.0): how many of its values the
+// activation passes through (Active, above 0) and how many it clips
+// (Saturated, at QA or above).
+type AccumulatorStats struct {
+	Perspective string  `json:"perspective"`
+	Size        int     `json:"size"`
+	Active      int     `json:"active"`
+	Saturated   int     `json:"saturated"`
+	Min         int16   `json:"min"`
+	Max         int16   `json:"max"`
+	Mean        float64 `json:"mean"`
+}
+
+// HCETrace is the hand-crafted evaluation's terms: material, and the
+// piece-square bonuses of each piece type, from the midgame or endgame
+// tables.
+type HCETrace struct {
+	Endgame bool       `json:"endgame"`
+	Terms   []EvalTerm `json:"terms"`
+	Total   int32      `json:"total"`
+}
+
+// EvalTerm is one term of the hand-crafted evaluation, as each side scores.
+type EvalTerm struct {
+	Name  string `json:"name"`
+	White int32  `json:"white"`
+	Black int32  `json:"black"`
+}
+
+// Total is the term from White's point of view.
+func (t EvalTerm) Total() int32 {
+	return t.White - t.Black
+}
+
+var pieceNames = [6]string{"pawns", "knights", "bishops", "rooks", "queens", "kings"}
+
+// TraceEval breaks down pos's evaluation.
+func TraceEval(pos *Position) EvalTrace {
+	net := pos.Net
+	acc := pos.Accumulator()
+	bucket := net.OutputBucket(pos)
+	// sign turns the side to move's scores to White's
+	sign := int32(1)
+	if pos.Turn == Black {
+		sign = -1
+	}
+	nnue := acc.Evaluate(net, pos.Turn, bucket)
+	trace := EvalTrace{
+		FEN:          pos.ToFEN(),
+		Network:      net.Describe(),
+		OutputBucket: bucket,
+		NNUE:         sign * nnue,
+		Pieces:       []PieceTrace{},
+		HCE:          traceHCE(pos),
+	}
+
+	without := NewAccumulator(net)
+	for sq := SquareA1; sq <= SquareH8; sq++ {
+		color, piece := pos.GetSquare(sq)
+		if piece == NoPiece {
+			continue
+		}
+		for perspective := White; perspective <= Black; perspective++ {
+			orientation := net.Layout.orientation(perspective, Lsb(pos.Pieces[perspective][King]))
+			f := net.Layout.feature(orientation, perspective, color, piece, sq)
+			copy(without.Values[perspective], acc.Values[perspective])
+			laneSubCol(lanes(without.Values[perspective]), lanes(net.featureCol(f)))
+		}
+		trace.Pieces = append(trace.Pieces, PieceTrace{
+			Square:       sq.ToString(),
+			Piece:        pieceString(color, piece),
+			Contribution: sign * (nnue - without.Evaluate(net, pos.Turn, bucket)),
+		})
+	}
+
+	for perspective := White; perspective <= Black; perspective++ {
+		trace.Accumulators[perspective] = accumulatorStats(acc.Values[perspective], net.QA)
+		trace.Accumulators[perspective].Perspective = [2]string{"white", "black"}[perspective]
+	}
+	return trace
+}
+
+func pieceString(color, piece uint8) string {
+	char := PieceToChar[piece]
+	if color == White {
+		char -= 32
+	}
+	return string(char)
+}
+
+func accumulatorStats(values []int16, qa int32) AccumulatorStats {
+	stats := AccumulatorStats{Size: len(values), Min: values[0], Max: values[0]}
+	var sum int64
+	for _, v := range values {
+		if v > 0 {
+			stats.Active++
+		}
+		if int32(v) >= qa {
+			stats.Saturated++
+		}
+		stats.Min, stats.Max = min(stats.Min, v), max(stats.Max, v)
+		sum += int64(v)
+	}
+	stats.Mean = float64(sum) / float64(len(values))
+	return stats
+}
+
+func traceHCE(pos *Position) HCETrace {
+	trace := HCETrace{Endgame: hceEndgame(pos)}
+	var pst [2][6]int32
+	var totals [2]int32
+	for color := White; color <= Black; color++ {
+		totals[color] = hceSide(pos, color, trace.Endgame, &pst[color])
+	}
+	trace.Terms = append(trace.Terms, EvalTerm{"material", pos.Material(White), pos.Material(Black)})
+	for piece := Pawn; piece <= King; piece++ {
+		trace.Terms = append(trace.Terms, EvalTerm{pieceNames[piece], pst[White][piece], pst[Black][piece]})
+	}
+	trace.Total = totals[White] - totals[Black]
+	return trace
+}
+
+// Write prints the trace as text: the board with each piece's contribution
+// under it, the accumulators, and the hand-crafted evaluation's terms.
+func (t *EvalTrace) Write(w io.Writer) {
+	contributions := make(map[string]PieceTrace, len(t.Pieces))
+	for _, p := range t.Pieces {
+		contributions[p.Square] = p
+	}
+	fmt.Fprintln(w, "NNUE piece contributions (centipawns, White's view):")
+	border := strings.Repeat("+-------", 8) + "+"
+	fmt.Fprintln(w, border)
+	for rank := Rank8; ; rank-- {
+		var pieces, values strings.Builder
+		for file := FileA; file <= FileH; file++ {
+			sq := NewSquare(rank, file).ToString()
+			p, ok := contributions[sq]
+			if !ok {
+				pieces.WriteString("|       ")
+				values.WriteString("|       ")
+				continue
+			}
+			fmt.Fprintf(&pieces, "|   %s   ", p.Piece)
+			fmt.Fprintf(&values, "|%6d ", p.Contribution)
+		}
+		fmt.Fprintln(w, pieces.String()+"|")
+		fmt.Fprintln(w, values.String()+"|")
+		fmt.Fprintln(w, border)
+		if rank == Rank1 {
+			break
+		}
+	}
+
+	fmt.Fprintf(w, "\nNetwork: %s\n", t.Network)
+	fmt.Fprintf(w, "Output bucket: %d\n", t.OutputBucket)
+	for _, acc := range t.Accumulators {
+		fmt.Fprintf(w, "Accumulator (%s): %d of %d active, %d saturated, min %d, max %d, mean %.1f\n",
+			acc.Perspective, acc.Active, acc.Size, acc.Saturated, acc.Min, acc.Max, acc.Mean)
+	}
+
+	phase := "midgame"
+	if t.HCE.Endgame {
+		phase = "endgame"
+	}
+	fmt.Fprintf(w, "\nHand-crafted evaluation (%s tables):\n", phase)
+	fmt.Fprintf(w, "%12s | %7s | %7s | %7s\n", "term", "white", "black", "total")
+	fmt.Fprintln(w, strings.Repeat("-", 13)+"+---------+---------+--------")
+	for _, term := range t.HCE.Terms {
+		fmt.Fprintf(w, "%12s | %7d | %7d | %7d\n", term.Name, term.White, term.Black, term.Total())
+	}
+	fmt.Fprintf(w, "%12s | %7s | %7s | %7d\n", "total", "", "", t.HCE.Total)
+
+	fmt.Fprintf(w, "\nNNUE evaluation: %d (White's view)\n", t.NNUE)
+	fmt.Fprintf(w, "HCE evaluation:  %d (White's view)\n", t.HCE.Total)
+}
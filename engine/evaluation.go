@@ -153,57 +153,46 @@ func (pos *Position) EndgameMaterial(color uint8) int32 {
 }
 
 func EvaluateHCE(pos *Position) int32 {
-	us := pos.Turn
-	them := pos.Turn ^ 1
-
-	ourMaterial := pos.Material(us)
-	theirMaterial := pos.Material(them)
-	ourEGMaterial := pos.EndgameMaterial(us)
-	theirEGMaterial := pos.EndgameMaterial(them)
-
-	isEndgame := (ourEGMaterial + theirEGMaterial) <= 1400
+	endgame := hceEndgame(pos)
+	return hceSide(pos, pos.Turn, endgame, nil) - hceSide(pos, pos.Turn^1, endgame, nil)
+}
 
-	eval := ourMaterial - theirMaterial
+// hceEndgame reports whether EvaluateHCE scores pos with the endgame
+// piece-square tables: whether there are 1400 centipawns or less of pieces
+// other than pawns and kings left.
+func hceEndgame(pos *Position) bool {
+	return pos.EndgameMaterial(White)+pos.EndgameMaterial(Black) <= 1400
+}
 
+// hceSide is one side's half of EvaluateHCE: its material plus its pieces'
+// piece-square bonuses. If pst isn't nil, the bonuses are also added to it
+// by piece type, for TraceEval.
+func hceSide(pos *Position, color uint8, endgame bool, pst *[6]int32) int32 {
+	eval := pos.Material(color)
 	for piece := Pawn; piece <= King; piece++ {
-		bb := pos.Pieces[us][piece]
+		bb := pos.Pieces[color][piece]
 		for bb != 0 {
 			sq := PopLsb(&bb)
 
-			if us == White {
+			if color == White {
 				sq = FlipSq[sq]
 			}
 
-			if isEndgame {
-				eval += PieceSqEndgame[piece][sq]
-			} else {
-				eval += PieceSqMidgame[piece][sq]
+			bonus := PieceSqMidgame[piece][sq]
+			if endgame {
+				bonus = PieceSqEndgame[piece][sq]
 			}
-		}
-	}
-
-	for piece := Pawn; piece <= King; piece++ {
-		bb := pos.Pieces[them][piece]
-		for bb != 0 {
-			sq := PopLsb(&bb)
-
-			if them == White {
-				sq = FlipSq[sq]
-			}
-
-			if isEndgame {
-				eval -= PieceSqEndgame[piece][sq]
-			} else {
-				eval -= PieceSqMidgame[piece][sq]
+			eval += bonus
+			if pst != nil {
+				pst[piece] += bonus
 			}
 		}
 	}
-
 	return eval
 }
 
 func EvaluateNNUE(pos *Position) int32 {
-	return int32(pos.Acc.Evaluate(pos.Net, pos.Turn) * 1000)
+	return pos.Accumulator().Evaluate(pos.Net, pos.Turn, pos.Net.OutputBucket(pos))
 }
 
 func Evaluate(pos *Position) int32 {
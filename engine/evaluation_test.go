@@ -1,6 +1,9 @@
 package engine_test
 
 import (
+	"encoding/json"
+	"math/bits"
+	"reflect"
 	"testing"
 
 	"silverfish/engine"
@@ -33,3 +36,66 @@ func TestEvaluateHCESideToMoveSymmetry(t *testing.T) {
 		}
 	}
 }
+
+// A trace has to agree with the evaluations it breaks down, and a piece's
+// contribution has to be what the network makes of the position without
+// it.
+func TestTraceEval(t *testing.T) {
+	for _, fen := range []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r1bqkbnr/pppp1ppp/2n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3",
+		"8/8/8/4k3/8/4K3/4P3/8 w - - 0 1",
+	} {
+		pos := engine.FromFEN(fen)
+		trace := engine.TraceEval(&pos)
+		sign := int32(1)
+		if pos.Turn == engine.Black {
+			sign = -1
+		}
+		if trace.NNUE != sign*engine.EvaluateNNUE(&pos) || trace.HCE.Total != sign*engine.EvaluateHCE(&pos) {
+			t.Errorf("%s: traced NNUE %d, HCE %d; evaluated %d, %d", fen,
+				trace.NNUE, trace.HCE.Total, sign*engine.EvaluateNNUE(&pos), sign*engine.EvaluateHCE(&pos))
+		}
+		var total int32
+		for _, term := range trace.HCE.Terms {
+			total += term.Total()
+		}
+		if total != trace.HCE.Total {
+			t.Errorf("%s: HCE terms add up to %d, total %d", fen, total, trace.HCE.Total)
+		}
+		if len(trace.Pieces) != bits.OnesCount64(uint64(pos.Blockers)) {
+			t.Errorf("%s: %d pieces traced", fen, len(trace.Pieces))
+		}
+		for _, acc := range trace.Accumulators {
+			if acc.Size != pos.Net.L1 || acc.Active > acc.Size || acc.Min > acc.Max {
+				t.Errorf("%s: accumulator stats %+v", fen, acc)
+			}
+		}
+
+		encoded, err := json.Marshal(&trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded engine.EvalTrace
+		if err := json.Unmarshal(encoded, &decoded); err != nil || !reflect.DeepEqual(decoded, trace) {
+			t.Errorf("%s: JSON round trip: %v\n%s", fen, err, encoded)
+		}
+	}
+
+	// the starting position without White's queen (the embedded network
+	// has one output bucket, so nothing else changes)
+	pos := engine.StartingPosition()
+	trace := engine.TraceEval(&pos)
+	without := engine.FromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNB1KBNR w KQkq - 0 1")
+	for _, p := range trace.Pieces {
+		if p.Square != "d1" {
+			continue
+		}
+		if p.Piece != "Q" || p.Contribution != trace.NNUE-engine.EvaluateNNUE(&without) {
+			t.Errorf("d1: %s contributes %d, want %d", p.Piece, p.Contribution, trace.NNUE-engine.EvaluateNNUE(&without))
+		}
+		if p.Contribution <= 0 {
+			t.Errorf("White's queen contributes %d", p.Contribution)
+		}
+	}
+}
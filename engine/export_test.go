@@ -0,0 +1,78 @@
+package engine
+
+// Hooks into unexported parts of the engine for its tests, which are all
+// in engine_test.
+
+// Hooks into the history tables, for ordering_test.go.
+
+func ApplyGravity16(entry *int16, bonus int32) { applyGravity(entry, bonus) }
+func ApplyGravity32(entry *int32, bonus int32) { applyGravity(entry, bonus) }
+
+var HistoryBonus = historyBonus
+
+// PlayMove plays move at ply as the search would, recording it for the
+// continuation histories of the plies below.
+func (search *Search) PlayMove(move Move, ply int) {
+	search.pushMove(move, ply)
+	search.Pos.DoMove(move)
+}
+
+func (search *Search) UpdateCutoffHistories(best Move, quietsTried, capturesTried []Move, depth, ply int) {
+	search.updateCutoffHistories(best, quietsTried, capturesTried, depth, ply)
+}
+
+// HistoryEntries returns a quiet move's butterfly and two continuation
+// history entries at ply.
+func (search *Search) HistoryEntries(move Move, ply int) (butterfly, cont1, cont2 int32) {
+	prev1, prev2 := search.previousMoves(ply)
+	color, piece := search.Pos.GetSquare(move.From())
+	p := coloredPiece(color, piece)
+	return search.history[color][move.From()][move.To()],
+		int32(search.contHist[0][prev1.piece][prev1.to][p][move.To()]),
+		int32(search.contHist[1][prev2.piece][prev2.to][p][move.To()])
+}
+
+// CaptureHistory returns a capture's capture history entry.
+func (search *Search) CaptureHistory(move Move) int32 {
+	color, piece := search.Pos.GetSquare(move.From())
+	return int32(search.captureHist[coloredPiece(color, piece)][move.To()][captureVictim(&search.Pos, move)])
+}
+
+// OrderedMoves returns the legal moves at ply in the order the search
+// would try them, before any TT move.
+func (search *Search) OrderedMoves(ply int) []Move {
+	moveList := GenMoves(&search.Pos, BB_Full)
+	search.scoreMoves(&moveList, ply)
+	OrderMoves(&search.Pos, &moveList)
+	var moves []Move
+	for _, move := range moveList.Moves[:moveList.Count] {
+		if search.Pos.MoveIsLegal(move) {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// Hooks into the search's forward-pruning decisions, for search_test.go.
+
+const NoEval = noEval
+
+var IsImproving = isImproving
+
+// Hooks into correction history, for correction_test.go.
+
+func (search *Search) UpdateCorrectionHistory(bestMove Move, rawEval, staticEval, bestScore int32, bound uint8, depth int) {
+	search.updateCorrectionHistory(bestMove, rawEval, staticEval, bestScore, bound, depth)
+}
+
+func (search *Search) CorrectedEval(rawEval int32) int32 { return search.correctedEval(rawEval) }
+
+// Hooks into late move reductions, for search_test.go.
+
+var LMRBaseReduction = lmrBaseReduction
+
+var IsQuietMove = isQuietMove
+
+// Hooks into the TT as the search uses it, for search_test.go.
+
+func (search *Search) TTKey() uint64 { return search.ttKey() }
@@ -76,7 +76,7 @@ func (pos *Position) ToFEN() string {
 	return fen
 }
 
-// note: full refresh automatically on creation
+// note: the accumulators are built from the board on the first evaluation
 func FromFEN(fen string) Position {
 	var pos Position
 
@@ -84,9 +84,7 @@ func FromFEN(fen string) Position {
 		panic("engine.Init() must be called before engine.FromFEN()")
 	}
 	pos.Net = defaultNet
-	pos.Acc = NewAccumulator(pos.Net)
-	// install input bias before any Add/Remove
-	pos.Acc.Reset(pos.Net)
+	pos.Accs = NewAccumulatorStack()
 
 	parts := strings.Split(fen, " ")
 	if len(parts) < 6 {
@@ -182,6 +180,8 @@ func FromFEN(fen string) Position {
 	}
 	pos.Ply = uint16((fullmove-1)*2 + int(pos.Turn))
 	pos.Hash = Hash(&pos)
+	pos.PawnHash = PawnHash(&pos)
+	pos.MaterialKey = MaterialKey(&pos)
 
 	return pos
 }
@@ -4,14 +4,25 @@ import (
 	"math/rand"
 )
 
-var Rng *rand.Rand = rand.New(rand.NewSource(123))
+// RngSeed seeds Rng, so everything derived from it (magics, Zobrist keys)
+// is the same on every run.
+const RngSeed = 123
+
+var Rng *rand.Rand = rand.New(rand.NewSource(RngSeed))
+
+// ResetRng rewinds Rng to its initial seed, so whatever draws from it next
+// sees the same sequence as on a fresh start (see Deterministic).
+func ResetRng() {
+	Rng.Seed(RngSeed)
+}
 
 var defaultNet *Network
 
 func Init() {
 	InitBitboard()
 	InitZobrist()
-	allocTT(TTSizeMB)
+	sharedTT.alloc(TTSizeMB)
+	InitLMRTable()
 	if err := LoadDefaultNetwork(""); err != nil {
 		panic("engine: failed to load default NNUE network: " + err.Error())
 	}
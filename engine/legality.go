@@ -140,6 +140,9 @@ func (pos *Position) Checkers(color uint8) Bitboard {
 // two plies at a time. The scan is bounded by Rule50: a capture or pawn
 // move is irreversible, so nothing before the most recent one can be equal
 // to the current position.
+//
+// The search itself uses IsDraw, which only applies this first-repetition
+// rule inside the search tree.
 func (pos *Position) IsRepetition() bool {
 	n := len(pos.History)
 	limit := int(pos.Rule50)
@@ -18,3 +18,41 @@ func TestGiveScore(t *testing.T) {
 		t.Errorf(`TestGiveScore: "To": expected %d, got %d`, move1.To(), move2.To())
 	}
 }
+
+func TestParseSAN(t *testing.T) {
+	for _, tc := range []struct {
+		fen, san, want string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "Nf3", "g1f3"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e4", "e2e4"},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", "exd5", "e4d5"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "O-O", "e1g1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "O-O-O", "e8c8"},
+		{"3k4/8/8/8/8/8/4K3/R6R w - - 0 1", "Rad1", "a1d1"},
+		{"4k3/8/8/8/8/8/8/R3K2R w - - 0 1", "Rhf1+", "h1f1"},
+		{"4k3/8/8/R7/8/8/8/R3K3 w - - 0 1", "R1a3", "a1a3"},
+		{"4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b8=Q+", "b7b8q"},
+		{"4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b8N", "b7b8n"},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "exf6", "e5f6"},
+	} {
+		pos := engine.FromFEN(tc.fen)
+		move, err := pos.ParseSAN(tc.san)
+		if err != nil {
+			t.Errorf("%s: %s: %v", tc.fen, tc.san, err)
+		} else if move.ToString() != tc.want {
+			t.Errorf("%s: %s parsed as %s, want %s", tc.fen, tc.san, move.ToString(), tc.want)
+		}
+	}
+
+	for _, tc := range []struct{ fen, san string }{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "e5"},  // illegal
+		{"3k4/8/8/8/8/8/4K3/R6R w - - 0 1", "Rd1"},                          // ambiguous
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "Zf3"}, // invalid
+		{"4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b8"},                           // no promotion piece
+	} {
+		pos := engine.FromFEN(tc.fen)
+		if move, err := pos.ParseSAN(tc.san); err == nil {
+			t.Errorf("%s: %s parsed as %s, want an error", tc.fen, tc.san, move.ToString())
+		}
+	}
+}
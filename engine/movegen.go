@@ -147,3 +147,162 @@ func GenCastlingMoves(pos *Position, moves *MoveList) {
 func GetKingMoves(square Square) Bitboard {
 	return KingMoves[square]
 }
+
+// GenQuiescenceMoves generates the moves Quiescence searches when not in
+// check: every capture, plus non-capturing promotions, plus -- if
+// withChecks -- every quiet move that gives check (see GenQuietChecks).
+// Promotions are pruned to the ones that can matter: always the queen, a
+// knight only when it gives check (the knight's checking fork is the one
+// underpromotion a queen can't replicate), and never a rook or bishop
+// (whatever they attack, a queen on the same square attacks too).
+func GenQuiescenceMoves(pos *Position, withChecks bool) MoveList {
+	us := pos.Turn
+	them := us ^ 1
+	theirKing := Lsb(pos.Pieces[them][King])
+
+	// Captures, including capturing promotions.
+	captures := GenMoves(pos, pos.Sides[them])
+
+	var moves MoveList
+	for i := uint8(0); i < captures.Count; i++ {
+		move := captures.Moves[i]
+		if move.IsPromotion() && !promotionMatters(move, theirKing) {
+			continue
+		}
+		moves.Add(move)
+	}
+
+	// Non-capturing promotions: pushes from the 7th rank onto an empty
+	// square.
+	promoters := pos.Pieces[us][Pawn]
+	if us == White {
+		promoters &= BB_Rank8 >> 8
+	} else {
+		promoters &= BB_Rank1 << 8
+	}
+	for promoters != 0 {
+		from := PopLsb(&promoters)
+		to := Square(int(from) + PawnDisplacement(us))
+		if pos.Blockers&(1<<to) != 0 {
+			continue
+		}
+		for piece := Knight; piece <= Queen; piece++ {
+			move := NewPromotionMove(from, to, piece)
+			if promotionMatters(move, theirKing) {
+				moves.Add(move)
+			}
+		}
+	}
+
+	if withChecks {
+		checks := GenQuietChecks(pos)
+		for i := uint8(0); i < checks.Count; i++ {
+			moves.Add(checks.Moves[i])
+		}
+	}
+
+	return moves
+}
+
+// promotionMatters reports whether a promotion is worth searching in
+// quiescence: queen promotions always, knight promotions that check the
+// king on theirKing, nothing else.
+func promotionMatters(move Move, theirKing Square) bool {
+	switch move.Promotion() {
+	case Queen:
+		return true
+	case Knight:
+		return KnightMoves[move.To()]&(1<<theirKing) != 0
+	}
+	return false
+}
+
+// GenQuietChecks generates every quiet move -- not a capture, promotion or
+// castling move -- that gives check, directly or by discovery. Like
+// GenMoves the result is pseudo-legal: it may include moves that leave our
+// own king in check.
+//
+// A direct check is a move to a square from which the moving piece
+// attacks the king; those squares are found by looking outward from the
+// king (a knight checks from a knight-move away, a bishop from the king's
+// own diagonals, and so on). A discovered check is a move by a piece that
+// was the only thing blocking one of our sliders from the king, off the
+// line between them.
+func GenQuietChecks(pos *Position) MoveList {
+	var moves MoveList
+
+	us := pos.Turn
+	them := us ^ 1
+	kingSq := Lsb(pos.Pieces[them][King])
+	empty := ^pos.Blockers
+
+	diagonal := GetBishopMoves(kingSq, pos.Blockers)
+	orthogonal := GetRookMoves(kingSq, pos.Blockers)
+	checkSquares := [6]Bitboard{
+		Pawn:   PawnCaptures[them][kingSq],
+		Knight: KnightMoves[kingSq],
+		Bishop: diagonal,
+		Rook:   orthogonal,
+		Queen:  diagonal | orthogonal,
+	}
+
+	diagonalSliders := pos.Pieces[us][Bishop] | pos.Pieces[us][Queen]
+	orthogonalSliders := pos.Pieces[us][Rook] | pos.Pieces[us][Queen]
+
+	// discovers reports whether moving the piece on from to to uncovers a
+	// check by one of our sliders.
+	discovers := func(from, to Square) bool {
+		blockers := pos.Blockers&^(1<<from) | 1<<to
+		return GetBishopMoves(kingSq, blockers)&diagonalSliders != 0 ||
+			GetRookMoves(kingSq, blockers)&orthogonalSliders != 0
+	}
+
+	// Only our pieces directly in line with the king (the first piece
+	// along each of its rays) can possibly be discovering a check.
+	candidates := (diagonal | orthogonal) & pos.Sides[us]
+
+	for piece := Knight; piece <= King; piece++ {
+		pieceBB := pos.Pieces[us][piece]
+		for pieceBB != 0 {
+			from := PopLsb(&pieceBB)
+			movesBB := GetPieceMoves(piece, from, pos.Blockers, us) & empty
+			if candidates&(1<<from) == 0 {
+				movesBB &= checkSquares[piece]
+			}
+			for movesBB != 0 {
+				to := PopLsb(&movesBB)
+				if checkSquares[piece]&(1<<to) != 0 || discovers(from, to) {
+					moves.Add(NewMove(from, to))
+				}
+			}
+		}
+	}
+
+	// Pawn pushes (single and double), excluding pushes onto the last rank
+	// -- those are promotions, generated by GenQuiescenceMoves.
+	pawns := pos.Pieces[us][Pawn]
+	push := PawnDisplacement(us)
+	for pawns != 0 {
+		from := PopLsb(&pawns)
+		if RankOf(from) == PawnPromotionRank(us) {
+			continue
+		}
+		to := Square(int(from) + push)
+		if empty&(1<<to) == 0 {
+			continue
+		}
+		isCandidate := candidates&(1<<from) != 0
+		if checkSquares[Pawn]&(1<<to) != 0 || (isCandidate && discovers(from, to)) {
+			moves.Add(NewMove(from, to))
+		}
+		if RankOf(from) == PawnStartingRank(us) {
+			to2 := Square(int(to) + push)
+			if empty&(1<<to2) != 0 &&
+				(checkSquares[Pawn]&(1<<to2) != 0 || (isCandidate && discovers(from, to2))) {
+				moves.Add(NewMove(from, to2))
+			}
+		}
+	}
+
+	return moves
+}
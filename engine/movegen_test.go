@@ -391,3 +391,92 @@ func TestCastlingMoves(t *testing.T) {
 		fmt.Println()
 	}
 }
+
+// quietChecksOracle brute-forces GenQuietChecks: every pseudo-legal move
+// that isn't a capture, promotion or castling move, played out and kept if
+// it leaves the opponent in check.
+func quietChecksOracle(pos *engine.Position) map[string]bool {
+	want := map[string]bool{}
+	moves := engine.GenMoves(pos, engine.BB_Full)
+	them := pos.Turn ^ 1
+	for i := uint8(0); i < moves.Count; i++ {
+		move := moves.Moves[i]
+		if move.IsPromotion() || move.IsCastling() || move.IsEnPassant() || pos.Blockers&(1<<move.To()) != 0 {
+			continue
+		}
+		pos.DoMove(move)
+		if pos.Checkers(them) != 0 {
+			want[move.ToString()] = true
+		}
+		pos.UndoMove(move)
+	}
+	return want
+}
+
+func TestGenQuietChecks(t *testing.T) {
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+		// Discovered checks: by a knight, a king, and a pawn push off
+		// the rook's file and the bishop's diagonal.
+		"4k3/8/8/4N3/8/8/8/4R1K1 w - - 0 1",
+		"4k3/8/8/8/8/8/4K3/4R3 w - - 0 1",
+		"7k/8/8/8/8/2P5/1B6/6K1 w - - 0 1",
+		// Pawn pushes giving check, single and double.
+		"8/8/8/8/2k5/8/1P1P4/4K3 w - - 0 1",
+		"4k3/1p1p4/8/8/2K5/8/8/8 b - - 0 1",
+	}
+	for _, fen := range fens {
+		pos := engine.FromFEN(fen)
+		want := quietChecksOracle(&pos)
+
+		got := map[string]bool{}
+		checks := engine.GenQuietChecks(&pos)
+		for i := uint8(0); i < checks.Count; i++ {
+			move := checks.Moves[i].ToString()
+			if got[move] {
+				t.Errorf("%s: %s generated twice", fen, move)
+			}
+			got[move] = true
+		}
+
+		for move := range want {
+			if !got[move] {
+				t.Errorf("%s: missing quiet check %s", fen, move)
+			}
+		}
+		for move := range got {
+			if !want[move] {
+				t.Errorf("%s: %s is not a quiet check", fen, move)
+			}
+		}
+	}
+}
+
+func TestGenQuiescenceMovesPromotions(t *testing.T) {
+	// The pawn can push to b8 or capture on a8/c8; only the queen
+	// promotions, plus the knight push to b8 (which checks the king on
+	// d7), should be generated.
+	pos := engine.FromFEN("n1n5/1P1k4/8/8/8/8/8/4K3 w - - 0 1")
+	moves := engine.GenQuiescenceMoves(&pos, false)
+
+	got := map[string]bool{}
+	for i := uint8(0); i < moves.Count; i++ {
+		got[moves.Moves[i].ToString()] = true
+	}
+	want := map[string]bool{"b7a8q": true, "b7c8q": true, "b7b8q": true, "b7b8n": true}
+	for move := range want {
+		if !got[move] {
+			t.Errorf("missing %s", move)
+		}
+	}
+	for move := range got {
+		if !want[move] {
+			t.Errorf("unexpected %s", move)
+		}
+	}
+}
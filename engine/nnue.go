@@ -6,48 +6,95 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
+	"path"
 )
 
+// Float network files start with Magic and a version. Version 1 is the
+// (768->L1)x2->1 architecture with the plain input layout, and version 2
+// adds the input layout (see nnue_layout.go) after the layer sizes;
+// version 3 files describe their architecture (see nnue_arch.go), and
+// version 4 ones add metadata and a checksum (see nnue_meta.go).
 const (
 	Magic   = "NNUE"
-	Version = 1
+	Version = 4
 )
 
 // Network holds NNUE weights loaded from a file. It is immutable once
 // loaded and safe to share across Positions; per-position evaluation state
 // lives in Accumulator instead.
+//
+// Evaluation always runs on the quantized (integer) parameters -- see
+// nnue_quant.go. The float parameters are only kept when the network was
+// loaded from a float file, as the reference the quantized network is
+// checked against (EvaluateFloat).
 type Network struct {
+	// where the network came from: its file's metadata (or defaults, for
+	// files without any), format version and CRC-32, and the file it was
+	// loaded from
+	Info        NetworkInfo
+	FileVersion int
+	Checksum    uint32
+	Source      string
+
 	NumInputs int
 	L1        int
 
-	WInput  []float32 // [L1 * NumInputs]
-	BInput  []float32 // [L1]
-	WOutput []float32 // [2 * L1]
-	BOutput float32
-
-	// FeatureCols is WInput transposed into per-feature columns, laid out
-	// as one flat contiguous slice ([NumInputs * L1]) rather than a slice
-	// of slices, so column access avoids an extra pointer indirection and
-	// keeps neighboring columns cache-adjacent.
-	FeatureCols []float32
+	// Layout maps pieces to the NumInputs first-layer features.
+	Layout InputLayout
+
+	// OutputBuckets is the number of sets of weights for the layers after
+	// the accumulator (see OutputBucket); 1 for an unbucketed network.
+	OutputBuckets int
+
+	// Layers are the layers after the accumulator for a network with
+	// hidden layers, ending in the output layer (see nnue_arch.go); nil for
+	// the single-output architecture, which uses WOutput/QOutput instead.
+	Layers []DenseLayer
+
+	// float parameters, as trained (nil for a network loaded from a
+	// quantized file)
+	FloatActivation Activation // the first layer's, as trained
+	WInput          []float32  // [L1 * NumInputs]
+	BInput          []float32  // [L1]
+	WOutput         []float32  // [bucket][2 * L1]
+	BOutput         []float32  // [bucket]
+
+	// quantized parameters: the first layer scaled by QA, the output layer
+	// by QB (see nnue_quant.go)
+	Activation  Activation
+	QA, QB      int32
+	QBias       []int16 // [L1]
+	QOutput     []int16 // [bucket][2 * L1]
+	QOutputBias []int32 // [bucket], scaled by QA*QB
+
+	// FeatureCols is the quantized first layer as per-feature columns, laid
+	// out as one flat contiguous slice ([NumInputs * L1]) rather than a
+	// slice of slices, so column access avoids an extra pointer indirection
+	// and keeps neighboring columns cache-adjacent.
+	FeatureCols []int16
 }
 
 // featureCol returns the L1-length column of weights for feature f.
-func (net *Network) featureCol(f uint16) []float32 {
+func (net *Network) featureCol(f uint16) []int16 {
 	start := int(f) * net.L1
 	return net.FeatureCols[start : start+net.L1]
 }
 
 // Accumulator is the mutable per-position NNUE evaluation state: one
-// running sum of active feature columns per perspective.
+// running sum of active feature columns per perspective, in the first
+// layer's quantized units. Integer sums are exact, so unlike float ones
+// they don't depend on the order features were added and removed in.
+//
+// Positions don't update an Accumulator directly: each keeps one per ply
+// in its AccumulatorStack, and Position.Accumulator brings the current one
+// up to date when it's needed.
 type Accumulator struct {
-	Values [2][]float32
+	Values [2][]int16
 }
 
-// TODO: Accumulator stack
-
 // for black's perspective, the board is flipped for evaluation purposes
 // this way the first layer parameters only has to "learn" how to play one perspective, which helps with generalization (?)
 func FeatureIndex(perspective uint8, pieceColor uint8, pieceType uint8, sq Square) uint16 {
@@ -69,7 +116,12 @@ func LoadNNUEFile(path string) (*Network, error) {
 		return nil, err
 	}
 	defer f.Close()
-	return loadNNUEFromReader(bufio.NewReader(f))
+	net, err := loadNNUEFromReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	net.Source = path
+	return net, nil
 }
 
 // LoadEmbeddedNNUE loads the default network built into the binary.
@@ -78,7 +130,12 @@ func LoadEmbeddedNNUE() (*Network, error) {
 	if err != nil {
 		return nil, err
 	}
-	return loadNNUEFromReader(bytes.NewReader(data))
+	net, err := loadNNUEFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	net.Source = "embedded " + path.Base(defaultNNUEName)
+	return net, nil
 }
 
 // LoadNNUE loads the network at path, or the embedded default if path is empty.
@@ -90,296 +147,201 @@ func LoadNNUE(path string) (*Network, error) {
 }
 
 func loadNNUEFromReader(f io.Reader) (*Network, error) {
+	// everything up to a version 4 file's checksum is checksummed
+	crc := crc32.NewIEEE()
+	r := io.TeeReader(f, crc)
+
 	// header
 	magic := make([]byte, 4)
-	if _, err := io.ReadFull(f, magic); err != nil {
+	if _, err := io.ReadFull(r, magic); err != nil {
 		return nil, err
 	}
-	if string(magic) != Magic {
+	var net *Network
+	var err error
+	switch string(magic) {
+	case Magic:
+		net, err = loadFloatNNUE(r)
+	case QuantizedMagic:
+		net, err = loadQuantizedNNUE(r)
+	default:
 		return nil, errors.New("invalid NNUE magic")
 	}
-
-	var version uint32
-	if err := binary.Read(f, binary.LittleEndian, &version); err != nil {
-		return nil, err
-	}
-	if version != Version {
-		return nil, fmt.Errorf("unsupported NNUE version %d", version)
-	}
-
-	// read as uint32 since python wrote 32 bit ints
-	var numInputs32, l132 uint32
-	if err := binary.Read(f, binary.LittleEndian, &numInputs32); err != nil {
+	if err != nil {
 		return nil, err
 	}
-	if err := binary.Read(f, binary.LittleEndian, &l132); err != nil {
+	if err := net.finishLoad(f, crc); err != nil {
 		return nil, err
 	}
+	return net, nil
+}
 
-	numInputs := int(numInputs32)
-	l1 := int(l132)
-
-	// the accumulator update loops are unrolled in steps of 16
-	if numInputs <= 0 {
-		return nil, fmt.Errorf("invalid NNUE header: numInputs must be positive, got %d", numInputs)
-	}
-	if l1 <= 0 || l1%16 != 0 {
-		return nil, fmt.Errorf("invalid NNUE header: L1 must be a positive multiple of 16, got %d", l1)
+// loadFloatNNUE reads the rest of a float network file, after its magic.
+func loadFloatNNUE(f io.Reader) (*Network, error) {
+	var version uint32
+	if err := binary.Read(f, binary.LittleEndian, &version); err != nil {
+		return nil, err
 	}
-
-	net := &Network{
-		NumInputs: numInputs,
-		L1:        l1,
+	info := NetworkInfo{Scale: OutputScale}
+	var arch netArch
+	switch version {
+	case 1, 2:
+		// read as uint32 since python wrote 32 bit ints
+		sizes := make([]uint32, 2)
+		if err := binary.Read(f, binary.LittleEndian, sizes); err != nil {
+			return nil, err
+		}
+		arch = netArch{
+			sizes:         []int{int(sizes[0]), int(sizes[1]), 1},
+			activations:   []Activation{ActivationReLU},
+			outputBuckets: 1,
+		}
+		if version == 2 {
+			var err error
+			if arch.layout, err = readLayout(f); err != nil {
+				return nil, err
+			}
+		}
+		if err := arch.validate(); err != nil {
+			return nil, err
+		}
+	case 3, Version:
+		var err error
+		if version >= metadataVersion {
+			if info, err = readMetadata(f); err != nil {
+				return nil, err
+			}
+		}
+		if arch, err = readArch(f); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported NNUE version %d", version)
 	}
 
 	// read network parameters
-	net.WInput = make([]float32, l1*numInputs)
-	net.BInput = make([]float32, l1)
-	net.WOutput = make([]float32, 2*l1)
-
-	if err := binary.Read(f, binary.LittleEndian, &net.WInput); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(f, binary.LittleEndian, &net.BInput); err != nil {
-		return nil, err
+	net := arch.newNetwork()
+	net.Info = info
+	net.FileVersion = int(version)
+	net.WInput = make([]float32, net.L1*net.NumInputs)
+	net.BInput = make([]float32, net.L1)
+	for _, data := range [][]float32{net.WInput, net.BInput} {
+		if err := binary.Read(f, binary.LittleEndian, data); err != nil {
+			return nil, err
+		}
 	}
-	if err := binary.Read(f, binary.LittleEndian, &net.WOutput); err != nil {
-		return nil, err
+	if len(net.Layers) > 0 {
+		if err := net.readLayers(f); err != nil {
+			return nil, err
+		}
+	} else {
+		net.WOutput = make([]float32, net.OutputBuckets*2*net.L1)
+		net.BOutput = make([]float32, net.OutputBuckets)
+		for _, data := range [][]float32{net.WOutput, net.BOutput} {
+			if err := binary.Read(f, binary.LittleEndian, data); err != nil {
+				return nil, err
+			}
+		}
 	}
-	if err := binary.Read(f, binary.LittleEndian, &net.BOutput); err != nil {
+
+	if err := net.quantize(quantizedActivation(net.FloatActivation), DefaultQA, DefaultQB); err != nil {
 		return nil, err
 	}
-
-	// build helper representation of first layer's weights
-	net.buildFeatureCols()
-
 	return net, nil
 }
 
-func (net *Network) buildFeatureCols() {
-	numInputs := net.NumInputs
-	l1 := net.L1
-	flat := make([]float32, numInputs*l1)
-	for f := 0; f < numInputs; f++ {
-		for o := 0; o < l1; o++ {
-			flat[f*l1+o] = net.WInput[o*numInputs+f]
-		}
-	}
-	net.FeatureCols = flat
-}
-
 // NewAccumulator allocates a zeroed accumulator sized for net.
 func NewAccumulator(net *Network) Accumulator {
 	return Accumulator{
-		Values: [2][]float32{
-			make([]float32, net.L1),
-			make([]float32, net.L1),
+		Values: [2][]int16{
+			make([]int16, net.L1),
+			make([]int16, net.L1),
 		},
 	}
 }
 
-// Clone returns a deep copy, safe to mutate independently of the original.
-func (acc Accumulator) Clone() Accumulator {
-	if acc.Values[White] == nil && acc.Values[Black] == nil {
-		return Accumulator{}
-	}
-	clone := Accumulator{
-		Values: [2][]float32{
-			make([]float32, len(acc.Values[White])),
-			make([]float32, len(acc.Values[Black])),
-		},
-	}
-	copy(clone.Values[White], acc.Values[White])
-	copy(clone.Values[Black], acc.Values[Black])
-	return clone
-}
-
-// Reset installs net's input bias into both perspectives, discarding any
-// active features. This must be done before the first Add/Remove call --
-// Add/Remove alone never add bias.
-func (acc *Accumulator) Reset(net *Network) {
-	copy(acc.Values[White], net.BInput)
-	copy(acc.Values[Black], net.BInput)
-}
-
 // Refresh overwrites one perspective with net's bias plus the given active features.
 func (acc *Accumulator) Refresh(net *Network, features []uint16, perspective uint8) {
-	a := acc.Values[perspective]
-	copy(a, net.BInput)
+	copy(acc.Values[perspective], net.QBias)
+	a := lanes(acc.Values[perspective])
 	for _, f := range features {
-		col := net.featureCol(f)
-		for o := 0; o < len(a); o += 16 {
-			a[o] += col[o]
-			a[o+1] += col[o+1]
-			a[o+2] += col[o+2]
-			a[o+3] += col[o+3]
-			a[o+4] += col[o+4]
-			a[o+5] += col[o+5]
-			a[o+6] += col[o+6]
-			a[o+7] += col[o+7]
-			a[o+8] += col[o+8]
-			a[o+9] += col[o+9]
-			a[o+10] += col[o+10]
-			a[o+11] += col[o+11]
-			a[o+12] += col[o+12]
-			a[o+13] += col[o+13]
-			a[o+14] += col[o+14]
-			a[o+15] += col[o+15]
-		}
+		laneAddCol(a, lanes(net.featureCol(f)))
 	}
 }
 
-// RefreshAll overwrites both perspectives with net's bias plus their active features.
-func (acc *Accumulator) RefreshAll(net *Network, featuresW, featuresB []uint16) {
-	acc.Refresh(net, featuresW, White)
-	acc.Refresh(net, featuresB, Black)
-}
-
-// Add incrementally adds a feature. NOTE: only using Add() is incorrect
-// since no bias is added -- Reset() (or RefreshAll) must run first.
-func (acc *Accumulator) Add(net *Network, feature uint16, perspective uint8) {
-	col := net.featureCol(feature)
-	a := acc.Values[perspective]
-	for o := 0; o < len(a); o += 16 {
-		a[o] += col[o]
-		a[o+1] += col[o+1]
-		a[o+2] += col[o+2]
-		a[o+3] += col[o+3]
-		a[o+4] += col[o+4]
-		a[o+5] += col[o+5]
-		a[o+6] += col[o+6]
-		a[o+7] += col[o+7]
-		a[o+8] += col[o+8]
-		a[o+9] += col[o+9]
-		a[o+10] += col[o+10]
-		a[o+11] += col[o+11]
-		a[o+12] += col[o+12]
-		a[o+13] += col[o+13]
-		a[o+14] += col[o+14]
-		a[o+15] += col[o+15]
-	}
-}
-
-// Remove incrementally removes a feature.
-func (acc *Accumulator) Remove(net *Network, feature uint16, perspective uint8) {
-	col := net.featureCol(feature)
-	a := acc.Values[perspective]
-	for o := 0; o < len(a); o += 16 {
-		a[o] -= col[o]
-		a[o+1] -= col[o+1]
-		a[o+2] -= col[o+2]
-		a[o+3] -= col[o+3]
-		a[o+4] -= col[o+4]
-		a[o+5] -= col[o+5]
-		a[o+6] -= col[o+6]
-		a[o+7] -= col[o+7]
-		a[o+8] -= col[o+8]
-		a[o+9] -= col[o+9]
-		a[o+10] -= col[o+10]
-		a[o+11] -= col[o+11]
-		a[o+12] -= col[o+12]
-		a[o+13] -= col[o+13]
-		a[o+14] -= col[o+14]
-		a[o+15] -= col[o+15]
+// The incremental updates below read the parent ply's accumulator (src)
+// and write this ply's (acc) in the same pass, so copying the parent and
+// applying the move cost one trip through memory rather than two. acc and
+// src may be the same accumulator.
+
+// AddSub sets one perspective of acc to src's plus one added and minus one
+// removed feature: a piece relocating (quiet move) or a pawn turning into
+// another piece on the back rank.
+func (acc *Accumulator) AddSub(net *Network, src *Accumulator, addFeature, subFeature uint16, perspective uint8) {
+	addCol := lanes(net.featureCol(addFeature))
+	subCol := lanes(net.featureCol(subFeature))
+	s := lanes(src.Values[perspective])
+	a := lanes(acc.Values[perspective])
+	for o := 0; o < len(a); o += 4 {
+		a[o] = laneSub(laneAdd(s[o], addCol[o]), subCol[o])
+		a[o+1] = laneSub(laneAdd(s[o+1], addCol[o+1]), subCol[o+1])
+		a[o+2] = laneSub(laneAdd(s[o+2], addCol[o+2]), subCol[o+2])
+		a[o+3] = laneSub(laneAdd(s[o+3], addCol[o+3]), subCol[o+3])
 	}
 }
 
-// AddSub applies one added feature and one removed feature in a single pass,
-// halving the memory traffic of a separate Add+Remove for the common case of
-// relocating a piece (quiet move) from one square to another.
-func (acc *Accumulator) AddSub(net *Network, addFeature, subFeature uint16, perspective uint8) {
-	addCol := net.featureCol(addFeature)
-	subCol := net.featureCol(subFeature)
-	a := acc.Values[perspective]
-	for o := 0; o < len(a); o += 16 {
-		a[o] += addCol[o] - subCol[o]
-		a[o+1] += addCol[o+1] - subCol[o+1]
-		a[o+2] += addCol[o+2] - subCol[o+2]
-		a[o+3] += addCol[o+3] - subCol[o+3]
-		a[o+4] += addCol[o+4] - subCol[o+4]
-		a[o+5] += addCol[o+5] - subCol[o+5]
-		a[o+6] += addCol[o+6] - subCol[o+6]
-		a[o+7] += addCol[o+7] - subCol[o+7]
-		a[o+8] += addCol[o+8] - subCol[o+8]
-		a[o+9] += addCol[o+9] - subCol[o+9]
-		a[o+10] += addCol[o+10] - subCol[o+10]
-		a[o+11] += addCol[o+11] - subCol[o+11]
-		a[o+12] += addCol[o+12] - subCol[o+12]
-		a[o+13] += addCol[o+13] - subCol[o+13]
-		a[o+14] += addCol[o+14] - subCol[o+14]
-		a[o+15] += addCol[o+15] - subCol[o+15]
+// AddSubSub is AddSub with a second removed feature -- used for captures,
+// where the mover relocates (add at `to`, sub at `from`) and the captured
+// piece disappears.
+func (acc *Accumulator) AddSubSub(net *Network, src *Accumulator, addFeature, subFeature1, subFeature2 uint16, perspective uint8) {
+	addCol := lanes(net.featureCol(addFeature))
+	sub1Col := lanes(net.featureCol(subFeature1))
+	sub2Col := lanes(net.featureCol(subFeature2))
+	s := lanes(src.Values[perspective])
+	a := lanes(acc.Values[perspective])
+	for o := 0; o < len(a); o += 4 {
+		a[o] = laneSub(laneSub(laneAdd(s[o], addCol[o]), sub1Col[o]), sub2Col[o])
+		a[o+1] = laneSub(laneSub(laneAdd(s[o+1], addCol[o+1]), sub1Col[o+1]), sub2Col[o+1])
+		a[o+2] = laneSub(laneSub(laneAdd(s[o+2], addCol[o+2]), sub1Col[o+2]), sub2Col[o+2])
+		a[o+3] = laneSub(laneSub(laneAdd(s[o+3], addCol[o+3]), sub1Col[o+3]), sub2Col[o+3])
 	}
 }
 
-// AddSubSub applies one added feature and two removed features in a single
-// pass -- used for captures, where the mover relocates (add at `to`, sub at
-// `from`) and the captured piece disappears (sub at `to`).
-func (acc *Accumulator) AddSubSub(net *Network, addFeature, subFeature1, subFeature2 uint16, perspective uint8) {
-	addCol := net.featureCol(addFeature)
-	sub1Col := net.featureCol(subFeature1)
-	sub2Col := net.featureCol(subFeature2)
-	a := acc.Values[perspective]
-	for o := 0; o < len(a); o += 16 {
-		a[o] += addCol[o] - sub1Col[o] - sub2Col[o]
-		a[o+1] += addCol[o+1] - sub1Col[o+1] - sub2Col[o+1]
-		a[o+2] += addCol[o+2] - sub1Col[o+2] - sub2Col[o+2]
-		a[o+3] += addCol[o+3] - sub1Col[o+3] - sub2Col[o+3]
-		a[o+4] += addCol[o+4] - sub1Col[o+4] - sub2Col[o+4]
-		a[o+5] += addCol[o+5] - sub1Col[o+5] - sub2Col[o+5]
-		a[o+6] += addCol[o+6] - sub1Col[o+6] - sub2Col[o+6]
-		a[o+7] += addCol[o+7] - sub1Col[o+7] - sub2Col[o+7]
-		a[o+8] += addCol[o+8] - sub1Col[o+8] - sub2Col[o+8]
-		a[o+9] += addCol[o+9] - sub1Col[o+9] - sub2Col[o+9]
-		a[o+10] += addCol[o+10] - sub1Col[o+10] - sub2Col[o+10]
-		a[o+11] += addCol[o+11] - sub1Col[o+11] - sub2Col[o+11]
-		a[o+12] += addCol[o+12] - sub1Col[o+12] - sub2Col[o+12]
-		a[o+13] += addCol[o+13] - sub1Col[o+13] - sub2Col[o+13]
-		a[o+14] += addCol[o+14] - sub1Col[o+14] - sub2Col[o+14]
-		a[o+15] += addCol[o+15] - sub1Col[o+15] - sub2Col[o+15]
+// AddAddSubSub applies two added and two removed features -- castling,
+// where king and rook both relocate.
+func (acc *Accumulator) AddAddSubSub(net *Network, src *Accumulator, addFeature1, addFeature2, subFeature1, subFeature2 uint16, perspective uint8) {
+	add1Col := lanes(net.featureCol(addFeature1))
+	add2Col := lanes(net.featureCol(addFeature2))
+	sub1Col := lanes(net.featureCol(subFeature1))
+	sub2Col := lanes(net.featureCol(subFeature2))
+	s := lanes(src.Values[perspective])
+	a := lanes(acc.Values[perspective])
+	for o := 0; o < len(a); o++ {
+		a[o] = laneSub(laneSub(laneAdd(laneAdd(s[o], add1Col[o]), add2Col[o]), sub1Col[o]), sub2Col[o])
 	}
 }
 
-// AddAddSub applies two added features and one removed feature in a single
-// pass -- the inverse of AddSubSub, used to undo a capture: the mover moves
-// back (add at `from`, sub at `to`) and the captured piece reappears (add at
-// `to`).
-func (acc *Accumulator) AddAddSub(net *Network, addFeature1, addFeature2, subFeature uint16, perspective uint8) {
-	add1Col := net.featureCol(addFeature1)
-	add2Col := net.featureCol(addFeature2)
-	subCol := net.featureCol(subFeature)
-	a := acc.Values[perspective]
-	for o := 0; o < len(a); o += 16 {
-		a[o] += add1Col[o] + add2Col[o] - subCol[o]
-		a[o+1] += add1Col[o+1] + add2Col[o+1] - subCol[o+1]
-		a[o+2] += add1Col[o+2] + add2Col[o+2] - subCol[o+2]
-		a[o+3] += add1Col[o+3] + add2Col[o+3] - subCol[o+3]
-		a[o+4] += add1Col[o+4] + add2Col[o+4] - subCol[o+4]
-		a[o+5] += add1Col[o+5] + add2Col[o+5] - subCol[o+5]
-		a[o+6] += add1Col[o+6] + add2Col[o+6] - subCol[o+6]
-		a[o+7] += add1Col[o+7] + add2Col[o+7] - subCol[o+7]
-		a[o+8] += add1Col[o+8] + add2Col[o+8] - subCol[o+8]
-		a[o+9] += add1Col[o+9] + add2Col[o+9] - subCol[o+9]
-		a[o+10] += add1Col[o+10] + add2Col[o+10] - subCol[o+10]
-		a[o+11] += add1Col[o+11] + add2Col[o+11] - subCol[o+11]
-		a[o+12] += add1Col[o+12] + add2Col[o+12] - subCol[o+12]
-		a[o+13] += add1Col[o+13] + add2Col[o+13] - subCol[o+13]
-		a[o+14] += add1Col[o+14] + add2Col[o+14] - subCol[o+14]
-		a[o+15] += add1Col[o+15] + add2Col[o+15] - subCol[o+15]
-	}
-}
-
-func (acc *Accumulator) Evaluate(net *Network, side uint8) float32 {
-	ourAcc := acc.Values[side]
-	theirAcc := acc.Values[1-side]
-	var result float32 = 0.0
-
-	// ReLU before output layer
-	for i := 0; i < net.L1; i++ {
-		result += net.WOutput[i] * max(ourAcc[i], 0.0)
+// Evaluate returns the network's output for side to move with the given
+// output bucket (see Network.OutputBucket), in Evaluate's units. For the
+// single-output architecture that's the quantized equivalent of
+//
+//	scale * (WOutput . [act(ours), act(theirs)] + BOutput)
+//
+// computed entirely in integers (see nnue_quant.go for the scaling); a
+// network with hidden layers continues from the activations in float.
+func (acc *Accumulator) Evaluate(net *Network, side uint8, bucket int) int32 {
+	if len(net.Layers) > 0 {
+		return net.evaluateLayers(acc, side, bucket)
 	}
-	for j := 0; j < net.L1; j++ {
-		result += net.WOutput[net.L1+j] * max(theirAcc[j], 0.0)
+	w := net.QOutput[bucket*2*net.L1 : (bucket+1)*2*net.L1]
+	var sum int32
+	if net.Activation == ActivationSCReLU {
+		sum = dotSCReLU(acc.Values[side], w[:net.L1], net.QA) +
+			dotSCReLU(acc.Values[1-side], w[net.L1:], net.QA)
+		sum /= net.QA
+	} else {
+		sum = dotCReLU(acc.Values[side], w[:net.L1], net.QA) +
+			dotCReLU(acc.Values[1-side], w[net.L1:], net.QA)
 	}
-	result += net.BOutput
-	return result
+	sum += net.QOutputBias[bucket]
+	return int32(int64(sum) * net.outputScale() / int64(net.QA*net.QB))
 }
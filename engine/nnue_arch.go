@@ -0,0 +1,377 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Network architectures. Every network starts with the accumulator (the
+// first layer, NumInputs -> L1 per perspective); what follows is either
+//
+//   - a single output neuron over both perspectives' activations, the
+//     (768->L1)x2->1 architecture the default net uses, evaluated in
+//     integers through QOutput, or
+//   - a stack of hidden layers, (NumInputs->L1)x2->L2->L3->1, evaluated in
+//     float from the first layer's quantized activations (Network.Layers).
+//
+// Either way the layers after the accumulator can be output-bucketed:
+// OutputBuckets sets of their weights, chosen per position by how many
+// pieces are on the board, so the network can weigh things differently
+// in the opening and the endgame.
+//
+// Files from version 3 on describe their architecture in the header --
+// the layer sizes, their activations, the number of output buckets and
+// the input layout -- so the loader needs no prior knowledge of the
+// network (version 4 files put it after the metadata block). Version 1 and
+// 2 files are the single-output architecture.
+
+// Limits on the layers after the accumulator: hidden layers are evaluated
+// in fixed-size buffers, and there's no use for more buckets than piece
+// counts.
+const (
+	maxHiddenSize    = 128
+	maxOutputBuckets = 32
+)
+
+// DenseLayer is a fully connected layer after the accumulator, one set of
+// weights per output bucket. Activation applies to its outputs, except on
+// the last (output) layer, which is linear.
+type DenseLayer struct {
+	Inputs, Outputs int
+	Activation      Activation
+
+	// Weights are stored input-major ([bucket][Inputs][Outputs], the
+	// transpose of the file's [bucket][Outputs][Inputs]) so an input that
+	// activates to zero -- most of them, after a clipped first layer -- can
+	// be skipped entirely.
+	Weights []float32
+	Biases  []float32 // [bucket][Outputs]
+}
+
+func (l *DenseLayer) bucketWeights(bucket int) []float32 {
+	n := l.Inputs * l.Outputs
+	return l.Weights[bucket*n : (bucket+1)*n]
+}
+
+func (l *DenseLayer) bucketBiases(bucket int) []float32 {
+	return l.Biases[bucket*l.Outputs : (bucket+1)*l.Outputs]
+}
+
+// forward sets out to the layer's pre-activation outputs for in.
+func (l *DenseLayer) forward(bucket int, in, out []float32) {
+	copy(out, l.bucketBiases(bucket))
+	w := l.bucketWeights(bucket)
+	for i, x := range in {
+		if x == 0 {
+			continue
+		}
+		row := w[i*l.Outputs : (i+1)*l.Outputs]
+		for j, wij := range row {
+			out[j] += x * wij
+		}
+	}
+}
+
+// activateFloat applies an activation to a float value.
+func activateFloat(a Activation, x float32) float32 {
+	switch a {
+	case ActivationCReLU:
+		return min(max(x, 0), 1)
+	case ActivationSCReLU:
+		x = min(max(x, 0), 1)
+		return x * x
+	}
+	return max(x, 0)
+}
+
+// OutputBucket returns the output bucket net evaluates pos with: the
+// piece count, kings included, split into OutputBuckets equal ranges.
+func (net *Network) OutputBucket(pos *Position) int {
+	if net.OutputBuckets <= 1 {
+		return 0
+	}
+	divisor := (32 + net.OutputBuckets - 1) / net.OutputBuckets
+	pieces := max(bits.OnesCount64(uint64(pos.Blockers))-2, 0)
+	return min(pieces/divisor, net.OutputBuckets-1)
+}
+
+// evaluateLayers runs the hidden layers on one accumulator, in Evaluate's
+// units. The first hidden layer reads the quantized activations directly,
+// scaled back to float, rather than a float copy of them.
+func (net *Network) evaluateLayers(acc *Accumulator, side uint8, bucket int) int32 {
+	var buf [maxHiddenSize]float32
+	first := &net.Layers[0]
+	out := buf[:first.Outputs]
+	copy(out, first.bucketBiases(bucket))
+	w := first.bucketWeights(bucket)
+	scale := 1 / float32(net.QA)
+	for half, values := range [2][]int16{acc.Values[side], acc.Values[side^1]} {
+		rows := w[half*net.L1*first.Outputs:]
+		for i, v := range values {
+			if v <= 0 {
+				continue
+			}
+			x := float32(min(int32(v), net.QA)) * scale
+			if net.Activation == ActivationSCReLU {
+				x *= x
+			}
+			row := rows[i*first.Outputs : (i+1)*first.Outputs]
+			for j, wij := range row {
+				out[j] += x * wij
+			}
+		}
+	}
+	return int32(net.finishLayers(out, bucket) * float32(net.outputScale()))
+}
+
+// finishLayers takes the first hidden layer's pre-activation outputs
+// through the rest of the stack, returning the network's output.
+func (net *Network) finishLayers(first []float32, bucket int) float32 {
+	var bufs [2][maxHiddenSize]float32
+	in := first
+	for k := 1; k < len(net.Layers); k++ {
+		for j := range in {
+			in[j] = activateFloat(net.Layers[k-1].Activation, in[j])
+		}
+		l := &net.Layers[k]
+		out := bufs[k%2][:l.Outputs]
+		l.forward(bucket, in, out)
+		in = out
+	}
+	return in[0]
+}
+
+// netArch is an architecture as a file header describes it.
+type netArch struct {
+	// sizes are the layer sizes: NumInputs, L1, any hidden layers, and 1
+	sizes []int
+	// activations are those of L1 and each hidden layer
+	activations   []Activation
+	outputBuckets int
+	layout        InputLayout
+}
+
+// archOf returns net's architecture.
+func archOf(net *Network, firstActivation Activation) netArch {
+	arch := netArch{
+		sizes:         []int{net.NumInputs, net.L1},
+		activations:   []Activation{firstActivation},
+		outputBuckets: net.OutputBuckets,
+		layout:        net.Layout,
+	}
+	for k, l := range net.Layers {
+		arch.sizes = append(arch.sizes, l.Outputs)
+		if k < len(net.Layers)-1 {
+			arch.activations = append(arch.activations, l.Activation)
+		}
+	}
+	if len(net.Layers) == 0 {
+		arch.sizes = append(arch.sizes, 1)
+	}
+	return arch
+}
+
+func (arch *netArch) validate() error {
+	n := len(arch.sizes)
+	if n < 3 || n > 8 || len(arch.activations) != n-2 {
+		return fmt.Errorf("invalid NNUE header: %d layer sizes with %d activations", n, len(arch.activations))
+	}
+	if arch.sizes[0] != arch.layout.NumInputs() {
+		return fmt.Errorf("invalid NNUE header: %d inputs, but the input layout has %d", arch.sizes[0], arch.layout.NumInputs())
+	}
+	// the accumulator update loops are unrolled in steps of 16
+	if l1 := arch.sizes[1]; l1 <= 0 || l1%16 != 0 || l1 > 1<<14 {
+		return fmt.Errorf("invalid NNUE header: L1 must be a positive multiple of 16, got %d", l1)
+	}
+	for _, size := range arch.sizes[2 : n-1] {
+		if size <= 0 || size > maxHiddenSize {
+			return fmt.Errorf("invalid NNUE header: hidden layer size %d (at most %d)", size, maxHiddenSize)
+		}
+	}
+	if arch.sizes[n-1] != 1 {
+		return fmt.Errorf("invalid NNUE header: %d outputs, want 1", arch.sizes[n-1])
+	}
+	for _, a := range arch.activations {
+		if a != ActivationCReLU && a != ActivationSCReLU && a != ActivationReLU {
+			return fmt.Errorf("invalid NNUE header: unknown activation %d", a)
+		}
+	}
+	if arch.outputBuckets < 1 || arch.outputBuckets > maxOutputBuckets {
+		return fmt.Errorf("invalid NNUE header: %d output buckets", arch.outputBuckets)
+	}
+	return nil
+}
+
+// newNetwork returns a network of the given architecture with its Layers
+// allocated (for a network with hidden layers); the loader allocates the
+// rest, which depends on whether the file is float or quantized.
+func (arch *netArch) newNetwork() *Network {
+	n := len(arch.sizes)
+	net := &Network{
+		NumInputs:       arch.sizes[0],
+		L1:              arch.sizes[1],
+		Layout:          arch.layout,
+		OutputBuckets:   arch.outputBuckets,
+		FloatActivation: arch.activations[0],
+	}
+	if n == 3 {
+		return net
+	}
+	inputs := 2 * net.L1
+	for k, size := range arch.sizes[2:] {
+		l := DenseLayer{
+			Inputs:  inputs,
+			Outputs: size,
+			Weights: make([]float32, arch.outputBuckets*inputs*size),
+			Biases:  make([]float32, arch.outputBuckets*size),
+		}
+		if k+3 < n {
+			l.Activation = arch.activations[k+1]
+		}
+		net.Layers = append(net.Layers, l)
+		inputs = size
+	}
+	return net
+}
+
+// Version 3 headers: the number of layer sizes, the sizes, the
+// activations, the number of output buckets, then the input layout.
+
+func writeArch(w io.Writer, arch *netArch) error {
+	header := []uint32{uint32(len(arch.sizes))}
+	for _, size := range arch.sizes {
+		header = append(header, uint32(size))
+	}
+	for _, a := range arch.activations {
+		header = append(header, uint32(a))
+	}
+	header = append(header, uint32(arch.outputBuckets))
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	return writeLayout(w, &arch.layout)
+}
+
+func readArch(r io.Reader) (netArch, error) {
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return netArch{}, err
+	}
+	if n < 3 || n > 8 {
+		return netArch{}, fmt.Errorf("invalid NNUE header: %d layers", n)
+	}
+	fields := make([]uint32, n+(n-2)+1)
+	if err := binary.Read(r, binary.LittleEndian, fields); err != nil {
+		return netArch{}, err
+	}
+	var arch netArch
+	for _, size := range fields[:n] {
+		arch.sizes = append(arch.sizes, int(size))
+	}
+	for _, a := range fields[n : 2*n-2] {
+		arch.activations = append(arch.activations, Activation(a))
+	}
+	arch.outputBuckets = int(fields[2*n-2])
+	var err error
+	if arch.layout, err = readLayout(r); err != nil {
+		return netArch{}, err
+	}
+	return arch, arch.validate()
+}
+
+// readLayers reads the float weights of the layers after the accumulator,
+// each as [bucket][Outputs][Inputs] weights then [bucket][Outputs] biases.
+func (net *Network) readLayers(r io.Reader) error {
+	for k := range net.Layers {
+		l := &net.Layers[k]
+		file := make([]float32, len(l.Weights))
+		if err := binary.Read(r, binary.LittleEndian, file); err != nil {
+			return err
+		}
+		transposeLayer(l, file, l.Weights, false)
+		if err := binary.Read(r, binary.LittleEndian, l.Biases); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (net *Network) writeLayers(w io.Writer) error {
+	for k := range net.Layers {
+		l := &net.Layers[k]
+		file := make([]float32, len(l.Weights))
+		transposeLayer(l, l.Weights, file, true)
+		for _, data := range [][]float32{file, l.Biases} {
+			if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// transposeLayer converts one layer's weights between the file's
+// output-major order and the in-memory input-major one; toFile picks the
+// direction.
+func transposeLayer(l *DenseLayer, src, dst []float32, toFile bool) {
+	n := l.Inputs * l.Outputs
+	for b := 0; b*n < len(src); b++ {
+		s, d := src[b*n:(b+1)*n], dst[b*n:(b+1)*n]
+		for i := 0; i < l.Inputs; i++ {
+			for o := 0; o < l.Outputs; o++ {
+				mem, file := i*l.Outputs+o, o*l.Inputs+i
+				if toFile {
+					d[file] = s[mem]
+				} else {
+					d[mem] = s[file]
+				}
+			}
+		}
+	}
+}
+
+// WriteFloat writes net's float parameters as a float network file
+// (version 4): Magic, the version, the metadata, the architecture header,
+// then WInput (output-major, as the trainer stores it), BInput, and the
+// layers after the accumulator -- WOutput and BOutput for the
+// single-output architecture -- and finally the checksum, all
+// little-endian.
+func (net *Network) WriteFloat(out io.Writer) error {
+	if net.WInput == nil {
+		return errors.New("network has no float parameters")
+	}
+	w := newChecksumWriter(out)
+	if _, err := io.WriteString(w, Magic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(Version)); err != nil {
+		return err
+	}
+	if err := writeMetadata(w, net.Info); err != nil {
+		return err
+	}
+	arch := archOf(net, net.FloatActivation)
+	if err := writeArch(w, &arch); err != nil {
+		return err
+	}
+	for _, data := range [][]float32{net.WInput, net.BInput} {
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	if len(net.Layers) > 0 {
+		if err := net.writeLayers(w); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+	for _, data := range [][]float32{net.WOutput, net.BOutput} {
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
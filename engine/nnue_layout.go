@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Input layouts. The plain layout is FeatureIndex's 768 piece-square
+// features, so the network sees each piece on its own, with nothing about
+// where either king stands. A king-bucketed layout repeats those 768
+// features once per bucket of the perspective's own king square, so every
+// piece's contribution can depend on where its side's king is (HalfKA with
+// the king squares grouped into buckets), and can mirror the board
+// horizontally when the king is on files e-h, so the network only has to
+// learn the queenside-king half and the buckets for files e-h come for
+// free.
+//
+// A perspective's features only change wholesale when its king crosses
+// into another bucket or across the mirror line; the accumulator stack
+// then refreshes that perspective from a per-bucket cache rather than from
+// scratch (see refreshCache in nnue_stack.go).
+
+// featuresPerBucket is the size of the plain layout: 12 piece kinds on 64
+// squares.
+const featuresPerBucket = 768
+
+// InputLayout describes how pieces map to first-layer features. The zero
+// value is the plain layout.
+type InputLayout struct {
+	// KingBuckets maps the perspective's king square, seen from its own side
+	// of the board (flipped vertically for Black) and after mirroring, to a
+	// bucket. With Mirror set, only files a-d of the map are used.
+	KingBuckets [64]uint8
+
+	// Mirror flips a perspective's board horizontally while its king is on
+	// files e-h.
+	Mirror bool
+}
+
+// NumBuckets returns the number of king buckets.
+func (l *InputLayout) NumBuckets() int {
+	n := 0
+	for sq, b := range l.KingBuckets {
+		if l.Mirror && sq%8 >= 4 {
+			continue
+		}
+		n = max(n, int(b)+1)
+	}
+	return n
+}
+
+// NumInputs returns the number of first-layer features.
+func (l *InputLayout) NumInputs() int {
+	return featuresPerBucket * l.NumBuckets()
+}
+
+// IsPlain reports whether l is the plain 768-feature layout.
+func (l *InputLayout) IsPlain() bool {
+	return *l == InputLayout{}
+}
+
+// orientation returns the bucket and mirroring of perspective's features
+// with its king on kingSq, packed as bucket<<1 | mirrored. Two positions
+// with the same orientation map every piece to the same feature.
+func (l *InputLayout) orientation(perspective uint8, kingSq Square) int {
+	if kingSq >= 64 { // no king (test positions)
+		return 0
+	}
+	if perspective == Black {
+		kingSq ^= FlipVertical
+	}
+	mirrored := 0
+	if l.Mirror && kingSq%8 >= 4 {
+		kingSq ^= 7
+		mirrored = 1
+	}
+	return int(l.KingBuckets[kingSq])<<1 | mirrored
+}
+
+// feature returns a piece's feature from perspective's point of view,
+// given the perspective's orientation.
+func (l *InputLayout) feature(orientation int, perspective, pieceColor, pieceType uint8, sq Square) uint16 {
+	if orientation&1 != 0 {
+		sq ^= 7
+	}
+	return featuresPerBucket*uint16(orientation>>1) + FeatureIndex(perspective, pieceColor, pieceType, sq)
+}
+
+// FeatureIndex returns a piece's feature from perspective's point of view,
+// with the perspective's king on kingSq.
+func (l *InputLayout) FeatureIndex(perspective uint8, kingSq Square, pieceColor, pieceType uint8, sq Square) uint16 {
+	return l.feature(l.orientation(perspective, kingSq), perspective, pieceColor, pieceType, sq)
+}
+
+// validate checks that l describes a usable layout: bucket numbers are
+// dense from 0, and all features fit in a uint16.
+func (l *InputLayout) validate() error {
+	n := l.NumBuckets()
+	if n*featuresPerBucket > 1<<16 {
+		return fmt.Errorf("too many king buckets (%d)", n)
+	}
+	used := make([]bool, n)
+	for sq, b := range l.KingBuckets {
+		if !l.Mirror || sq%8 < 4 {
+			used[b] = true
+		}
+	}
+	for b, ok := range used {
+		if !ok {
+			return fmt.Errorf("king bucket %d is never used", b)
+		}
+	}
+	return nil
+}
+
+// String renders the bucket map rank 8 first, as a board is usually drawn,
+// with mirrored-away squares as '.'.
+func (l InputLayout) String() string {
+	if l.IsPlain() {
+		return "plain"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d king buckets", l.NumBuckets())
+	if l.Mirror {
+		b.WriteString(", mirrored")
+	}
+	for rank := 7; rank >= 0; rank-- {
+		b.WriteString("\n ")
+		for file := 0; file < 8; file++ {
+			if l.Mirror && file >= 4 {
+				b.WriteString("  .")
+				continue
+			}
+			fmt.Fprintf(&b, " %2d", l.KingBuckets[rank*8+file])
+		}
+	}
+	return b.String()
+}
+
+// layoutFlagMirror is set in layoutHeader.Flags for a mirrored layout.
+const layoutFlagMirror = 1
+
+// layoutHeader is how an InputLayout is stored in network files.
+type layoutHeader struct {
+	Flags       uint32
+	KingBuckets [64]uint8
+}
+
+func writeLayout(w io.Writer, l *InputLayout) error {
+	header := layoutHeader{KingBuckets: l.KingBuckets}
+	if l.Mirror {
+		header.Flags |= layoutFlagMirror
+	}
+	return binary.Write(w, binary.LittleEndian, header)
+}
+
+func readLayout(r io.Reader) (InputLayout, error) {
+	var header layoutHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return InputLayout{}, err
+	}
+	if header.Flags&^layoutFlagMirror != 0 {
+		return InputLayout{}, fmt.Errorf("invalid NNUE header: unknown layout flags %#x", header.Flags)
+	}
+	l := InputLayout{KingBuckets: header.KingBuckets, Mirror: header.Flags&layoutFlagMirror != 0}
+	if err := l.validate(); err != nil {
+		return InputLayout{}, fmt.Errorf("invalid NNUE header: %w", err)
+	}
+	return l, nil
+}
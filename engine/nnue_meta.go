@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// Network file provenance and integrity. From version 4 on, both float and
+// quantized network files carry a metadata block right after the version
+// -- which training run produced the net, and the scale its output is
+// read at -- and end with a CRC-32 (IEEE) of every byte before it, magic
+// included. Every version is checked strictly: a file must end exactly
+// where its payload does, so a truncated, padded or mislabelled file
+// fails to load instead of evaluating garbage.
+//
+// Files older than version 4 have no stored checksum; the CRC-32 of the
+// whole file is computed on load instead, so every loaded net has a
+// checksum to identify it by (see Network.Describe).
+
+// metadataVersion is the first file version with metadata and a checksum.
+const metadataVersion = 4
+
+// maxMetadataSize bounds the metadata block, so a corrupt length can't
+// make the loader allocate gigabytes.
+const maxMetadataSize = 1 << 16
+
+// NetworkInfo is a network file's metadata block, stored as JSON. All
+// fields but Scale are descriptive.
+type NetworkInfo struct {
+	Name         string `json:"name,omitempty"`
+	TrainingData string `json:"trainingData,omitempty"`
+	Epochs       int    `json:"epochs,omitempty"`
+	Date         string `json:"date,omitempty"`
+
+	// Scale is how many eval points one unit of network output is worth
+	// (OutputScale for files that don't say).
+	Scale int `json:"scale"`
+}
+
+func writeMetadata(w io.Writer, info NetworkInfo) error {
+	if info.Scale == 0 {
+		info.Scale = OutputScale
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func readMetadata(r io.Reader) (NetworkInfo, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return NetworkInfo{}, err
+	}
+	if size > maxMetadataSize {
+		return NetworkInfo{}, fmt.Errorf("invalid NNUE metadata: %d bytes", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return NetworkInfo{}, err
+	}
+	var info NetworkInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return NetworkInfo{}, fmt.Errorf("invalid NNUE metadata: %w", err)
+	}
+	if info.Scale <= 0 {
+		return NetworkInfo{}, fmt.Errorf("invalid NNUE metadata: scale %d", info.Scale)
+	}
+	return info, nil
+}
+
+// outputScale returns how many eval points a unit of output is worth.
+func (net *Network) outputScale() int64 {
+	if net.Info.Scale == 0 {
+		return OutputScale
+	}
+	return int64(net.Info.Scale)
+}
+
+// checksumWriter writes through to w while checksumming everything
+// written; Close appends the checksum.
+type checksumWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+}
+
+func newChecksumWriter(w io.Writer) *checksumWriter {
+	return &checksumWriter{w: w, crc: crc32.NewIEEE()}
+}
+
+func (cw *checksumWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.crc.Write(p[:n])
+	return n, err
+}
+
+func (cw *checksumWriter) Close() error {
+	return binary.Write(cw.w, binary.LittleEndian, cw.crc.Sum32())
+}
+
+// finishLoad checks the end of a network file whose contents were
+// checksummed into crc as they were read from f: a version 4 file's
+// stored checksum has to match, and nothing may follow.
+func (net *Network) finishLoad(f io.Reader, crc hash.Hash32) error {
+	net.Checksum = crc.Sum32()
+	if net.FileVersion >= metadataVersion {
+		var stored uint32
+		if err := binary.Read(f, binary.LittleEndian, &stored); err != nil {
+			return fmt.Errorf("reading NNUE checksum: %w", err)
+		}
+		if stored != net.Checksum {
+			return fmt.Errorf("NNUE checksum mismatch: file says %08x, contents hash to %08x", stored, net.Checksum)
+		}
+	}
+	var b [1]byte
+	if n, _ := io.ReadFull(f, b[:]); n != 0 {
+		return errors.New("trailing bytes after the NNUE payload")
+	}
+	return nil
+}
+
+// Architecture describes net's layers, e.g. "(768->256)x2->1", with the
+// input layout and output buckets when there are any.
+func (net *Network) Architecture() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "(%d->%d)x2", net.NumInputs, net.L1)
+	for _, l := range net.Layers {
+		fmt.Fprintf(&b, "->%d", l.Outputs)
+	}
+	if len(net.Layers) == 0 {
+		b.WriteString("->1")
+	}
+	if !net.Layout.IsPlain() {
+		fmt.Fprintf(&b, ", %d king buckets", net.Layout.NumBuckets())
+		if net.Layout.Mirror {
+			b.WriteString(" (mirrored)")
+		}
+	}
+	if net.OutputBuckets > 1 {
+		fmt.Fprintf(&b, ", %d output buckets", net.OutputBuckets)
+	}
+	return b.String()
+}
+
+// Describe identifies net in one line: its name (or where it was loaded
+// from, for a net without one), architecture and checksum.
+func (net *Network) Describe() string {
+	name := net.Info.Name
+	if name == "" {
+		name = net.Source
+	} else if net.Source != "" {
+		name += " from " + net.Source
+	}
+	return fmt.Sprintf("%s, %s, crc32 %08x", name, net.Architecture(), net.Checksum)
+}
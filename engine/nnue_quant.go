@@ -0,0 +1,474 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"unsafe"
+)
+
+// Quantized NNUE inference. The network is trained in float, but evaluated
+// in integers: first-layer weights and biases are multiplied by QA and
+// rounded to int16, so the accumulator is an int16 sum in units of 1/QA;
+// the activation clips it to [0, QA] (1.0 in float terms); output weights
+// are multiplied by QB and rounded to int16, so the output dot product is
+// an int32 in units of 1/(QA*QB). Integer accumulator updates are exact
+// and half the memory traffic of float32 ones, and the result is the same
+// on every platform.
+//
+// The float network's plain ReLU becomes a clipped ReLU here: accumulator
+// values above 1.0 are clipped. The default net's accumulators stay well
+// below that in practice, which TestQuantizedMatchesFloat checks on a
+// position corpus (tools/nnue_quantize.go reports the same statistics for
+// any net).
+
+// QuantizedMagic starts a quantized network file (see WriteQuantized);
+// loadNNUEFromReader accepts both these and float files. Version 1 files
+// have the plain input layout and version 2 ones store it after the
+// header, both with the single-output architecture; version 3 files
+// describe their architecture (see nnue_arch.go), and version 4 ones add
+// metadata and a checksum (see nnue_meta.go).
+const (
+	QuantizedMagic   = "NNUQ"
+	QuantizedVersion = 4
+)
+
+// OutputScale maps the network's output onto Evaluate's units: one unit of
+// output is OutputScale eval points, unless the network's metadata gives
+// another scale.
+const OutputScale = 1000
+
+// Activation is the first layer's activation function.
+type Activation uint32
+
+const (
+	// ActivationCReLU is clamp(x, 0, 1).
+	ActivationCReLU Activation = iota
+	// ActivationSCReLU is clamp(x, 0, 1)^2.
+	ActivationSCReLU
+	// ActivationReLU is max(x, 0): how the default net's first layer was
+	// trained. The quantized accumulator can't represent it unclipped, so
+	// quantizing a ReLU first layer makes it CReLU (quantizedActivation);
+	// hidden layers, evaluated in float, use it as is.
+	ActivationReLU
+)
+
+// quantizedActivation returns the activation a first layer trained with a
+// is evaluated with once quantized.
+func quantizedActivation(a Activation) Activation {
+	if a == ActivationReLU {
+		return ActivationCReLU
+	}
+	return a
+}
+
+func (a Activation) String() string {
+	switch a {
+	case ActivationCReLU:
+		return "CReLU"
+	case ActivationSCReLU:
+		return "SCReLU"
+	case ActivationReLU:
+		return "ReLU"
+	}
+	return fmt.Sprintf("Activation(%d)", uint32(a))
+}
+
+// Default quantization scales for float networks, chosen for the default
+// net's weight ranges: with first-layer weights within about +-0.25 and
+// output weights within about +-0.55, QA = QB = 2048 keeps every int16 and
+// the int32 output sum well clear of overflow (checkQuantizedRanges
+// verifies that per network) while leaving rounding error far below an
+// eval point. SCReLU squares activations, so SCReLU networks need a much
+// smaller QA (255 is customary) to keep the output sum in int32.
+const (
+	DefaultQA = 2048
+	DefaultQB = 2048
+)
+
+// maxActiveFeatures bounds how many features can be active in one
+// perspective at once: one per piece on the board.
+const maxActiveFeatures = 32
+
+// dotCReLU returns sum(clamp(acc[i], 0, qa) * w[i]), in four interleaved
+// partial sums so consecutive multiply-adds don't wait on each other.
+func dotCReLU(acc, w []int16, qa int32) int32 {
+	w = w[:len(acc)]
+	var s0, s1, s2, s3 int32
+	for i := 0; i < len(acc); i += 4 {
+		s0 += min(max(int32(acc[i]), 0), qa) * int32(w[i])
+		s1 += min(max(int32(acc[i+1]), 0), qa) * int32(w[i+1])
+		s2 += min(max(int32(acc[i+2]), 0), qa) * int32(w[i+2])
+		s3 += min(max(int32(acc[i+3]), 0), qa) * int32(w[i+3])
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// dotSCReLU returns sum(clamp(acc[i], 0, qa)^2 * w[i]), multiplying by w
+// before the second factor so every intermediate fits in int32.
+func dotSCReLU(acc, w []int16, qa int32) int32 {
+	w = w[:len(acc)]
+	var sum int32
+	for i, a := range acc {
+		v := min(max(int32(a), 0), qa)
+		sum += v * int32(w[i]) * v
+	}
+	return sum
+}
+
+// Quantize returns a copy of a float network with its quantized parameters
+// rebuilt for the given activation and scales.
+func (net *Network) Quantize(activation Activation, qa, qb int32) (*Network, error) {
+	if net.WInput == nil {
+		return nil, errors.New("network has no float parameters to quantize")
+	}
+	q := &Network{
+		Info:            net.Info,
+		Source:          net.Source,
+		NumInputs:       net.NumInputs,
+		L1:              net.L1,
+		Layout:          net.Layout,
+		OutputBuckets:   net.OutputBuckets,
+		Layers:          net.Layers,
+		FloatActivation: net.FloatActivation,
+		WInput:          net.WInput,
+		BInput:          net.BInput,
+		WOutput:         net.WOutput,
+		BOutput:         net.BOutput,
+	}
+	if err := q.quantize(activation, qa, qb); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// quantize fills in net's quantized parameters from its float ones.
+func (net *Network) quantize(activation Activation, qa, qb int32) error {
+	if qa <= 0 || qb <= 0 {
+		return fmt.Errorf("invalid quantization scales QA=%d QB=%d", qa, qb)
+	}
+	var err error
+	round16 := func(x float64) int16 {
+		r := math.Round(x)
+		if r < math.MinInt16 || r > math.MaxInt16 {
+			err = fmt.Errorf("weight %g overflows int16 at QA=%d QB=%d", x, qa, qb)
+			return 0
+		}
+		return int16(r)
+	}
+
+	net.Activation = activation
+	net.QA, net.QB = qa, qb
+	net.FeatureCols = make([]int16, net.NumInputs*net.L1)
+	for f := 0; f < net.NumInputs; f++ {
+		for o := 0; o < net.L1; o++ {
+			net.FeatureCols[f*net.L1+o] = round16(float64(net.WInput[o*net.NumInputs+f]) * float64(qa))
+		}
+	}
+	net.QBias = make([]int16, net.L1)
+	for o, b := range net.BInput {
+		net.QBias[o] = round16(float64(b) * float64(qa))
+	}
+	// the hidden layers of a deeper network stay float
+	if len(net.Layers) == 0 {
+		net.QOutput = make([]int16, len(net.WOutput))
+		for i, w := range net.WOutput {
+			net.QOutput[i] = round16(float64(w) * float64(qb))
+		}
+		net.QOutputBias = make([]int32, len(net.BOutput))
+		for i, b := range net.BOutput {
+			net.QOutputBias[i] = int32(math.Round(float64(b) * float64(qa) * float64(qb)))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return net.checkQuantizedRanges()
+}
+
+// checkQuantizedRanges verifies that no position can overflow the integer
+// arithmetic: each accumulator element stays within int16 with every
+// perspective's maximum of maxActiveFeatures features active (taking each
+// element's largest-magnitude column entry for all of them), and each
+// bucket's output sum stays within int32 with every activation at its
+// maximum.
+func (net *Network) checkQuantizedRanges() error {
+	for o := 0; o < net.L1; o++ {
+		worst := int64(0)
+		for f := 0; f < net.NumInputs; f++ {
+			worst = max(worst, abs64(int64(net.FeatureCols[f*net.L1+o])))
+		}
+		if abs64(int64(net.QBias[o]))+maxActiveFeatures*worst > math.MaxInt16 {
+			return fmt.Errorf("accumulator element %d can overflow int16 at QA=%d", o, net.QA)
+		}
+	}
+
+	maxAct := int64(net.QA)
+	if net.Activation == ActivationSCReLU {
+		maxAct *= int64(net.QA)
+	}
+	for bucket, bias := range net.QOutputBias {
+		worst := int64(0)
+		for _, w := range net.QOutput[bucket*2*net.L1 : (bucket+1)*2*net.L1] {
+			worst += abs64(int64(w)) * maxAct
+		}
+		if worst+abs64(int64(bias)) > math.MaxInt32 {
+			return fmt.Errorf("output sum can overflow int32 at QA=%d QB=%d", net.QA, net.QB)
+		}
+	}
+	return nil
+}
+
+func abs64(x int64) int64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// quantizedHeaderV1 is the fixed-size header of a version 1 or 2
+// quantized network file, following QuantizedMagic and the version.
+type quantizedHeaderV1 struct {
+	NumInputs  uint32
+	L1         uint32
+	Activation uint32
+	QA         uint32
+	QB         uint32
+}
+
+// WriteQuantized writes net's quantized parameters: QuantizedMagic, the
+// version, the metadata, the architecture header (see nnue_arch.go), QA
+// and QB, then FeatureCols (feature-major, as evaluated) and QBias, then
+// QOutput and QOutputBias -- or for a network with hidden layers, their
+// float parameters -- and finally the checksum. All little-endian.
+func (net *Network) WriteQuantized(out io.Writer) error {
+	w := newChecksumWriter(out)
+	if _, err := io.WriteString(w, QuantizedMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(QuantizedVersion)); err != nil {
+		return err
+	}
+	if err := writeMetadata(w, net.Info); err != nil {
+		return err
+	}
+	arch := archOf(net, net.Activation)
+	if err := writeArch(w, &arch); err != nil {
+		return err
+	}
+	for _, data := range []any{[]uint32{uint32(net.QA), uint32(net.QB)}, net.FeatureCols, net.QBias} {
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	if len(net.Layers) > 0 {
+		if err := net.writeLayers(w); err != nil {
+			return err
+		}
+		return w.Close()
+	}
+	for _, data := range []any{net.QOutput, net.QOutputBias} {
+		if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// loadQuantizedNNUE reads the rest of a quantized network file, after its
+// magic.
+func loadQuantizedNNUE(f io.Reader) (*Network, error) {
+	var version uint32
+	if err := binary.Read(f, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	info := NetworkInfo{Scale: OutputScale}
+	var arch netArch
+	var qa, qb uint32
+	switch version {
+	case 1, 2:
+		var header quantizedHeaderV1
+		if err := binary.Read(f, binary.LittleEndian, &header); err != nil {
+			return nil, err
+		}
+		arch = netArch{
+			sizes:         []int{int(header.NumInputs), int(header.L1), 1},
+			activations:   []Activation{Activation(header.Activation)},
+			outputBuckets: 1,
+		}
+		if version == 2 {
+			var err error
+			if arch.layout, err = readLayout(f); err != nil {
+				return nil, err
+			}
+		}
+		if err := arch.validate(); err != nil {
+			return nil, err
+		}
+		qa, qb = header.QA, header.QB
+	case 3, QuantizedVersion:
+		var err error
+		if version >= metadataVersion {
+			if info, err = readMetadata(f); err != nil {
+				return nil, err
+			}
+		}
+		if arch, err = readArch(f); err != nil {
+			return nil, err
+		}
+		scales := make([]uint32, 2)
+		if err := binary.Read(f, binary.LittleEndian, scales); err != nil {
+			return nil, err
+		}
+		qa, qb = scales[0], scales[1]
+	default:
+		return nil, fmt.Errorf("unsupported quantized NNUE version %d", version)
+	}
+	if a := arch.activations[0]; a != ActivationCReLU && a != ActivationSCReLU {
+		return nil, fmt.Errorf("invalid NNUE header: %v first layer can't be quantized", a)
+	}
+	if qa == 0 || qa > math.MaxInt16 || qb == 0 || qb > math.MaxInt16 {
+		return nil, fmt.Errorf("invalid NNUE header: quantization scales QA=%d QB=%d", qa, qb)
+	}
+
+	net := arch.newNetwork()
+	net.Info = info
+	net.FileVersion = int(version)
+	net.Activation = arch.activations[0]
+	net.QA, net.QB = int32(qa), int32(qb)
+	net.FeatureCols = make([]int16, net.NumInputs*net.L1)
+	net.QBias = make([]int16, net.L1)
+	for _, data := range []any{net.FeatureCols, net.QBias} {
+		if err := binary.Read(f, binary.LittleEndian, data); err != nil {
+			return nil, err
+		}
+	}
+	if len(net.Layers) > 0 {
+		if err := net.readLayers(f); err != nil {
+			return nil, err
+		}
+	} else {
+		net.QOutput = make([]int16, net.OutputBuckets*2*net.L1)
+		net.QOutputBias = make([]int32, net.OutputBuckets)
+		for _, data := range []any{net.QOutput, net.QOutputBias} {
+			if err := binary.Read(f, binary.LittleEndian, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := net.checkQuantizedRanges(); err != nil {
+		return nil, err
+	}
+	return net, nil
+}
+
+// activeFeatures returns the features active in pos from perspective's
+// point of view.
+func activeFeatures(pos *Position, perspective uint8) []uint16 {
+	layout := &pos.Net.Layout
+	orientation := layout.orientation(perspective, Lsb(pos.Pieces[perspective][King]))
+	features := make([]uint16, 0, maxActiveFeatures)
+	for color := White; color <= Black; color++ {
+		for piece := Pawn; piece <= King; piece++ {
+			bb := pos.Pieces[color][piece]
+			for bb != 0 {
+				features = append(features, layout.feature(orientation, perspective, color, piece, PopLsb(&bb)))
+			}
+		}
+	}
+	return features
+}
+
+// EvaluateFloat evaluates pos from scratch with the float parameters of
+// pos's network, exactly as trained (in particular with the first layer's
+// trained activation, plain ReLU for the default net), in Evaluate's
+// units. Slow; it's the reference the quantized evaluation is checked
+// against. ok is false if the network has no float parameters (it was
+// loaded from a quantized file).
+func EvaluateFloat(pos *Position) (eval int32, ok bool) {
+	net := pos.Net
+	if net.WInput == nil {
+		return 0, false
+	}
+	var accs [2][]float32
+	for perspective := White; perspective <= Black; perspective++ {
+		acc := append([]float32(nil), net.BInput...)
+		for _, f := range activeFeatures(pos, perspective) {
+			for o := range acc {
+				acc[o] += net.WInput[o*net.NumInputs+int(f)]
+			}
+		}
+		for o, v := range acc {
+			acc[o] = activateFloat(net.FloatActivation, v)
+		}
+		accs[perspective] = acc
+	}
+	activations := append(accs[pos.Turn], accs[1-pos.Turn]...)
+	bucket := net.OutputBucket(pos)
+
+	if len(net.Layers) > 0 {
+		first := make([]float32, net.Layers[0].Outputs)
+		net.Layers[0].forward(bucket, activations, first)
+		return int32(net.finishLayers(first, bucket) * float32(net.outputScale())), true
+	}
+	result := net.BOutput[bucket]
+	for i, v := range activations {
+		result += net.WOutput[bucket*2*net.L1+i] * v
+	}
+	return int32(result * float32(net.outputScale())), true
+}
+
+// Accumulator updates work on four int16 elements at a time, packed into a
+// uint64 ("SIMD within a register"): Go doesn't vectorize loops, and the
+// lane-wise add/subtract below is a handful of scalar instructions for
+// four elements instead of several per element. Each lane wraps mod 2^16
+// exactly like an int16 would, with no carry or borrow crossing into its
+// neighbour. L1 being a multiple of 16 (checked on load) makes every
+// accumulator and feature column a whole number of uint64s.
+
+// laneHigh has the top bit of each 16-bit lane set.
+const laneHigh = 0x8000800080008000
+
+// lanes views an int16 slice as packed uint64s.
+func lanes(s []int16) []uint64 {
+	return unsafe.Slice((*uint64)(unsafe.Pointer(unsafe.SliceData(s))), len(s)/4)
+}
+
+// laneAdd adds each 16-bit lane of b to the same lane of a: the low 15 bits
+// of each lane are added with the top bits cleared (so no carry leaves the
+// lane), and each lane's top bit is then the XOR of the two top bits and
+// that lane's carry in.
+func laneAdd(a, b uint64) uint64 {
+	return ((a &^ laneHigh) + (b &^ laneHigh)) ^ ((a ^ b) & laneHigh)
+}
+
+// laneSub subtracts each 16-bit lane of b from the same lane of a, the
+// mirror image of laneAdd: setting a's top bits first means no lane ever
+// borrows from its neighbour.
+func laneSub(a, b uint64) uint64 {
+	return ((a | laneHigh) - (b &^ laneHigh)) ^ ((a ^ ^b) & laneHigh)
+}
+
+// laneAddCol adds a feature column to an accumulator, both as lanes.
+func laneAddCol(a, col []uint64) {
+	col = col[:len(a)]
+	for o := 0; o < len(a); o += 4 {
+		a[o] = laneAdd(a[o], col[o])
+		a[o+1] = laneAdd(a[o+1], col[o+1])
+		a[o+2] = laneAdd(a[o+2], col[o+2])
+		a[o+3] = laneAdd(a[o+3], col[o+3])
+	}
+}
+
+// laneSubCol subtracts a feature column from an accumulator.
+func laneSubCol(a, col []uint64) {
+	col = col[:len(a)]
+	for o := 0; o < len(a); o += 4 {
+		a[o] = laneSub(a[o], col[o])
+		a[o+1] = laneSub(a[o+1], col[o+1])
+		a[o+2] = laneSub(a[o+2], col[o+2])
+		a[o+3] = laneSub(a[o+3], col[o+3])
+	}
+}
@@ -0,0 +1,227 @@
+package engine
+
+import "math/bits"
+
+// Accumulator stack: rather than updating one accumulator in place on every
+// DoMove and reversing the update on UndoMove, a Position keeps one
+// accumulator per ply. DoMove only pushes an entry recording which pieces
+// the move added and removed (its "dirty pieces") -- no accumulator work at
+// all -- and UndoMove pops it, which is a decrement: the parent's
+// accumulator was never touched, so there is nothing to undo.
+//
+// Accumulators are computed lazily, when Position.Accumulator is asked for
+// one (i.e. when a node actually evaluates): from the nearest ancestor ply
+// that is already computed, each ply in between is derived from its parent
+// with one fused copy-and-update pass (see Accumulator.AddSub). Nodes that
+// never evaluate -- TT cutoffs, in-check nodes, perft -- never pay for
+// their accumulator. Positions reached after a long run of moves without
+// an evaluation, or after a king move that changed how its side's features
+// are laid out (see nnue_layout.go), are refreshed from the board instead,
+// through a refresh cache.
+//
+// The stack belongs to one Position, and so to one search thread: Clone
+// gives the clone a stack of its own.
+
+// dirtyPiece is one piece a move put on or took off a square. Pieces
+// rather than feature indices are recorded, since the feature a piece maps
+// to depends on the perspective.
+type dirtyPiece struct {
+	color, piece uint8
+	sq           Square
+}
+
+func (p dirtyPiece) feature(layout *InputLayout, orientation int, perspective uint8) uint16 {
+	return layout.feature(orientation, perspective, p.color, p.piece, p.sq)
+}
+
+// accEntry is one ply of an AccumulatorStack.
+type accEntry struct {
+	acc      Accumulator
+	computed [2]bool // per perspective: is acc up to date?
+
+	// the pieces the move leading to this ply removed and added; every
+	// move is 1+1 (quiet, promotion), 2+1 (capture) or 2+2 (castling)
+	removed, added   [2]dirtyPiece
+	nRemoved, nAdded uint8
+}
+
+func (e *accEntry) remove(color, piece uint8, sq Square) {
+	e.removed[e.nRemoved] = dirtyPiece{color, piece, sq}
+	e.nRemoved++
+}
+
+func (e *accEntry) add(color, piece uint8, sq Square) {
+	e.added[e.nAdded] = dirtyPiece{color, piece, sq}
+	e.nAdded++
+}
+
+// changesOrientation reports whether e's move moved perspective's king to
+// a square with another orientation, so that none of the perspective's
+// features carry over from the parent ply.
+func (e *accEntry) changesOrientation(layout *InputLayout, perspective uint8) bool {
+	from, to := NoSquare, NoSquare
+	for _, p := range e.removed[:e.nRemoved] {
+		if p.piece == King && p.color == perspective {
+			from = p.sq
+		}
+	}
+	if from == NoSquare {
+		return false
+	}
+	for _, p := range e.added[:e.nAdded] {
+		if p.piece == King && p.color == perspective {
+			to = p.sq
+		}
+	}
+	return layout.orientation(perspective, from) != layout.orientation(perspective, to)
+}
+
+// refreshEntry is one slot of the refresh cache (a "Finny table"): the
+// accumulator of the last position refreshed with a given perspective and
+// orientation, and that position's pieces. Refreshing from it only adds
+// and removes the pieces that differ -- usually a handful, since the
+// positions one search refreshes share most of their pieces -- instead of
+// adding every piece to the bias again.
+type refreshEntry struct {
+	values []int16
+	pieces [2][6]Bitboard
+}
+
+// AccumulatorStack is a Position's per-ply accumulators; entry 0 is the
+// position it was created at, and has no move.
+type AccumulatorStack struct {
+	entries []accEntry
+	top     int
+
+	// cache is the refresh cache, per perspective and orientation
+	cache [2][]refreshEntry
+}
+
+// NewAccumulatorStack returns an empty stack; its first accumulator is
+// built from the board when it's first needed.
+func NewAccumulatorStack() *AccumulatorStack {
+	return &AccumulatorStack{entries: make([]accEntry, 1, 64)}
+}
+
+// push starts a new ply for a move, which the caller records with
+// add/remove. Entries (and their accumulator storage) are reused once the
+// stack has grown to a given depth.
+func (s *AccumulatorStack) push() *accEntry {
+	s.top++
+	if s.top == len(s.entries) {
+		s.entries = append(s.entries, accEntry{})
+	}
+	e := &s.entries[s.top]
+	e.computed = [2]bool{}
+	e.nRemoved, e.nAdded = 0, 0
+	return e
+}
+
+func (s *AccumulatorStack) pop() {
+	if s.top == 0 {
+		panic("accumulator stack underflow")
+	}
+	s.top--
+}
+
+// update brings the top entry up to date for perspective, given the
+// position it corresponds to.
+func (s *AccumulatorStack) update(pos *Position, perspective uint8) {
+	top := &s.entries[s.top]
+	if top.computed[perspective] {
+		return
+	}
+	net := pos.Net
+	layout := &net.Layout
+	top.alloc(net)
+
+	// Find the nearest computed ply to update from, without going past
+	// entry 0 (which has no move) or a move that changed the orientation.
+	base := -1
+	for i := s.top; i > 0 && !s.entries[i].changesOrientation(layout, perspective); {
+		i--
+		if s.entries[i].computed[perspective] {
+			base = i
+			break
+		}
+	}
+	// Each incremental step costs about as much as adding a handful of
+	// features, so past a few plies refreshing is cheaper.
+	if base < 0 || 4*(s.top-base) > bits.OnesCount64(uint64(pos.Blockers)) {
+		s.refresh(pos, perspective, &top.acc)
+		top.computed[perspective] = true
+		return
+	}
+
+	orientation := layout.orientation(perspective, Lsb(pos.Pieces[perspective][King]))
+	for i := base + 1; i <= s.top; i++ {
+		e := &s.entries[i]
+		e.alloc(net)
+		e.apply(net, orientation, &s.entries[i-1].acc, perspective)
+		e.computed[perspective] = true
+	}
+}
+
+// refresh sets one perspective of acc to pos's, from the refresh cache.
+func (s *AccumulatorStack) refresh(pos *Position, perspective uint8, acc *Accumulator) {
+	net := pos.Net
+	layout := &net.Layout
+	orientation := layout.orientation(perspective, Lsb(pos.Pieces[perspective][King]))
+	if s.cache[perspective] == nil {
+		s.cache[perspective] = make([]refreshEntry, 2*layout.NumBuckets())
+	}
+	cached := &s.cache[perspective][orientation]
+	if cached.values == nil {
+		cached.values = append([]int16(nil), net.QBias...)
+	}
+
+	values := lanes(cached.values)
+	for color := White; color <= Black; color++ {
+		for piece := Pawn; piece <= King; piece++ {
+			now, then := pos.Pieces[color][piece], cached.pieces[color][piece]
+			for added := now &^ then; added != 0; {
+				f := layout.feature(orientation, perspective, color, piece, PopLsb(&added))
+				laneAddCol(values, lanes(net.featureCol(f)))
+			}
+			for removed := then &^ now; removed != 0; {
+				f := layout.feature(orientation, perspective, color, piece, PopLsb(&removed))
+				laneSubCol(values, lanes(net.featureCol(f)))
+			}
+		}
+	}
+	cached.pieces = pos.Pieces
+	copy(acc.Values[perspective], cached.values)
+}
+
+func (e *accEntry) alloc(net *Network) {
+	if e.acc.Values[White] == nil {
+		e.acc = NewAccumulator(net)
+	}
+}
+
+// apply sets one perspective of e's accumulator to src's with e's move
+// applied, in the given orientation (which the move doesn't change).
+func (e *accEntry) apply(net *Network, orientation int, src *Accumulator, perspective uint8) {
+	l := &net.Layout
+	add, rem := &e.added, &e.removed
+	switch {
+	case e.nAdded == 1 && e.nRemoved == 1:
+		e.acc.AddSub(net, src, add[0].feature(l, orientation, perspective), rem[0].feature(l, orientation, perspective), perspective)
+	case e.nAdded == 1 && e.nRemoved == 2:
+		e.acc.AddSubSub(net, src, add[0].feature(l, orientation, perspective),
+			rem[0].feature(l, orientation, perspective), rem[1].feature(l, orientation, perspective), perspective)
+	case e.nAdded == 2 && e.nRemoved == 2:
+		e.acc.AddAddSubSub(net, src, add[0].feature(l, orientation, perspective), add[1].feature(l, orientation, perspective),
+			rem[0].feature(l, orientation, perspective), rem[1].feature(l, orientation, perspective), perspective)
+	default:
+		panic("accumulator stack: unexpected move shape")
+	}
+}
+
+// Accumulator returns pos's accumulator, up to date for both perspectives.
+// It stays valid until the next DoMove or UndoMove.
+func (pos *Position) Accumulator() *Accumulator {
+	pos.Accs.update(pos, White)
+	pos.Accs.update(pos, Black)
+	return &pos.Accs.entries[pos.Accs.top].acc
+}
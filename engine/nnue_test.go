@@ -1,17 +1,21 @@
 package engine_test
 
 import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 
 	"silverfish/engine"
 )
 
-// The NNUE accumulator is updated incrementally (Add/Remove) on every
-// DoMove/UndoMove rather than recomputed from scratch. This test checks that
-// incremental updates stay consistent with a from-scratch build: after
-// playing a sequence of moves, the position's accumulator-derived evaluation
-// must match that of a fresh Position built straight from the resulting FEN
-// (which only ever calls Add, never Remove).
+// The NNUE accumulator is updated incrementally along the moves played
+// rather than recomputed from scratch. This test checks that incremental
+// updates stay consistent with a from-scratch build: after playing a
+// sequence of moves, the position's accumulator-derived evaluation must
+// match that of a fresh Position built straight from the resulting FEN.
 func TestNNUEIncrementalMatchesFromScratch(t *testing.T) {
 	pos := engine.FromFEN("6k1/5p1p/1q2p1p1/1PnpP3/3N4/1Pr5/P5PP/3QR1K1 w - - 3 37")
 
@@ -40,3 +44,406 @@ func TestNNUEIncrementalMatchesFromScratch(t *testing.T) {
 		t.Errorf("incrementally updated eval = %d, from-scratch eval = %d; want equal", got, want)
 	}
 }
+
+// Output-layer cost alone: the accumulator is already up to date, so this
+// is the dot product over both perspectives' activations.
+func BenchmarkEvaluateNNUE(b *testing.B) {
+	pos := engine.FromFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	var sink int32
+	for i := 0; i < b.N; i++ {
+		sink += engine.EvaluateNNUE(&pos)
+	}
+	_ = sink
+}
+
+// nnueCorpus returns a reproducible spread of positions: random playouts
+// of up to 60 plies from a few varied starting points, sampled every ply.
+func nnueCorpus(n int) []engine.Position {
+	starts := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"6k1/5p1p/1q2p1p1/1PnpP3/3N4/1Pr5/P5PP/3QR1K1 w - - 3 37",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	}
+	rng := rand.New(rand.NewSource(1))
+	var corpus []engine.Position
+	for len(corpus) < n {
+		pos := engine.FromFEN(starts[len(corpus)%len(starts)])
+		for ply := 0; ply < 60 && len(corpus) < n; ply++ {
+			moves := pos.LegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			pos.DoMove(moves[rng.Intn(len(moves))])
+			corpus = append(corpus, pos.Clone())
+		}
+	}
+	return corpus
+}
+
+// The quantized network has to evaluate like the float one it was built
+// from: rounding and the activation clip may move an eval by a few points,
+// but never by enough to change what the search makes of it.
+func TestQuantizedMatchesFloat(t *testing.T) {
+	const maxDiff, maxMeanDiff = 15, 3.0
+
+	var total, worst int32
+	corpus := nnueCorpus(4000)
+	for i := range corpus {
+		pos := &corpus[i]
+		want, ok := engine.EvaluateFloat(pos)
+		if !ok {
+			t.Fatalf("default network has no float parameters")
+		}
+		got := engine.EvaluateNNUE(pos)
+		diff := got - want
+		if diff < 0 {
+			diff = -diff
+		}
+		total += diff
+		if diff > worst {
+			worst = diff
+			if diff > maxDiff {
+				t.Errorf("%s: quantized eval %d, float eval %d", pos.ToFEN(), got, want)
+			}
+		}
+	}
+	mean := float64(total) / float64(len(corpus))
+	t.Logf("%d positions: mean |quantized - float| = %.2f, max = %d", len(corpus), mean, worst)
+	if mean > maxMeanDiff {
+		t.Errorf("mean |quantized - float| = %.2f, want at most %.1f", mean, maxMeanDiff)
+	}
+}
+
+// A network written in the quantized format and loaded back must evaluate
+// exactly like the one it was written from.
+func TestQuantizedFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "net.nnue")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.DefaultNetwork().WriteQuantized(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	corpus := nnueCorpus(200)
+	want := make([]int32, len(corpus))
+	for i := range corpus {
+		want[i] = engine.EvaluateNNUE(&corpus[i])
+	}
+
+	if err := engine.LoadDefaultNetwork(path); err != nil {
+		t.Fatalf("loading quantized network: %v", err)
+	}
+	defer engine.LoadDefaultNetwork("")
+	for i := range corpus {
+		pos := engine.FromFEN(corpus[i].ToFEN())
+		if got := engine.EvaluateNNUE(&pos); got != want[i] {
+			t.Errorf("%s: eval %d after round trip, want %d", pos.ToFEN(), got, want[i])
+		}
+		if _, ok := engine.EvaluateFloat(&pos); ok {
+			t.Fatalf("quantized network claims float parameters")
+		}
+	}
+}
+
+// Integer accumulators are exact, so however the accumulator stack gets
+// to a position -- updating through captures, promotions and castling,
+// catching up over plies that were never evaluated, popping back after
+// UndoMove, refreshing when a king changes bucket -- it must land on
+// exactly the from-scratch accumulator.
+func TestNNUEIncrementalExactOnCorpus(t *testing.T) {
+	checkIncrementalExact(t, engine.DefaultNetwork())
+}
+
+func TestNNUEIncrementalExactKingBuckets(t *testing.T) {
+	checkIncrementalExact(t, kingBucketNetwork(t))
+}
+
+func checkIncrementalExact(t *testing.T, net *engine.Network) {
+	check := func(pos *engine.Position) {
+		t.Helper()
+		fresh := engine.FromFEN(pos.ToFEN())
+		fresh.SetNetwork(net)
+		got, want := pos.Accumulator(), fresh.Accumulator()
+		for perspective := range got.Values {
+			if !slices.Equal(got.Values[perspective], want.Values[perspective]) {
+				t.Fatalf("%s: incremental accumulator (perspective %d) differs from a from-scratch one", pos.ToFEN(), perspective)
+			}
+		}
+	}
+
+	rng := rand.New(rand.NewSource(2))
+	for _, pos := range nnueCorpus(200) {
+		pos.SetNetwork(net)
+		pos.Accumulator() // the playout's first ply updates from here
+		for ply := 0; ply < 12; ply++ {
+			moves := pos.LegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			move := moves[rng.Intn(len(moves))]
+			pos.DoMove(move)
+			// skip some plies, so later ones have to catch up over several
+			if rng.Intn(3) == 0 {
+				check(&pos)
+			}
+			if rng.Intn(4) == 0 {
+				pos.UndoMove(move)
+				check(&pos)
+			}
+		}
+		check(&pos)
+	}
+}
+
+// testKingBuckets is a mirrored four-bucket layout: the back rank split
+// into corner and centre, the second rank, and everything further up.
+var testKingBuckets = engine.InputLayout{
+	Mirror: true,
+	KingBuckets: [64]uint8{
+		0, 0, 1, 1, 1, 1, 0, 0,
+		2, 2, 2, 2, 2, 2, 2, 2,
+		3, 3, 3, 3, 3, 3, 3, 3,
+		3, 3, 3, 3, 3, 3, 3, 3,
+		3, 3, 3, 3, 3, 3, 3, 3,
+		3, 3, 3, 3, 3, 3, 3, 3,
+		3, 3, 3, 3, 3, 3, 3, 3,
+		3, 3, 3, 3, 3, 3, 3, 3,
+	},
+}
+
+// kingBucketNetwork returns a random quantized network with the
+// testKingBuckets layout, written out and loaded back like a real one.
+func kingBucketNetwork(t *testing.T) *engine.Network {
+	t.Helper()
+	const l1 = 64
+	rng := rand.New(rand.NewSource(3))
+	random := func(n, limit int) []int16 {
+		s := make([]int16, n)
+		for i := range s {
+			s[i] = int16(rng.Intn(2*limit+1) - limit)
+		}
+		return s
+	}
+	inputs := testKingBuckets.NumInputs()
+	net := &engine.Network{
+		NumInputs:     inputs,
+		L1:            l1,
+		Layout:        testKingBuckets,
+		OutputBuckets: 1,
+		Activation:    engine.ActivationCReLU,
+		QA:            255,
+		QB:            64,
+		FeatureCols:   random(inputs*l1, 20),
+		QBias:         random(l1, 100),
+		QOutput:       random(2*l1, 64),
+		QOutputBias:   []int32{0},
+	}
+
+	path := filepath.Join(t.TempDir(), "buckets.nnue")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := net.WriteQuantized(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	loaded, err := engine.LoadNNUEFile(path)
+	if err != nil {
+		t.Fatalf("loading king-bucketed network: %v", err)
+	}
+	if loaded.Layout != testKingBuckets {
+		t.Fatalf("layout after round trip:\n%v\nwant\n%v", loaded.Layout, testKingBuckets)
+	}
+	return loaded
+}
+
+// With a mirrored layout, a position and its mirror image across the d/e
+// file boundary are the same input to the network.
+func TestKingBucketMirroring(t *testing.T) {
+	net := kingBucketNetwork(t)
+	pos := engine.FromFEN("3k4/1r6/8/2n5/5P2/8/4P3/1K6 w - - 0 1")
+	mirror := engine.FromFEN("4k3/6r1/8/5n2/2P5/8/3P4/6K1 w - - 0 1")
+	pos.SetNetwork(net)
+	mirror.SetNetwork(net)
+	for perspective, values := range pos.Accumulator().Values {
+		if !slices.Equal(values, mirror.Accumulator().Values[perspective]) {
+			t.Errorf("perspective %d: mirrored position has a different accumulator", perspective)
+		}
+	}
+	if got, want := engine.EvaluateNNUE(&mirror), engine.EvaluateNNUE(&pos); got != want {
+		t.Errorf("mirrored position evaluates to %d, want %d", got, want)
+	}
+}
+
+// deepNetwork returns a random float network with hidden layers and
+// output buckets, (768->64)x2->16->8->1 x4, written out as a float file
+// and loaded back (and so quantized) like a real one.
+func deepNetwork(t *testing.T) *engine.Network {
+	t.Helper()
+	const l1, buckets = 64, 4
+	rng := rand.New(rand.NewSource(4))
+	random := func(n int, limit float32) []float32 {
+		s := make([]float32, n)
+		for i := range s {
+			s[i] = (2*rng.Float32() - 1) * limit
+		}
+		return s
+	}
+	layer := func(inputs, outputs int, activation engine.Activation) engine.DenseLayer {
+		return engine.DenseLayer{
+			Inputs:     inputs,
+			Outputs:    outputs,
+			Activation: activation,
+			Weights:    random(buckets*inputs*outputs, 0.5),
+			Biases:     random(buckets*outputs, 0.1),
+		}
+	}
+	net := &engine.Network{
+		NumInputs:       768,
+		L1:              l1,
+		OutputBuckets:   buckets,
+		FloatActivation: engine.ActivationCReLU,
+		WInput:          random(768*l1, 0.1),
+		BInput:          random(l1, 0.2),
+		Layers: []engine.DenseLayer{
+			layer(2*l1, 16, engine.ActivationSCReLU),
+			layer(16, 8, engine.ActivationReLU),
+			layer(8, 1, 0),
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "deep.nnue")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := net.WriteFloat(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	loaded, err := engine.LoadNNUEFile(path)
+	if err != nil {
+		t.Fatalf("loading deep network: %v", err)
+	}
+	if loaded.OutputBuckets != buckets || len(loaded.Layers) != 3 || loaded.Layers[1].Activation != engine.ActivationReLU ||
+		!slices.Equal(loaded.Layers[1].Weights, net.Layers[1].Weights) {
+		t.Fatalf("deep network architecture or weights changed in a round trip")
+	}
+	return loaded
+}
+
+// A network with hidden layers evaluates its first layer quantized and
+// the rest in float, so it must agree closely with the all-float
+// evaluation; and a quantized file of it must evaluate exactly the same.
+func TestDeepNetwork(t *testing.T) {
+	net := deepNetwork(t)
+	corpus := nnueCorpus(1000)
+	want := make([]int32, len(corpus))
+	for i := range corpus {
+		pos := &corpus[i]
+		pos.SetNetwork(net)
+		want[i] = engine.EvaluateNNUE(pos)
+		float, _ := engine.EvaluateFloat(pos)
+		if diff := want[i] - float; diff < -5 || diff > 5 {
+			t.Errorf("%s: quantized eval %d, float eval %d", pos.ToFEN(), want[i], float)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "deepq.nnue")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := net.WriteQuantized(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	quantized, err := engine.LoadNNUEFile(path)
+	if err != nil {
+		t.Fatalf("loading quantized deep network: %v", err)
+	}
+	for i := range corpus {
+		pos := &corpus[i]
+		pos.SetNetwork(quantized)
+		if got := engine.EvaluateNNUE(pos); got != want[i] {
+			t.Fatalf("%s: eval %d after quantized round trip, want %d", pos.ToFEN(), got, want[i])
+		}
+	}
+}
+
+func TestOutputBucket(t *testing.T) {
+	net := &engine.Network{OutputBuckets: 8}
+	for _, tc := range []struct {
+		fen    string
+		bucket int
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 7},
+		{"4k3/8/8/8/8/8/8/4K3 w - - 0 1", 0},
+		{"4k3/pppp4/8/8/8/8/4P3/4K3 w - - 0 1", 1},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", 7},
+		{"6k1/5p1p/1q2p1p1/1PnpP3/3N4/1Pr5/P5PP/3QR1K1 w - - 3 37", 4},
+	} {
+		pos := engine.FromFEN(tc.fen)
+		if got := net.OutputBucket(&pos); got != tc.bucket {
+			t.Errorf("%s: bucket %d, want %d", tc.fen, got, tc.bucket)
+		}
+	}
+}
+
+// Version 4 files carry metadata and a checksum, and no network file may
+// be cut short or have anything after its payload.
+func TestNetworkFileIntegrity(t *testing.T) {
+	net, err := engine.DefaultNetwork().Quantize(engine.ActivationCReLU, engine.DefaultQA, engine.DefaultQB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	net.Info = engine.NetworkInfo{Name: "test-256", TrainingData: "selfplay.bin", Epochs: 40, Date: "2026-10-19", Scale: 2 * engine.OutputScale}
+	var buf bytes.Buffer
+	if err := net.WriteQuantized(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	dir := t.TempDir()
+	load := func(name string, data []byte) (*engine.Network, error) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return engine.LoadNNUEFile(path)
+	}
+
+	loaded, err := load("net.nnue", data)
+	if err != nil {
+		t.Fatalf("loading: %v", err)
+	}
+	if loaded.Info != net.Info || loaded.FileVersion != engine.QuantizedVersion || loaded.Checksum == 0 {
+		t.Errorf("loaded info %+v (version %d, crc32 %08x), want %+v", loaded.Info, loaded.FileVersion, loaded.Checksum, net.Info)
+	}
+
+	// the metadata's scale is what evals are read at
+	pos := engine.StartingPosition()
+	pos.DoMove(engine.NewMove(engine.SquareE2, engine.SquareE4))
+	base := engine.EvaluateNNUE(&pos)
+	pos.SetNetwork(loaded)
+	if got := engine.EvaluateNNUE(&pos); got < 2*base-1 || got > 2*base+1 {
+		t.Errorf("eval at scale %d = %d, want about twice %d", loaded.Info.Scale, got, base)
+	}
+
+	corrupt := slices.Clone(data)
+	corrupt[len(corrupt)/2] ^= 1
+	for name, bad := range map[string][]byte{
+		"corrupt":   corrupt,
+		"truncated": data[:len(data)-1],
+		"trailing":  append(slices.Clone(data), 0),
+	} {
+		if _, err := load(name+".nnue", bad); err == nil {
+			t.Errorf("%s file loaded without error", name)
+		}
+	}
+}
@@ -36,48 +36,229 @@ func (search *Search) recordKiller(move Move, ply int) {
 	search.killers[ply][0] = m
 }
 
-// recordHistory increments the history weight for a quiet move that caused
-// a beta cutoff, by depth^2. Deliberately unbounded/unclamped here --
-// scoreQuiets clamps at read time (a move's score field is only 16 bits, so
-// the raw accumulator must never be written into it directly).
-func (search *Search) recordHistory(move Move, depth int) {
-	search.history[search.Pos.Turn][move.From()][move.To()] += int32(depth * depth)
-}
-
-// maxQuietScore is the highest score scoreQuiets ever assigns, kept below
-// MvvLva's lowest nonzero entry (10) so a killer or history-favored quiet
-// can never be ordered ahead of an actual capture.
-const maxQuietScore = 9
-
-// scoreQuiets scores every not-yet-scored (quiet) move in moveList using
-// search's killers and history tables, leaving moves ScoreMoves already
-// scored (captures/promotions, all nonzero) untouched. Killers at this ply
-// take the top two quiet scores; everything else gets a history-derived
-// score clamped to fit below them.
-func (search *Search) scoreQuiets(moveList *MoveList, ply int) {
+// pushMove records move (about to be played from ply) in moveStack, for
+// the continuation history/countermove lookups of the nodes below it. Must
+// be called before DoMove, while the moving piece is still on move.From().
+func (search *Search) pushMove(move Move, ply int) {
+	if ply >= MaxKillerPly {
+		return
+	}
+	color, piece := search.Pos.GetSquare(move.From())
+	search.moveStack[ply] = pieceTo{piece: coloredPiece(color, piece), to: move.To(), ok: true}
+}
+
+// isKiller reports whether move is one of the killers stored at ply.
+func (search *Search) isKiller(move Move, ply int) bool {
+	if ply >= MaxKillerPly {
+		return false
+	}
+	m := move & 0xffff
+	return m == search.killers[ply][0] || m == search.killers[ply][1]
+}
+
+// HistoryMax bounds every history table entry to [-HistoryMax, HistoryMax].
+// Small enough that entries fit an int16, which keeps the continuation
+// history tables (the big ones) at a reasonable size.
+const HistoryMax = 16384
+
+// pieceTo identifies a move by the piece that made it (colored, 0-11: see
+// coloredPiece) and its destination -- the key continuation history and
+// countermoves are indexed by. A zero-value pieceTo (ok=false) means "no
+// move": before the root, or a null move.
+type pieceTo struct {
+	piece uint8
+	to    Square
+	ok    bool
+}
+
+// coloredPiece maps (color, piece type) to 0-11, white first.
+func coloredPiece(color, piece uint8) uint8 {
+	return color*6 + piece
+}
+
+// historyBonus is the gravity-scaled bonus (and, negated, malus) applied
+// for a cutoff at depth: grows with depth^2 like the old unbounded
+// increment did, but capped so one deep cutoff can't saturate an entry.
+func historyBonus(depth int) int32 {
+	return min(HistoryBonusScale*int32(depth*depth), HistoryBonusMax)
+}
+
+// applyGravity nudges a history entry toward +/-HistoryMax by bonus,
+// scaled down the closer the entry already is to that bound ("history
+// gravity"). Entries can therefore never leave [-HistoryMax, HistoryMax],
+// and a move that stops working decays back instead of riding on an
+// ever-growing total from early in the search.
+func applyGravity[T int16 | int32](entry *T, bonus int32) {
+	v := int32(*entry)
+	absBonus := bonus
+	if absBonus < 0 {
+		absBonus = -absBonus
+	}
+	v += bonus - v*absBonus/HistoryMax
+	*entry = T(v)
+}
+
+// previousMoves returns the moves played one and two plies before ply.
+func (search *Search) previousMoves(ply int) (prev1, prev2 pieceTo) {
+	if ply >= 1 && ply-1 < MaxKillerPly {
+		prev1 = search.moveStack[ply-1]
+	}
+	if ply >= 2 && ply-2 < MaxKillerPly {
+		prev2 = search.moveStack[ply-2]
+	}
+	return prev1, prev2
+}
+
+// quietHistory is the combined history score for a quiet move: butterfly
+// history plus both continuation histories. Roughly in
+// [-3*HistoryMax, 3*HistoryMax]. Used for ordering and to scale LMR.
+func (search *Search) quietHistory(move Move, piece uint8, prev1, prev2 pieceTo) int32 {
+	h := search.history[search.Pos.Turn][move.From()][move.To()]
+	if prev1.ok {
+		h += int32(search.contHist[0][prev1.piece][prev1.to][piece][move.To()])
+	}
+	if prev2.ok {
+		h += int32(search.contHist[1][prev2.piece][prev2.to][piece][move.To()])
+	}
+	return h
+}
+
+// captureVictim returns the piece type move captures (Pawn for en
+// passant), or NoPiece for a quiet move or non-capturing promotion.
+func captureVictim(pos *Position, move Move) uint8 {
+	if move.IsEnPassant() {
+		return Pawn
+	}
+	_, victim := pos.GetSquare(move.To())
+	return victim
+}
+
+// updateQuietHistory applies bonus to move's butterfly and continuation
+// history entries.
+func (search *Search) updateQuietHistory(move Move, piece uint8, prev1, prev2 pieceTo, bonus int32) {
+	applyGravity(&search.history[search.Pos.Turn][move.From()][move.To()], bonus)
+	if prev1.ok {
+		applyGravity(&search.contHist[0][prev1.piece][prev1.to][piece][move.To()], bonus)
+	}
+	if prev2.ok {
+		applyGravity(&search.contHist[1][prev2.piece][prev2.to][piece][move.To()], bonus)
+	}
+}
+
+// updateCutoffHistories records a beta cutoff by best at ply. The cutoff
+// move gets a bonus in whichever table fits it (quiet: butterfly +
+// continuation histories, plus killer/countermove slots; noisy: capture
+// history), and every move searched before it without causing the cutoff
+// gets the matching malus -- those were ordered ahead of the move that
+// actually worked, so their scores were too high. quietsTried and
+// capturesTried must not include best itself. Must be called with pos in
+// the node's own (pre-move) state.
+func (search *Search) updateCutoffHistories(best Move, quietsTried, capturesTried []Move, depth, ply int) {
+	bonus := historyBonus(depth)
+	prev1, prev2 := search.previousMoves(ply)
+	us := search.Pos.Turn
+
+	if isQuietMove(&search.Pos, best) {
+		search.recordKiller(best, ply)
+		if prev1.ok {
+			search.counterMoves[prev1.piece][prev1.to] = best & 0xffff
+		}
+		_, piece := search.Pos.GetSquare(best.From())
+		search.updateQuietHistory(best, coloredPiece(us, piece), prev1, prev2, bonus)
+		for _, move := range quietsTried {
+			_, piece := search.Pos.GetSquare(move.From())
+			search.updateQuietHistory(move, coloredPiece(us, piece), prev1, prev2, -bonus)
+		}
+	} else {
+		_, piece := search.Pos.GetSquare(best.From())
+		applyGravity(&search.captureHist[coloredPiece(us, piece)][best.To()][captureVictim(&search.Pos, best)], bonus)
+	}
+
+	for _, move := range capturesTried {
+		_, piece := search.Pos.GetSquare(move.From())
+		applyGravity(&search.captureHist[coloredPiece(us, piece)][move.To()][captureVictim(&search.Pos, move)], -bonus)
+	}
+}
+
+// Move ordering score bands. Move's score field is 16 bits, so every band
+// has to fit in [0, 65535]; the bands are disjoint so that, whatever the
+// history tables say, every queen promotion is ordered ahead of every
+// capture, every capture ahead of every killer, every killer ahead of the
+// countermove, the countermove ahead of every other quiet, and every quiet
+// ahead of the underpromotions.
+const (
+	// Queen promotions: queenPromotionScore + MvvLva[victim][Pawn], above
+	// the best capture, as they win more than any capture but a queen's.
+	queenPromotionScore = captureScoreBase + 56*256
+
+	// Captures: captureScoreBase + MvvLva*256 + captureHist/128. MvvLva
+	// dominates: capture history (at most +/-HistoryMax/128 = +/-128)
+	// reorders captures within one MVV-LVA entry but never across two.
+	captureScoreBase = 40000
+
+	killer1Score     = 32002
+	killer2Score     = 32001
+	counterMoveScore = 32000
+
+	// Other quiets: quietScoreCenter + quietHistory/4, clamped to
+	// [1, counterMoveScore-1].
+	quietScoreCenter = 16000
+
+	// Underpromotions, capturing or not, come last: a knight, rook or
+	// bishop instead of a queen is almost never the better choice, and when
+	// it is (a knight's check, a stalemate dodged) the search still finds
+	// it.
+	underpromotionScore = 0
+)
+
+// scoreMoves scores moveList for ordering by OrderMoves: promotions by the
+// piece promoted to, captures by MVV-LVA and capture history, and quiets
+// by killers, countermoves and butterfly/continuation history (see the
+// score bands above).
+func (search *Search) scoreMoves(moveList *MoveList, ply int) {
 	var killer1, killer2 Move
 	if ply < MaxKillerPly {
 		killer1, killer2 = search.killers[ply][0], search.killers[ply][1]
 	}
+	prev1, prev2 := search.previousMoves(ply)
+	var counter Move
+	if prev1.ok {
+		counter = search.counterMoves[prev1.piece][prev1.to]
+	}
+	us := search.Pos.Turn
 
 	for i := 0; i < int(moveList.Count); i++ {
 		move := &moveList.Moves[i]
-		if move.Score() != 0 {
+		_, attacker := search.Pos.GetSquare(move.From())
+		piece := coloredPiece(us, attacker)
+
+		if move.IsPromotion() {
+			if move.Promotion() == Queen {
+				move.GiveScore(queenPromotionScore + MvvLva[captureVictim(&search.Pos, *move)][Pawn])
+			} else {
+				move.GiveScore(underpromotionScore)
+			}
+			continue
+		}
+		if !isQuietMove(&search.Pos, *move) {
+			victim := captureVictim(&search.Pos, *move)
+			score := captureScoreBase + MvvLva[victim][attacker]*256 +
+				int(search.captureHist[piece][move.To()][victim])/128
+			move.GiveScore(score)
 			continue
 		}
 
 		masked := *move & 0xffff
 		switch {
 		case killer1 != 0 && masked == killer1:
-			move.GiveScore(maxQuietScore)
+			move.GiveScore(killer1Score)
 		case killer2 != 0 && masked == killer2:
-			move.GiveScore(maxQuietScore - 1)
+			move.GiveScore(killer2Score)
+		case counter != 0 && masked == counter:
+			move.GiveScore(counterMoveScore)
 		default:
-			h := search.history[search.Pos.Turn][move.From()][move.To()]
-			if h > maxQuietScore-2 {
-				h = maxQuietScore - 2
-			}
-			move.GiveScore(int(h))
+			h := quietScoreCenter + search.quietHistory(*move, piece, prev1, prev2)/4
+			move.GiveScore(int(min(max(h, 1), counterMoveScore-1)))
 		}
 	}
 }
@@ -110,7 +291,7 @@ func ScoreMoves(pos *Position, moveList *MoveList) {
 // here are small -- at most a few dozen moves -- so this is cheap and
 // needs no allocation). A full sort, not just a best-to-front swap, matters
 // once ordering has more than one signal below the very top: MVV-LVA always
-// outranks killers/history (see maxQuietScore), so a swap-only pass could
+// outranks killers/history (see the score bands above scoreMoves), so a swap-only pass could
 // only ever place a killer/history-favored quiet first in capture-free
 // positions, and even then left every other move in raw movegen order --
 // making killer/history scores irrelevant to move 2 onward, including to
@@ -0,0 +1,116 @@
+package engine_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"silverfish/engine"
+)
+
+// History gravity has to keep every entry within +/-HistoryMax however
+// often a bonus or malus lands on it, in any order: the continuation and
+// capture histories are int16s, which anything past the bound would
+// overflow. Tried with the largest bonus a cutoff gives and with
+// HistoryMax itself, the largest gravity is good for.
+func TestHistoryGravityBounds(t *testing.T) {
+	for _, bonus := range []int32{engine.HistoryBonus(engine.MaxKillerPly), engine.HistoryMax} {
+		patterns := map[string]func(i int) int32{
+			"bonus":     func(int) int32 { return bonus },
+			"malus":     func(int) int32 { return -bonus },
+			"alternate": func(i int) int32 { return bonus * int32(1-2*(i%2)) },
+			"bursts":    func(i int) int32 { return bonus * int32(1-2*(i/50%2)) },
+		}
+		for name, pattern := range patterns {
+			var entry16 int16
+			var entry32 int32
+			for i := 0; i < 1000; i++ {
+				engine.ApplyGravity16(&entry16, pattern(i))
+				engine.ApplyGravity32(&entry32, pattern(i))
+				if entry32 < -engine.HistoryMax || entry32 > engine.HistoryMax {
+					t.Fatalf("%s of %d: int32 entry %d after %d updates, outside +/-%d", name, bonus, entry32, i+1, engine.HistoryMax)
+				}
+				if int32(entry16) != entry32 {
+					t.Fatalf("%s of %d: int16 entry %d after %d updates, want %d", name, bonus, entry16, i+1, entry32)
+				}
+			}
+		}
+	}
+}
+
+// A cutoff rewards the move that caused it and penalizes every quiet and
+// capture searched before it -- in every table, and however many times
+// it's repeated, within +/-HistoryMax.
+func TestUpdateCutoffHistories(t *testing.T) {
+	pos := engine.FromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1")
+	var search engine.Search
+	search.Init(&pos)
+	search.PlayMove(engine.NewMoveFromStr("e2e4"), 0)
+	search.PlayMove(engine.NewMoveFromStr("d7d5"), 1)
+
+	// at ply 2: Nf3 cuts off after a3 and Nc3 (and exd5) were searched
+	best, untried := engine.NewMoveFromStr("g1f3"), engine.NewMoveFromStr("h2h3")
+	quiets := []engine.Move{engine.NewMoveFromStr("a2a3"), engine.NewMoveFromStr("b1c3")}
+	captures := []engine.Move{engine.NewMoveFromStr("e4d5")}
+	for i := 0; i < 1000; i++ {
+		search.UpdateCutoffHistories(best, quiets, captures, engine.MaxKillerPly, 2)
+	}
+
+	sign := func(v int32) int32 {
+		switch {
+		case v > 0:
+			return 1
+		case v < 0:
+			return -1
+		}
+		return 0
+	}
+	check := func(name string, m engine.Move, wantSign int32) {
+		t.Helper()
+		butterfly, cont1, cont2 := search.HistoryEntries(m, 2)
+		for i, entry := range []int32{butterfly, cont1, cont2} {
+			if entry < -engine.HistoryMax || entry > engine.HistoryMax {
+				t.Errorf("%s %s: entry %d = %d, outside +/-%d", name, m.ToString(), i, entry, engine.HistoryMax)
+			}
+			if sign(entry) != wantSign {
+				t.Errorf("%s %s: entry %d = %d, want sign %d", name, m.ToString(), i, entry, wantSign)
+			}
+		}
+	}
+	check("cutoff move", best, 1)
+	for _, m := range quiets {
+		check("quiet tried first", m, -1)
+	}
+	check("quiet not tried", untried, 0)
+
+	for _, m := range captures {
+		if h := search.CaptureHistory(m); h >= 0 || h < -engine.HistoryMax {
+			t.Errorf("capture tried first %s: capture history %d, want negative and within -%d", m.ToString(), h, engine.HistoryMax)
+		}
+	}
+}
+
+// Promotions are ordered by what they promote to: a queen promotion ahead
+// of every capture (here, capturing or not, ahead of even PxP), and the
+// underpromotions behind every quiet move.
+func TestScoreMovesPromotions(t *testing.T) {
+	pos := engine.FromFEN("r3k3/1P6/8/3p4/4P3/8/8/4K3 w - - 0 1")
+	var search engine.Search
+	search.Init(&pos)
+	var order []string
+	for _, m := range search.OrderedMoves(0) {
+		order = append(order, m.ToString())
+	}
+
+	want := []string{"b7a8q", "b7b8q", "e4d5"}
+	if len(order) < len(want) || !slices.Equal(order[:len(want)], want) {
+		t.Fatalf("ordered %v, want it to start %v", order, want)
+	}
+	under := order[len(order)-6:]
+	for _, m := range under {
+		if !strings.HasSuffix(m, "n") && !strings.HasSuffix(m, "r") && !strings.HasSuffix(m, "b") {
+			t.Errorf("ordered %v, want the six underpromotions last", order)
+			break
+		}
+	}
+}
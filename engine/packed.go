@@ -0,0 +1,229 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// Packed positions: a position with a search score and a game result in a
+// fixed 32 bytes, for training data. A FEN with its labels is 60-90 bytes
+// of text that has to be parsed back; a packed position is a third of that
+// and decodes with a few shifts, and fixed-size records can be counted,
+// seeked to and shuffled without reading the file. A file of them is just
+// the records back to back, so files concatenate.
+//
+// The layout (little-endian) follows bulletformat's board encoding, but
+// keeps the board as it stands rather than flipped to the side to move, and
+// keeps everything a FEN has:
+//
+//	 0  occupied squares (8 bytes)
+//	 8  one 4-bit piece code (color<<3 | piece) per occupied square, in
+//	    square order, low nibble first (16 bytes)
+//	24  score, from White's point of view (int16)
+//	26  result: 0 Black won, 1 draw, 2 White won
+//	27  flags: bit 0 set for Black to move, bits 1-4 castling rights
+//	28  en passant square (64 for none)
+//	29  half-move clock
+//	30  full-move number (uint16)
+
+// PackedSize is the size of an encoded PackedPosition.
+const PackedSize = 32
+
+// PackedPosition is a labeled position in its 32-byte form (see above).
+type PackedPosition struct {
+	Occupied  Bitboard
+	Pieces    [16]uint8
+	Score     int16
+	Result    uint8
+	Flags     uint8
+	EnPassant uint8
+	Rule50    uint8
+	FullMoves uint16
+}
+
+// Results, from White's point of view, as stored in PackedPosition.Result.
+const (
+	PackedBlackWins uint8 = iota
+	PackedDraw
+	PackedWhiteWins
+)
+
+// Pack returns pos as a PackedPosition, with score (from White's point of
+// view) clamped to int16 and the result a draw until set. A position has
+// at most 32 pieces to pack; Pack panics on one with more.
+func (pos *Position) Pack(score int32) PackedPosition {
+	if bits.OnesCount64(uint64(pos.Blockers)) > 32 {
+		panic("cannot pack a position with more than 32 pieces")
+	}
+	p := PackedPosition{
+		Occupied:  pos.Blockers,
+		Score:     int16(min(max(score, math.MinInt16), math.MaxInt16)),
+		Result:    PackedDraw,
+		Flags:     pos.Turn | pos.CastlingRights<<1,
+		EnPassant: uint8(pos.EnPassantSquare),
+		Rule50:    pos.Rule50,
+		FullMoves: pos.FullMoves(),
+	}
+	occupied := pos.Blockers
+	for i := 0; occupied != 0; i++ {
+		color, piece := pos.GetSquare(PopLsb(&occupied))
+		p.Pieces[i/2] |= (color<<3 | piece) << (4 * (i % 2))
+	}
+	return p
+}
+
+// SetResult records a game's outcome.
+func (p *PackedPosition) SetResult(outcome Outcome) {
+	switch outcome {
+	case WhiteWins:
+		p.Result = PackedWhiteWins
+	case BlackWins:
+		p.Result = PackedBlackWins
+	default:
+		p.Result = PackedDraw
+	}
+}
+
+// Bitboards returns the pieces p holds, without setting up a whole
+// Position -- all a trainer needs of most positions.
+func (p *PackedPosition) Bitboards() ([2][6]Bitboard, error) {
+	var pieces [2][6]Bitboard
+	if bits.OnesCount64(uint64(p.Occupied)) > 32 {
+		return pieces, errors.New("packed position: more than 32 pieces")
+	}
+	occupied := p.Occupied
+	for i := 0; occupied != 0; i++ {
+		code := p.Pieces[i/2] >> (4 * (i % 2)) & 0xf
+		color, piece := code>>3, code&7
+		if piece > King {
+			return pieces, fmt.Errorf("packed position: invalid piece code %d", code)
+		}
+		pieces[color][piece] |= 1 << PopLsb(&occupied)
+	}
+	return pieces, nil
+}
+
+// Turn returns the side to move.
+func (p *PackedPosition) Turn() uint8 {
+	return p.Flags & 1
+}
+
+// Unpack returns the position p holds, set up like FromFEN's.
+func (p *PackedPosition) Unpack() (Position, error) {
+	if defaultNet == nil {
+		panic("engine.Init() must be called before unpacking positions")
+	}
+	pieces, err := p.Bitboards()
+	if err != nil {
+		return Position{}, err
+	}
+	if p.Flags>>5 != 0 || p.EnPassant > uint8(NoSquare) || p.Result > PackedWhiteWins || p.FullMoves == 0 {
+		return Position{}, errors.New("packed position: invalid state")
+	}
+	var pos Position
+	pos.Net = defaultNet
+	pos.Accs = NewAccumulatorStack()
+	for sq := range pos.Board {
+		pos.Board[sq] = NoPiece
+	}
+	for color := White; color <= Black; color++ {
+		for piece := Pawn; piece <= King; piece++ {
+			for bb := pieces[color][piece]; bb != 0; {
+				pos.PutPiece(PopLsb(&bb), piece, color)
+			}
+		}
+	}
+	pos.Turn = p.Turn()
+	pos.CastlingRights = p.Flags >> 1
+	pos.EnPassantSquare = Square(p.EnPassant)
+	pos.Rule50 = p.Rule50
+	pos.Ply = (p.FullMoves-1)*2 + uint16(pos.Turn)
+	pos.Hash = Hash(&pos)
+	pos.PawnHash = PawnHash(&pos)
+	pos.MaterialKey = MaterialKey(&pos)
+	return pos, nil
+}
+
+// Encode writes p's PackedSize bytes to b.
+func (p *PackedPosition) Encode(b []byte) {
+	_ = b[PackedSize-1]
+	binary.LittleEndian.PutUint64(b, uint64(p.Occupied))
+	copy(b[8:24], p.Pieces[:])
+	binary.LittleEndian.PutUint16(b[24:], uint16(p.Score))
+	b[26], b[27], b[28], b[29] = p.Result, p.Flags, p.EnPassant, p.Rule50
+	binary.LittleEndian.PutUint16(b[30:], p.FullMoves)
+}
+
+// DecodePackedPosition reads a PackedPosition from its PackedSize bytes.
+func DecodePackedPosition(b []byte) PackedPosition {
+	_ = b[PackedSize-1]
+	p := PackedPosition{
+		Occupied:  Bitboard(binary.LittleEndian.Uint64(b)),
+		Score:     int16(binary.LittleEndian.Uint16(b[24:])),
+		Result:    b[26],
+		Flags:     b[27],
+		EnPassant: b[28],
+		Rule50:    b[29],
+		FullMoves: binary.LittleEndian.Uint16(b[30:]),
+	}
+	copy(p.Pieces[:], b[8:24])
+	return p
+}
+
+// PackedReader reads packed positions from a stream of them.
+type PackedReader struct {
+	r   *bufio.Reader
+	buf [PackedSize]byte
+}
+
+// NewPackedReader returns a buffered PackedReader reading from r.
+func NewPackedReader(r io.Reader) *PackedReader {
+	return &PackedReader{r: bufio.NewReaderSize(r, 1<<16)}
+}
+
+// Read returns the next position, or io.EOF at the end of the stream
+// (io.ErrUnexpectedEOF if it ends partway through a record).
+func (pr *PackedReader) Read() (PackedPosition, error) {
+	if _, err := io.ReadFull(pr.r, pr.buf[:]); err != nil {
+		return PackedPosition{}, err
+	}
+	return DecodePackedPosition(pr.buf[:]), nil
+}
+
+// PackedWriter writes packed positions to a stream, buffered: call Flush
+// when done.
+type PackedWriter struct {
+	w   *bufio.Writer
+	buf [PackedSize]byte
+}
+
+// NewPackedWriter returns a PackedWriter writing to w.
+func NewPackedWriter(w io.Writer) *PackedWriter {
+	return &PackedWriter{w: bufio.NewWriterSize(w, 1<<16)}
+}
+
+func (pw *PackedWriter) Write(p *PackedPosition) error {
+	p.Encode(pw.buf[:])
+	_, err := pw.w.Write(pw.buf[:])
+	return err
+}
+
+// Flush writes any buffered positions to the underlying writer.
+func (pw *PackedWriter) Flush() error {
+	return pw.w.Flush()
+}
+
+// WritePackedPositions writes positions to w, encoded back to back.
+func WritePackedPositions(w io.Writer, positions []PackedPosition) error {
+	buf := make([]byte, PackedSize*len(positions))
+	for i := range positions {
+		positions[i].Encode(buf[i*PackedSize:])
+	}
+	_, err := w.Write(buf)
+	return err
+}
@@ -2,6 +2,8 @@
 
 package engine
 
+import "math/bits"
+
 type Position struct {
 	// Turn: 0=white 1=black
 	Turn uint8
@@ -38,15 +40,22 @@ type Position struct {
 	// past states
 	History []State
 
-	// Net is the immutable network shared across positions; Acc is this
-	// position's mutable per-perspective evaluation state.
-	Net *Network
-	Acc Accumulator
+	// Net is the immutable network shared across positions; Accs holds this
+	// position's per-ply evaluation state (see nnue_stack.go).
+	Net  *Network
+	Accs *AccumulatorStack
 
 	// Hash is this position's Zobrist key, maintained incrementally by
 	// PutPiece/RemovePiece and DoMove/UndoMove. Used for repetition
 	// detection (IsRepetition).
 	Hash uint64
+
+	// PawnHash is the Zobrist key of the pawns alone, and MaterialKey a key
+	// of just how many of each piece there are (see MaterialKeys), both
+	// maintained incrementally alongside Hash. They index the search's
+	// correction history tables.
+	PawnHash    uint64
+	MaterialKey uint64
 }
 
 type State struct {
@@ -70,25 +79,27 @@ func StartingPosition() Position {
 }
 
 // Clone returns a deep copy. Position must not be copied by plain assignment
-// (`p2 := p1` / passing by value) -- Acc and History alias mutable state via
+// (`p2 := p1` / passing by value) -- Accs and History alias mutable state via
 // slices, so a plain copy shares them with the original. Net is the sole
 // exception: it's immutable, so sharing the pointer is safe.
 func (pos *Position) Clone() Position {
 	clone := *pos
-	clone.Acc = pos.Acc.Clone()
+	clone.Accs = NewAccumulatorStack()
 	clone.History = append([]State(nil), pos.History...)
 	return clone
 }
 
+// SetNetwork switches pos to evaluating with net, discarding its
+// accumulators.
+func (pos *Position) SetNetwork(net *Network) {
+	pos.Net = net
+	pos.Accs = NewAccumulatorStack()
+}
+
 func (pos *Position) PutPiece(sq Square, piece uint8, color uint8) {
 	sqBB := Bitboard(1 << sq)
 	pos.Pieces[color][piece] |= sqBB
-
-	// nnue operations come before this adjustment by 10 (0-5 expected; FeatureIndex performs adjustment by 6)
-	fWhite := FeatureIndex(White, color, piece, sq)
-	fBlack := FeatureIndex(Black, color, piece, sq)
-	pos.Acc.Add(pos.Net, fWhite, White)
-	pos.Acc.Add(pos.Net, fBlack, Black)
+	count := bits.OnesCount64(uint64(pos.Pieces[color][piece]))
 
 	if color == Black {
 		piece += 10
@@ -98,6 +109,8 @@ func (pos *Position) PutPiece(sq Square, piece uint8, color uint8) {
 	pos.Sides[color] |= sqBB
 
 	pos.Hash ^= pieceSqKey(sq, piece)
+	pos.PawnHash ^= pawnSqKey(sq, piece)
+	pos.MaterialKey ^= materialKey(piece, count-1)
 }
 
 func (pos *Position) PutPiecesBB(pieces [2][6]Bitboard) {
@@ -105,8 +118,9 @@ func (pos *Position) PutPiecesBB(pieces [2][6]Bitboard) {
 	// .. well this whole function is for testing purposes only
 	if pos.Net == nil {
 		pos.Net = defaultNet
-		pos.Acc = NewAccumulator(pos.Net)
 	}
+	// the board is rebuilt without moves, so the accumulators start over
+	pos.Accs = NewAccumulatorStack()
 
 	for sq := SquareA1; sq <= SquareH8; sq++ {
 		// RemovePiece panics on an already-empty square (NoColor indexes
@@ -127,8 +141,11 @@ func (pos *Position) PutPiecesBB(pieces [2][6]Bitboard) {
 
 // MovePiece relocates a piece from one square to another (no capture, no
 // promotion), equivalent to RemovePiece(from) followed by PutPiece(to, piece,
-// color) but doing the NNUE accumulator update as a single fused AddSub pass
-// per perspective instead of two separate passes.
+// color) but without the intermediate empty-square bookkeeping.
+//
+// None of the piece operations touch the accumulators: DoMove records the
+// pieces a move changes on the accumulator stack, and positions set up
+// piece by piece (FromFEN, PutPiecesBB) start a fresh stack.
 func (pos *Position) MovePiece(from, to Square, piece, color uint8) {
 	fromBB := Bitboard(1 << from)
 	toBB := Bitboard(1 << to)
@@ -147,19 +164,12 @@ func (pos *Position) MovePiece(from, to Square, piece, color uint8) {
 
 	pos.Hash ^= pieceSqKey(from, boardPieceFrom)
 	pos.Hash ^= pieceSqKey(to, boardPieceTo)
-
-	fWhiteFrom := FeatureIndex(White, color, piece, from)
-	fBlackFrom := FeatureIndex(Black, color, piece, from)
-	fWhiteTo := FeatureIndex(White, color, piece, to)
-	fBlackTo := FeatureIndex(Black, color, piece, to)
-	pos.Acc.AddSub(pos.Net, fWhiteTo, fWhiteFrom, White)
-	pos.Acc.AddSub(pos.Net, fBlackTo, fBlackFrom, Black)
+	pos.PawnHash ^= pawnSqKey(from, boardPieceFrom) ^ pawnSqKey(to, boardPieceTo)
 }
 
 // CapturePiece relocates a piece from one square to another while capturing
 // an enemy piece on the destination square -- equivalent to RemovePiece(from)
-// + RemovePiece(to) + PutPiece(to, piece, color) but doing the NNUE
-// accumulator update as a single fused AddSubSub pass per perspective.
+// + RemovePiece(to) + PutPiece(to, piece, color).
 func (pos *Position) CapturePiece(from, to Square, piece, color, capturedPiece uint8) {
 	theirColor := color ^ 1
 	fromBB := Bitboard(1 << from)
@@ -184,21 +194,12 @@ func (pos *Position) CapturePiece(from, to Square, piece, color, capturedPiece u
 	pos.Hash ^= pieceSqKey(from, boardPieceFrom)
 	pos.Hash ^= pieceSqKey(to, boardPieceTo)
 	pos.Hash ^= pieceSqKey(to, newBoardPieceTo)
-
-	fWhiteFrom := FeatureIndex(White, color, piece, from)
-	fBlackFrom := FeatureIndex(Black, color, piece, from)
-	fWhiteTo := FeatureIndex(White, color, piece, to)
-	fBlackTo := FeatureIndex(Black, color, piece, to)
-	fWhiteCaptured := FeatureIndex(White, theirColor, capturedPiece, to)
-	fBlackCaptured := FeatureIndex(Black, theirColor, capturedPiece, to)
-
-	pos.Acc.AddSubSub(pos.Net, fWhiteTo, fWhiteFrom, fWhiteCaptured, White)
-	pos.Acc.AddSubSub(pos.Net, fBlackTo, fBlackFrom, fBlackCaptured, Black)
+	pos.PawnHash ^= pawnSqKey(from, boardPieceFrom) ^ pawnSqKey(to, boardPieceTo) ^ pawnSqKey(to, newBoardPieceTo)
+	pos.MaterialKey ^= materialKey(boardPieceTo, bits.OnesCount64(uint64(pos.Pieces[theirColor][capturedPiece])))
 }
 
 // UncapturePiece is the inverse of CapturePiece: it moves a piece from `to`
-// back to `from` and restores a previously-captured enemy piece on `to`,
-// fusing the accumulator update (AddAddSub) into one pass per perspective.
+// back to `from` and restores a previously-captured enemy piece on `to`.
 func (pos *Position) UncapturePiece(from, to Square, piece, color, capturedPiece uint8) {
 	theirColor := color ^ 1
 	fromBB := Bitboard(1 << from)
@@ -226,16 +227,8 @@ func (pos *Position) UncapturePiece(from, to Square, piece, color, capturedPiece
 	pos.Hash ^= pieceSqKey(to, boardPieceTo)
 	pos.Hash ^= pieceSqKey(from, newBoardPieceFrom)
 	pos.Hash ^= pieceSqKey(to, newBoardPieceTo)
-
-	fWhiteFrom := FeatureIndex(White, color, piece, from)
-	fBlackFrom := FeatureIndex(Black, color, piece, from)
-	fWhiteTo := FeatureIndex(White, color, piece, to)
-	fBlackTo := FeatureIndex(Black, color, piece, to)
-	fWhiteCaptured := FeatureIndex(White, theirColor, capturedPiece, to)
-	fBlackCaptured := FeatureIndex(Black, theirColor, capturedPiece, to)
-
-	pos.Acc.AddAddSub(pos.Net, fWhiteFrom, fWhiteCaptured, fWhiteTo, White)
-	pos.Acc.AddAddSub(pos.Net, fBlackFrom, fBlackCaptured, fBlackTo, Black)
+	pos.PawnHash ^= pawnSqKey(to, boardPieceTo) ^ pawnSqKey(from, newBoardPieceFrom) ^ pawnSqKey(to, newBoardPieceTo)
+	pos.MaterialKey ^= materialKey(newBoardPieceTo, bits.OnesCount64(uint64(pos.Pieces[theirColor][capturedPiece]))-1)
 }
 
 func (pos *Position) RemovePiece(sq Square) {
@@ -251,15 +244,11 @@ func (pos *Position) RemovePiece(sq Square) {
 	pos.Sides[color] &^= sqBB
 	if color != NoColor {
 		pos.Pieces[color][piece] &^= sqBB
+		pos.MaterialKey ^= materialKey(boardPiece, bits.OnesCount64(uint64(pos.Pieces[color][piece])))
 	}
 
 	pos.Hash ^= pieceSqKey(sq, boardPiece)
-
-	// nnue operations come after this adjustment by 10 (0-5 expected; FeatureIndex performs adjustment by 6)
-	fWhite := FeatureIndex(White, color, piece, sq)
-	fBlack := FeatureIndex(Black, color, piece, sq)
-	pos.Acc.Remove(pos.Net, fWhite, White)
-	pos.Acc.Remove(pos.Net, fBlack, Black)
+	pos.PawnHash ^= pawnSqKey(sq, boardPiece)
 }
 
 func (pos *Position) Equals(otherPos Position) bool {
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseSAN returns the legal move that san, a move in standard algebraic
+// notation as PGN files write them ("Nf3", "exd5", "e8=Q+", "O-O"),
+// describes in pos. Check and annotation suffixes are ignored; a move that
+// matches no legal move, or more than one, is an error.
+func (pos *Position) ParseSAN(san string) (Move, error) {
+	s := strings.TrimRight(san, "+#!?")
+	switch s {
+	case "O-O", "0-0", "O-O-O", "0-0-0":
+		file := FileG
+		if len(s) == 5 {
+			file = FileC
+		}
+		for _, move := range pos.LegalMoves() {
+			if move.IsCastling() && FileOf(move.To()) == file {
+				return move, nil
+			}
+		}
+		return 0, fmt.Errorf("illegal move %q", san)
+	}
+
+	piece := Pawn
+	if s != "" && strings.IndexByte("NBRQK", s[0]) >= 0 {
+		piece = CharToPiece[s[0]+'a'-'A']
+		s = s[1:]
+	}
+	promotion := NoPiece
+	if i := strings.IndexByte(s, '='); i >= 0 && i == len(s)-2 {
+		promotion, s = CharToPiece[s[i+1]|0x20], s[:i]
+	} else if piece == Pawn && s != "" && strings.IndexByte("NBRQ", s[len(s)-1]) >= 0 {
+		promotion, s = CharToPiece[s[len(s)-1]|0x20], s[:len(s)-1]
+	}
+	if len(s) < 2 || !isFile(s[len(s)-2]) || !isRank(s[len(s)-1]) {
+		return 0, fmt.Errorf("invalid move %q", san)
+	}
+	to := NewSquareFromStr(s[len(s)-2:])
+
+	// what's left disambiguates: a file, a rank or both, and maybe an 'x'
+	fromFile, fromRank := -1, -1
+	for _, c := range []byte(strings.TrimSuffix(s[:len(s)-2], "x")) {
+		switch {
+		case isFile(c):
+			fromFile = int(c - 'a')
+		case isRank(c):
+			fromRank = int(c - '1')
+		default:
+			return 0, fmt.Errorf("invalid move %q", san)
+		}
+	}
+
+	var found Move
+	matches := 0
+	for _, move := range pos.LegalMoves() {
+		from := move.From()
+		if _, p := pos.GetSquare(from); p != piece || move.To() != to || move.IsCastling() {
+			continue
+		}
+		if (fromFile >= 0 && int(FileOf(from)) != fromFile) || (fromRank >= 0 && int(RankOf(from)) != fromRank) {
+			continue
+		}
+		if move.IsPromotion() != (promotion != NoPiece) || (move.IsPromotion() && move.Promotion() != promotion) {
+			continue
+		}
+		found = move
+		matches++
+	}
+	switch matches {
+	case 0:
+		return 0, fmt.Errorf("illegal move %q", san)
+	case 1:
+		return found, nil
+	}
+	return 0, fmt.Errorf("ambiguous move %q", san)
+}
+
+func isFile(c byte) bool { return c >= 'a' && c <= 'h' }
+func isRank(c byte) bool { return c >= '1' && c <= '8' }
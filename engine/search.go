@@ -8,7 +8,6 @@ import (
 const InfiniteDepth = 100000                       // arbitrary large number for infinite depth
 const InfiniteMovetime = 600000 * time.Millisecond // arbitrary large number for infinite movetime
 const MaxMovetime = 2000                           // max movetime for any move if unspecified
-const MaxQuiescenceDepth = 8
 
 // MateScoreThreshold: any score at least this close to Infinity is a mate
 // score (see the mate-distance comment on alphaBetaInner), not a real
@@ -37,6 +36,10 @@ func mateInfo(score int32) (movesToMate int32, isMate bool) {
 
 const NodeReportInterval = 32768
 
+// noEval marks an evalStack slot with no static eval (the node was in
+// check, so stand-pat-style static reasoning doesn't apply there).
+const noEval = -Infinity
+
 type Search struct {
 	Pos   Position
 	Nodes int
@@ -56,19 +59,69 @@ type Search struct {
 	// score field is mutable and irrelevant for identity comparison.
 	killers [MaxKillerPly][2]Move
 
-	// history accumulates a [side][from][to] weight on every quiet-move
-	// beta cutoff, weighted by depth^2 so cutoffs found deeper (more
-	// searched-out, so more reliable) count for more. Orders quiet moves
-	// that aren't killers at this ply. Unlike killers this isn't
-	// ply-indexed -- it's a search-wide "this from/to square pair tends to
-	// be strong" signal, not a "strong at this specific ply" one.
+	// history is the butterfly history: a [side][from][to] weight for
+	// quiet moves, raised on every quiet-move beta cutoff and lowered for
+	// the quiets searched before it that didn't cut off (see
+	// updateCutoffHistories), with gravity keeping it bounded. Unlike
+	// killers this isn't ply-indexed -- it's a search-wide "this from/to
+	// square pair tends to be strong" signal, not a "strong at this
+	// specific ply" one.
 	history [2][64][64]int32
 
+	// contHist is continuation history: like history, but keyed by the
+	// (piece, to) of the move played one ([0]) or two ([1]) plies earlier
+	// as well as the current move's own (piece, to) -- "after that move,
+	// this reply tends to be good". Captures follow-up patterns the
+	// context-free butterfly table can't.
+	contHist [2][12][64][12][64]int16
+
+	// counterMoves holds, per (piece, to) of the previous move, the quiet
+	// reply that last refuted it.
+	counterMoves [12][64]Move
+
+	// captureHist is history for captures/promotions, keyed by moving
+	// piece, destination and victim type (NoPiece for a quiet
+	// promotion). Breaks ties in MVV-LVA ordering.
+	captureHist [12][64][7]int16
+
+	// pawnCorrHist and materialCorrHist are the correction history
+	// tables (see correction.go), per side to move, indexed by
+	// PawnHash/MaterialKey modulo corrHistSize.
+	pawnCorrHist     [2][corrHistSize]int32
+	materialCorrHist [2][corrHistSize]int32
+
+	// moveStack records the move played at each ply of the current path,
+	// for continuation history and countermove lookups by the plies below.
+	moveStack [MaxKillerPly]pieceTo
+
+	// evalStack holds the static eval of each node on the current path,
+	// indexed by ply (noEval where none was computed -- in check, or past
+	// MaxKillerPly). Comparing a node's eval against its own side's
+	// previous node two plies up gives the "improving" signal that
+	// scales how aggressively alphaBetaInner's forward pruning is applied.
+	evalStack [MaxKillerPly]int32
+
 	// limits
 	StartTime time.Time
 	TimeLimit time.Duration
 	MaxDepth  int
 
+	// NodeLimit, if nonzero, stops the search once it has searched this
+	// many nodes (UCI `go nodes N`), independently of TimeLimit. In a Lazy
+	// SMP search it's a budget for every thread's nodes together (see
+	// sharedNodes), not for each thread's.
+	NodeLimit int
+
+	// MateLimit, if nonzero, puts Search in mate-finding mode (UCI
+	// `go mate N`): iterative deepening stops as soon as a completed depth
+	// proves a mate for the side to move in MateLimit moves or fewer.
+	MateLimit int
+
+	// noTimeLimit switches off every check of the clock, TimeLimit
+	// ignored, so that nothing about the search depends on how fast the
+	// machine is (deterministic mode; see prepareDeterministic).
+	noTimeLimit bool
+
 	// timedOut is set once checkTimeUp first detects the budget has been
 	// exceeded, and stays set for the rest of this Search() call. Sticky so
 	// every frame on the way back up the call stack can bail out on a cheap
@@ -81,6 +134,47 @@ type Search struct {
 	// than running out their own full time budget for no benefit.
 	stopSignal *int32
 
+	// sharedNodes, if set, counts the nodes of every thread of a
+	// node-limited Lazy SMP search together, which NodeLimit is checked
+	// against instead of Nodes. Threads publish to it in batches of
+	// sharedNodesInterval (sharedFrom being how many of their Nodes they
+	// have published, sharedSeen the total they last saw) rather than on
+	// every node, which would have every thread writing the same cache
+	// line all the time. The limit can therefore be overshot by up to a
+	// couple of batches per thread.
+	sharedNodes *int64
+	sharedFrom  int
+	sharedSeen  int
+
+	// contempt is this search's draw score from the root side's point of
+	// view, negated, and contemptKey separates its TT entries from those
+	// of searches with a different one (see initContempt).
+	contempt    int32
+	contemptKey uint64
+
+	// threadIndex is this search's Lazy SMP thread number: 0 for the main
+	// thread (and any single-threaded search), 1.. for helpers, which use
+	// it to diversify their iterative deepening (see startDepth/skipDepth
+	// in smp.go).
+	threadIndex int
+
+	// completedDepth is the deepest iteration Search has fully finished,
+	// i.e. the depth its current best move/score come from. Used for Lazy
+	// SMP's thread voting.
+	completedDepth int
+
+	// TotalNodes is Nodes summed over every thread of the last
+	// SearchLazySMP call (just Nodes when single-threaded).
+	TotalNodes int
+
+	// tt is the transposition table the search uses: sharedTT unless it's
+	// set before Init (a datagen SelfPlayer's own; see datagen.go).
+	tt *ttTable
+
+	// Trace, if set, records the tree the search walks (see trace.go).
+	// Only the main thread of a Lazy SMP search is traced.
+	Trace *Tracer
+
 	// silent suppresses UciInfo output. Set on Lazy SMP helper threads
 	// (smp.go) -- only the main thread's progress/PV is meaningful UCI
 	// output; helpers exist purely to enrich the shared TT.
@@ -94,6 +188,10 @@ func (search *Search) SetStopSignal(stop *int32) {
 	search.stopSignal = stop
 }
 
+// sharedNodesInterval is how many nodes a Lazy SMP thread searches between
+// publishing its node count (see sharedNodes). A power of two.
+const sharedNodesInterval = 1024
+
 // checkTimeUp reports whether the search has exceeded its time budget.
 // Checked periodically (every 2048 nodes, via the low bits of Nodes) rather
 // than on every node -- time.Since on every node would itself be a
@@ -109,7 +207,20 @@ func (search *Search) checkTimeUp() bool {
 		search.timedOut = true
 		return true
 	}
-	if search.Nodes&2047 == 0 && time.Since(search.StartTime) > search.TimeLimit {
+	if search.NodeLimit > 0 {
+		nodes := search.Nodes
+		if search.sharedNodes != nil {
+			if search.Nodes&(sharedNodesInterval-1) == 0 {
+				search.sharedSeen = int(atomic.AddInt64(search.sharedNodes, int64(search.Nodes-search.sharedFrom)))
+				search.sharedFrom = search.Nodes
+			}
+			nodes = search.sharedSeen + search.Nodes - search.sharedFrom
+		}
+		if nodes >= search.NodeLimit {
+			search.timedOut = true
+		}
+	}
+	if !search.noTimeLimit && search.Nodes&2047 == 0 && time.Since(search.StartTime) > search.TimeLimit {
 		search.timedOut = true
 	}
 	return search.timedOut
@@ -136,6 +247,9 @@ func TimeLimit(pos *Position, command *UciGoMessage) time.Duration {
 
 func (search *Search) Init(pos *Position) {
 	search.Pos = pos.Clone()
+	if search.tt == nil {
+		search.tt = &sharedTT
+	}
 }
 
 // based on negamax (flip sign), each player maximizes their own score
@@ -148,20 +262,37 @@ func (search *Search) Search() (int32, Move) {
 	bestScore := -Infinity
 
 	search.StartTime = time.Now()
+	search.initContempt()
 
 	moveList := GenMoves(&search.Pos, BB_Full)
 	ScoreMoves(&search.Pos, &moveList)
 	OrderMoves(&search.Pos, &moveList)
 
-	for depth := 1; depth <= search.MaxDepth; depth++ {
+	// the root's static eval, for its children's improving checks:
+	// corrected like every other node's (the TT gets the raw one, as
+	// everywhere)
+	rootEval := noEval
+	search.evalStack[0] = noEval
+	if search.Pos.Checkers(search.Pos.Turn) == 0 {
+		rootEval = Evaluate(&search.Pos)
+		search.evalStack[0] = search.correctedEval(rootEval)
+	}
+
+	search.completedDepth = 0
+	for depth := search.startDepth(); depth <= search.MaxDepth; depth++ {
+		if search.skipDepth(depth) {
+			continue
+		}
+
 		alpha := -Infinity
 		beta := Infinity
+		search.traceIteration(depth, alpha, beta)
 
 		// Put the previous iteration's best move (stored by this same loop,
 		// one depth ago) first -- gives PV-move-first ordering across
 		// iterative-deepening iterations, not just within a single
 		// alphaBetaInner call.
-		if entry, ok := TTProbe(search.Pos.Hash); ok {
+		if entry, ok := search.tt.probe(search.ttKey()); ok {
 			orderMoveFirst(&moveList, entry.Move)
 		}
 
@@ -175,8 +306,11 @@ func (search *Search) Search() (int32, Move) {
 				continue
 			}
 
+			search.pushMove(move, 0)
 			search.Pos.DoMove(move)
+			search.traceEnter(move, 1, depth-1, -beta, -alpha, 0)
 			score := -search.alphaBetaInner(-beta, -alpha, depth-1, 1)
+			search.traceExit(-score)
 			search.Pos.UndoMove(move)
 
 			// search.timedOut means this move's score is the checkTimeUp
@@ -196,7 +330,7 @@ func (search *Search) Search() (int32, Move) {
 				alpha = score
 			}
 
-			if time.Since(search.StartTime) > search.TimeLimit {
+			if !search.noTimeLimit && time.Since(search.StartTime) > search.TimeLimit {
 				timedOut = true
 				break
 			}
@@ -222,44 +356,107 @@ func (search *Search) Search() (int32, Move) {
 				// finish comparing every root move). Stored so the next
 				// iteration's probe above can order this move first.
 				if !timedOut {
-					TTStore(search.Pos.Hash, bestMove, ScoreToTT(bestScore, 0), depth, BoundExact)
+					search.tt.store(search.ttKey(), bestMove, ScoreToTT(bestScore, 0), rootEval, depth, BoundExact)
 				}
 
 				// Reported once per completed depth, with that depth's own
 				// final score -- not per move, and not a stale score left
 				// over from the previous depth.
-if !search.silent {
-					infoScore := bestScore
-					movesToMate, isMate := mateInfo(bestScore)
-					if isMate {
-						infoScore = movesToMate
-					}
-					UciInfo(UciInfoMessage{
-						depth:    depth,
-						hasDepth: true,
-						score:    infoScore,
-						hasScore: true,
-						isMate:   isMate,
-						nodes:    search.Nodes,
-						hasNodes: true,
-					})
+				if !search.silent {
+					uciInfoDepth(depth, bestScore, search.Nodes)
 				}
 			}
 		}
+		if !timedOut && bestMoveCurr != Move(0) {
+			search.completedDepth = depth
+		}
+		if search.Trace != nil {
+			search.Trace.Root.Score = bestScoreCurr
+		}
 
 		if timedOut {
 			break
 		}
+
+		if search.MateLimit > 0 {
+			if movesToMate, isMate := mateInfo(bestScore); isMate && movesToMate > 0 && int(movesToMate) <= search.MateLimit {
+				break
+			}
+		}
 	}
 
 	return bestScore, bestMove
 }
 
+// uciInfoDepth reports a completed depth's score, in moves to mate if it is
+// one.
+func uciInfoDepth(depth int, score int32, nodes int) {
+	infoScore := score
+	movesToMate, isMate := mateInfo(score)
+	if isMate {
+		infoScore = movesToMate
+	}
+	UciInfo(UciInfoMessage{
+		depth:    depth,
+		hasDepth: true,
+		score:    infoScore,
+		hasScore: true,
+		isMate:   isMate,
+		nodes:    nodes,
+		hasNodes: true,
+	})
+}
+
+// PV reconstructs the principal variation of the last search by following
+// TT moves from the root, stopping at the first position with no entry, an
+// entry whose move isn't legal there (overwritten by a colliding position),
+// a draw, or after maxLen moves. The TT isn't a triangular PV table: the
+// tail can be shorter than the search depth, or (rarely) run past it from
+// entries left by an earlier iteration.
+func (search *Search) PV(maxLen int) []Move {
+	pos := search.Pos.Clone()
+	var pv []Move
+	for len(pv) < maxLen {
+		entry, ok := search.tt.probe(pos.Hash ^ search.contemptKey)
+		if !ok || entry.Move == Move(0) {
+			break
+		}
+		move := entry.Move
+		if !isLegalMove(&pos, move) {
+			break
+		}
+		pos.DoMove(move)
+		pv = append(pv, move)
+		if pos.IsDraw(len(pv)) {
+			break
+		}
+	}
+	return pv
+}
+
+// isLegalMove reports whether move (compared on its low 16 bits) is one of
+// pos's legal moves.
+func isLegalMove(pos *Position, move Move) bool {
+	for _, legal := range pos.LegalMoves() {
+		if legal&0xffff == move&0xffff {
+			return true
+		}
+	}
+	return false
+}
+
 // ply mirrors alphaBetaInner's ply: the number of plies from the search
 // root, needed so a checkmate found here scores consistently with one found
 // in alphaBetaInner (see the mate-distance comment there).
 func (search *Search) Quiescence(alpha, beta int32, qdepth int, ply int) int32 {
-	if qdepth > MaxQuiescenceDepth {
+	inCheck := search.Pos.Checkers(search.Pos.Turn) != 0
+
+	// Past MaxQuiescenceDepth only check evasions are searched: a position
+	// in check has no meaningful static eval, so it's resolved however deep
+	// that takes. Sequences of checks are finite in practice (quiet checks
+	// are only generated at the first ply, below), but ply is still capped
+	// as a backstop, since every per-ply stack is sized by MaxKillerPly.
+	if (qdepth > MaxQuiescenceDepth && !inCheck) || ply >= MaxKillerPly-1 {
 		return Evaluate(&search.Pos)
 	}
 
@@ -267,15 +464,71 @@ func (search *Search) Quiescence(alpha, beta int32, qdepth int, ply int) int32 {
 		return 0
 	}
 
-	inCheck := search.Pos.Checkers(search.Pos.Turn) != 0
+	// Captures lead to insufficient material, and quiet checks and
+	// evasions can repeat or run out the fifty-move clock, so quiescence
+	// needs the same draw detection as alphaBetaInner.
+	if search.Pos.IsDraw(ply) {
+		return search.drawScore(ply)
+	}
+
+	alphaOrig := alpha
+
+	// Quiescence shares the TT with the main search, under its own depth
+	// sentinels (see TTDepthQS): any entry that searched at least what this
+	// node will -- quiescence's own or a real search's -- is deep enough to
+	// cut off here.
+	withChecks := qdepth == 0
+	ttDepth := TTDepthQSNoChecks
+	if withChecks {
+		ttDepth = TTDepthQS
+	}
+	var ttMove Move
+	ttEntry, ttHit := search.tt.probe(search.ttKey())
+	if ttHit {
+		ttMove = ttEntry.Move
+	}
+	if ttHit && int(ttEntry.Depth) >= ttDepth {
+		s := ScoreFromTT(ttEntry.Score, ply)
+		switch {
+		case ttEntry.Bound == BoundExact:
+			return s
+		case ttEntry.Bound == BoundLower && s >= beta:
+			return s
+		case ttEntry.Bound == BoundUpper && s <= alpha:
+			return s
+		}
+	}
 
 	// Unlike a capture, check can't be declined -- taking a stand-pat floor
 	// while in check can hide that the position is actually lost (or won)
 	// tactically, so it's skipped entirely here; every evasion must be
-	// searched instead.
+	// searched instead. staticEval is the raw eval, as stored in the TT;
+	// stand pat starts from its corrected form (see correctedEval).
+	staticEval := noEval
 	if !inCheck {
-		standPat := Evaluate(&search.Pos)
+		if ttHit && ttEntry.Eval != noEval {
+			staticEval = ttEntry.Eval
+		} else {
+			staticEval = Evaluate(&search.Pos)
+		}
+
+		// A TT bound is search-backed information about this exact
+		// position, so where it's on the right side of the static eval it
+		// makes a better stand-pat estimate: a lower bound above the eval
+		// says "at least this much", an upper bound below it says "no
+		// more than this".
+		standPat := search.correctedEval(staticEval)
+		if ttHit {
+			s := ScoreFromTT(ttEntry.Score, ply)
+			if (ttEntry.Bound == BoundLower && s > standPat) || (ttEntry.Bound == BoundUpper && s < standPat) {
+				standPat = s
+			}
+		}
+
 		if standPat >= beta {
+			if !ttHit {
+				search.tt.store(search.ttKey(), 0, ScoreToTT(standPat, ply), staticEval, ttDepth, BoundLower)
+			}
 			return beta
 		}
 		if standPat > alpha {
@@ -287,12 +540,14 @@ func (search *Search) Quiescence(alpha, beta int32, qdepth int, ply int) int32 {
 	if inCheck {
 		moveList = GenMoves(&search.Pos, BB_Full)
 	} else {
-		moveList = GenMoves(&search.Pos, search.Pos.Sides[search.Pos.Turn^1]) // only captures
+		moveList = GenQuiescenceMoves(&search.Pos, withChecks)
 	}
 
-	ScoreMoves(&search.Pos, &moveList)
+	search.scoreMoves(&moveList, ply)
 	OrderMoves(&search.Pos, &moveList)
+	orderMoveFirst(&moveList, ttMove)
 
+	var bestMove Move
 	hasLegal := false
 	for i := uint8(0); i < moveList.Count; i++ {
 		move := moveList.Moves[i]
@@ -303,15 +558,20 @@ func (search *Search) Quiescence(alpha, beta int32, qdepth int, ply int) int32 {
 
 		search.Nodes++
 
+		search.pushMove(move, ply)
 		search.Pos.DoMove(move)
 		score := -search.Quiescence(-beta, -alpha, qdepth+1, ply+1)
 		search.Pos.UndoMove(move)
 
 		if score >= beta {
+			if !search.timedOut {
+				search.tt.store(search.ttKey(), move, ScoreToTT(beta, ply), staticEval, ttDepth, BoundLower)
+			}
 			return beta
 		}
 		if score > alpha {
 			alpha = score
+			bestMove = move
 		}
 	}
 
@@ -321,9 +581,33 @@ func (search *Search) Quiescence(alpha, beta int32, qdepth int, ply int) int32 {
 		return -(Infinity - int32(ply))
 	}
 
+	if !search.timedOut {
+		bound := BoundExact
+		if alpha <= alphaOrig {
+			bound = BoundUpper
+		}
+		search.tt.store(search.ttKey(), bestMove, ScoreToTT(alpha, ply), staticEval, ttDepth, bound)
+	}
+
 	return alpha
 }
 
+// isImproving reports whether staticEval is better than prevEval, the
+// same side's static eval at its previous turn (two plies up). If so, the
+// position is trending our way and a fail-high is more plausible, so
+// reverse futility prunes with a smaller margin; if not, late move pruning
+// gives up on quiets sooner and LMR reduces more. An unknown prevEval
+// (that node was in check) counts as improving. In check there's no
+// staticEval (noEval) and so no trend: never improving -- though it makes
+// no difference there, since RFP, razoring, LMP and LMR are all skipped in
+// check anyway.
+func isImproving(staticEval, prevEval int32) bool {
+	if staticEval == noEval {
+		return false
+	}
+	return prevEval == noEval || staticEval > prevEval
+}
+
 // hasNonPawnMaterial reports whether color has any knight/bishop/rook/queen
 // on the board. Used to guard null-move pruning against zugzwang: in bare
 // king-and-pawn endgames, passing can be strictly better than any legal
@@ -344,32 +628,113 @@ func (search *Search) alphaBetaInner(alpha, beta int32, depth int, ply int) int3
 		return 0
 	}
 
-	// Treat the first repetition as a draw rather than waiting for a literal
-	// threefold (standard practice -- see Position.IsRepetition). Checked
-	// before move generation so a repeated node also skips that work.
-	if search.Pos.IsRepetition() {
-		return 0
+	// Fifty-move rule, insufficient material and repetitions (see
+	// Position.IsDraw for how in-tree repetitions differ from ones reaching
+	// back into the game). Checked before move generation so a drawn node
+	// also skips that work.
+	if search.Pos.IsDraw(ply) {
+		search.tracePrune(PruneDraw)
+		return search.drawScore(ply)
+	}
+
+	// Mate distance pruning: the best this node could possibly score is
+	// mating on the very next ply, and the worst is being mated right
+	// here -- so clamp the window to that range. Once a mate has been
+	// found elsewhere in the tree, alpha/beta already sit at a mate score,
+	// and any node too deep to beat it collapses to an empty window here
+	// instead of being searched for a mate that could only be longer.
+	alpha = max(alpha, -(Infinity - int32(ply)))
+	beta = min(beta, Infinity-int32(ply)-1)
+	if alpha >= beta {
+		search.tracePrune(PruneMateDistance)
+		return alpha
 	}
 
 	alphaOrig := alpha
 
 	var ttMove Move
-	if entry, ok := TTProbe(search.Pos.Hash); ok {
+	ttEval := noEval
+	if entry, ok := search.tt.probe(search.ttKey()); ok {
 		ttMove = entry.Move
+		ttEval = entry.Eval
 		if int(entry.Depth) >= depth {
 			s := ScoreFromTT(entry.Score, ply)
-			switch {
-			case entry.Bound == BoundExact:
-				return s
-			case entry.Bound == BoundLower && s >= beta:
-				return s
-			case entry.Bound == BoundUpper && s <= alpha:
+			if entry.Bound == BoundExact ||
+				(entry.Bound == BoundLower && s >= beta) ||
+				(entry.Bound == BoundUpper && s <= alpha) {
+				search.traceTT(true, true)
 				return s
 			}
 		}
+		search.traceTT(true, false)
+	}
+
+	// Internal iterative reduction: with no hash move, this node's move
+	// ordering is at its worst (MVV-LVA/killers/history only), so a
+	// full-depth search here is both expensive and likely to be badly
+	// ordered. Search it one ply shallower instead -- if it matters, the
+	// next iteration comes back with a TT move from this reduced pass.
+	if ttMove == 0 && depth >= IIRMinDepth {
+		depth--
 	}
 
 	inCheckEarly := search.Pos.Checkers(search.Pos.Turn) != 0
+	pvNode := beta-alpha > 1
+
+	// Static eval for the forward-pruning decisions below. Skipped at the
+	// horizon (depth 0 goes straight to Quiescence, which evaluates for
+	// itself) and in check (no static reasoning is sound there). The TT
+	// keeps the raw eval; everything here uses it adjusted by correction
+	// history (see correctedEval).
+	rawEval := noEval
+	staticEval := noEval
+	if depth > 0 && !inCheckEarly {
+		if ttEval != noEval {
+			rawEval = ttEval
+		} else {
+			rawEval = Evaluate(&search.Pos)
+		}
+		staticEval = search.correctedEval(rawEval)
+	}
+	if ply < MaxKillerPly {
+		search.evalStack[ply] = staticEval
+	}
+
+	prevEval := noEval
+	if ply >= 2 && ply < MaxKillerPly {
+		prevEval = search.evalStack[ply-2]
+	}
+	improving := isImproving(staticEval, prevEval)
+
+	// Reverse futility pruning: at a shallow non-PV node, a static eval
+	// that already clears beta by a depth-scaled margin is very unlikely
+	// to be dragged back below beta by the opponent's best reply, so fail
+	// high on the static eval alone. Like null-move, not trusted near mate
+	// scores.
+	if !pvNode && staticEval != noEval && depth <= RFPMaxDepth &&
+		beta < MateScoreThreshold && beta > -MateScoreThreshold {
+		rfpDepth := int32(depth)
+		if improving {
+			rfpDepth--
+		}
+		if staticEval-RFPMargin*rfpDepth >= beta {
+			search.tracePrune(PruneReverseFutility)
+			return staticEval
+		}
+	}
+
+	// Razoring: the mirror image at the other end -- a static eval so far
+	// below alpha that only a capture sequence could possibly rescue the
+	// node. Let Quiescence decide: if even the tactics fail low, so does
+	// the node.
+	if !pvNode && staticEval != noEval && depth <= RazorMaxDepth &&
+		alpha > -MateScoreThreshold && staticEval+RazorMargin*int32(depth) < alpha {
+		score := search.Quiescence(alpha, alpha+1, 0, ply)
+		if score <= alpha {
+			search.tracePrune(PruneRazoring)
+			return score
+		}
+	}
 
 	// Null-move pruning: let the opponent move twice in a row (i.e. we do
 	// nothing) and search at reduced depth. If even a free move for the
@@ -381,20 +746,27 @@ func (search *Search) alphaBetaInner(alpha, beta int32, depth int, ply int) int3
 	// skipped in check (a null move can't escape check, so the reduced
 	// search would be meaningless) and near mate scores (verifying a mate
 	// score off a reduced, unverified search is unreliable).
-	if depth >= 3 && !inCheckEarly && beta < MateScoreThreshold && hasNonPawnMaterial(&search.Pos, search.Pos.Turn) {
-		const nullMoveReduction = 2
+	if depth >= NullMoveMinDepth && !inCheckEarly && beta < MateScoreThreshold && hasNonPawnMaterial(&search.Pos, search.Pos.Turn) {
+		if ply < MaxKillerPly {
+			search.moveStack[ply] = pieceTo{}
+		}
+		// clamped at the horizon: with a large NullMoveReduction (it's
+		// tunable) a shallow node would otherwise hand down a negative depth
+		nullDepth := max(depth-1-NullMoveReduction, 0)
 		prevEP := search.Pos.DoNullMove()
-		score := -search.alphaBetaInner(-beta, -beta+1, depth-1-nullMoveReduction, ply+1)
+		search.traceEnter(0, ply+1, nullDepth, -beta, -beta+1, 0)
+		score := -search.alphaBetaInner(-beta, -beta+1, nullDepth, ply+1)
+		search.traceExit(-score)
 		search.Pos.UndoNullMove(prevEP)
 		if score >= beta {
+			search.tracePrune(PruneNullMove)
 			return score
 		}
 	}
 
 	moveList := GenMoves(&search.Pos, BB_Full)
 
-	ScoreMoves(&search.Pos, &moveList)
-	search.scoreQuiets(&moveList, ply)
+	search.scoreMoves(&moveList, ply)
 	OrderMoves(&search.Pos, &moveList)
 	orderMoveFirst(&moveList, ttMove)
 
@@ -406,12 +778,13 @@ func (search *Search) alphaBetaInner(alpha, beta int32, depth int, ply int) int3
 			return -(Infinity - int32(ply))
 		} else {
 			// stalemate
-			return 0
+			return search.drawScore(ply)
 		}
 	}
 
-	if depth == 0 {
-		// return Evaluate(pos)
+	// the horizon; depth <= 0 rather than == 0, so that no reduction that
+	// overshoots can skip past it into an unbounded search
+	if depth <= 0 {
 		return search.Quiescence(alpha, beta, 0, ply)
 	}
 
@@ -430,16 +803,33 @@ func (search *Search) alphaBetaInner(alpha, beta int32, depth int, ply int) int3
 	// material-margin argument says nothing reliable about a nearby forced
 	// mate) and never applied to a node's first move (that's move ordering's
 	// best guess, and always gets searched for real).
-	const futilityMaxDepth = 3
-	var futilityMargin = [futilityMaxDepth + 1]int32{0, 150, 300, 450}
-
 	canFutilityPrune := false
-	if depth >= 1 && depth <= futilityMaxDepth && !inCheck &&
+	if depth >= 1 && depth <= FutilityMaxDepth && !inCheck &&
 		alpha > -MateScoreThreshold && beta < MateScoreThreshold {
-		staticEval := Evaluate(&search.Pos)
-		canFutilityPrune = staticEval+futilityMargin[depth] <= alpha
+		canFutilityPrune = staticEval+FutilityMargin*int32(depth) <= alpha
 	}
 
+	// Late move pruning: near the horizon, once enough moves have been
+	// tried, ordering has had its say -- the remaining quiets are the ones
+	// killers/history rated lowest, and are skipped without a search.
+	// Like RFP and razoring, never at a PV node, whose every move the
+	// principal variation might need; same mate-score gating as futility
+	// pruning.
+	canLateMovePrune := !pvNode && depth <= LMPMaxDepth && !inCheck && alpha > -MateScoreThreshold
+	lmpLimit := lmpThreshold(depth, improving)
+
+	prev1, prev2 := search.previousMoves(ply)
+
+	// ttCapture: the hash move (if it's actually among the generated moves
+	// -- orderMoveFirst put it first) is a capture/promotion.
+	ttCapture := ttMove != 0 && moveList.Count > 0 && moveList.Moves[0]&0xffff == ttMove&0xffff &&
+		!isQuietMove(&search.Pos, moveList.Moves[0])
+
+	// Moves searched so far without causing a cutoff, for the history
+	// malus on whichever move eventually does (see updateCutoffHistories).
+	var quietsTried, capturesTried [64]Move
+	numQuietsTried, numCapturesTried := 0, 0
+
 	bestScore := -Infinity
 	var bestMove Move
 	legalMoveNum := 0
@@ -453,24 +843,41 @@ func (search *Search) alphaBetaInner(alpha, beta int32, depth int, ply int) int3
 
 		isQuiet := isQuietMove(&search.Pos, move)
 
+		if canLateMovePrune && isQuiet && legalMoveNum > lmpLimit {
+			search.traceSkip(move, ply+1, depth-1, PruneLateMove)
+			continue
+		}
+
 		// Late Move Reductions: search moves that are unlikely to matter --
-		// late in the (MVV-LVA/killer/history-then-TT-move) ordering, quiet,
-		// and not while in check -- at reduced depth first. If a reduced
-		// search still beats alpha, it wasn't obviously bad, so re-search it
-		// at full depth before trusting the score. LeafMoveNum/depth
-		// thresholds are conservative (no PVS yet to lean on for ordering
-		// confidence).
+		// late in the (TT-move, MVV-LVA, killers/countermove, history)
+		// ordering, quiet, and not while in check -- at reduced depth
+		// first. The base amount grows with log(depth)*log(moveNumber)
+		// (see InitLMRTable), then gets adjusted for what we know about
+		// this node and move: PV nodes and killers reduce less, a node that
+		// isn't improving or whose TT move is a capture reduces more, and
+		// the combined history score nudges it either way.
 		reduction := 0
-		if depth >= 3 && legalMoveNum > 3 && !inCheck && isQuiet {
-			reduction = 1
-			if legalMoveNum > 6 {
-				reduction = 2
+		if depth >= LMRMinDepth && legalMoveNum > LMRMinMoveNum && !inCheck && isQuiet {
+			reduction = lmrBaseReduction(depth, legalMoveNum)
+			if pvNode {
+				reduction -= LMRPVAdjust
+			}
+			if !improving {
+				reduction += LMRImprovingAdjust
+			}
+			if ttCapture {
+				reduction += LMRTTCaptureAdjust
 			}
-			if reduction > depth-1 {
-				reduction = depth - 1
+			if search.isKiller(move, ply) {
+				reduction -= LMRKillerAdjust
 			}
+			_, piece := search.Pos.GetSquare(move.From())
+			hist := search.quietHistory(move, coloredPiece(search.Pos.Turn, piece), prev1, prev2)
+			reduction -= int(hist / LMRHistoryDivisor)
+			reduction = min(max(reduction, 0), depth-1)
 		}
 
+		search.pushMove(move, ply)
 		search.Pos.DoMove(move)
 
 		// The futility skip check needs the post-move position: a move
@@ -480,17 +887,34 @@ func (search *Search) alphaBetaInner(alpha, beta int32, depth int, ply int) int3
 		if canFutilityPrune && legalMoveNum > 1 && isQuiet &&
 			search.Pos.Checkers(search.Pos.Turn) == 0 {
 			search.Pos.UndoMove(move)
+			search.traceSkip(move, ply+1, depth-1, PruneFutility)
 			continue
 		}
 
+		// A reduced move has to earn a full search in stages: the reduced
+		// zero-window search beating alpha only says "maybe not bad", so
+		// it's re-verified at full depth (still zero-window, so cheap), and
+		// only a move that survives that too -- at a PV node, where an
+		// exact score inside (alpha, beta) matters -- gets the full window.
 		var score int32
 		if reduction > 0 {
+			search.traceEnter(move, ply+1, depth-1-reduction, -alpha-1, -alpha, reduction)
 			score = -search.alphaBetaInner(-alpha-1, -alpha, depth-1-reduction, ply+1)
+			search.traceExit(-score)
 			if score > alpha {
+				search.traceEnter(move, ply+1, depth-1, -alpha-1, -alpha, 0)
+				score = -search.alphaBetaInner(-alpha-1, -alpha, depth-1, ply+1)
+				search.traceExit(-score)
+			}
+			if score > alpha && score < beta && pvNode {
+				search.traceEnter(move, ply+1, depth-1, -beta, -alpha, 0)
 				score = -search.alphaBetaInner(-beta, -alpha, depth-1, ply+1)
+				search.traceExit(-score)
 			}
 		} else {
+			search.traceEnter(move, ply+1, depth-1, -beta, -alpha, 0)
 			score = -search.alphaBetaInner(-beta, -alpha, depth-1, ply+1)
+			search.traceExit(-score)
 		}
 		search.Pos.UndoMove(move)
 
@@ -499,14 +923,19 @@ func (search *Search) alphaBetaInner(alpha, beta int32, depth int, ply int) int3
 			// real search result -- storing it would poison the TT with a
 			// bogus cutoff for future probes at this position.
 			if !search.timedOut {
-				TTStore(search.Pos.Hash, move, ScoreToTT(score, ply), depth, BoundLower)
-				if isQuietMove(&search.Pos, move) {
-					search.recordKiller(move, ply)
-					search.recordHistory(move, depth)
-				}
+				search.tt.store(search.ttKey(), move, ScoreToTT(score, ply), rawEval, depth, BoundLower)
+				search.updateCutoffHistories(move, quietsTried[:numQuietsTried], capturesTried[:numCapturesTried], depth, ply)
+				search.updateCorrectionHistory(move, rawEval, staticEval, score, BoundLower, depth)
 			}
 			return score
 		}
+		if isQuiet && numQuietsTried < len(quietsTried) {
+			quietsTried[numQuietsTried] = move
+			numQuietsTried++
+		} else if !isQuiet && numCapturesTried < len(capturesTried) {
+			capturesTried[numCapturesTried] = move
+			numCapturesTried++
+		}
 		if score > bestScore {
 			bestScore = score
 			bestMove = move
@@ -537,7 +966,7 @@ func (search *Search) alphaBetaInner(alpha, beta int32, depth int, ply int) int3
 		if search.Pos.Checkers(search.Pos.Turn) != 0 {
 			return -(Infinity - int32(ply))
 		} else {
-			return 0
+			return search.drawScore(ply)
 		}
 	}
 
@@ -546,7 +975,8 @@ func (search *Search) alphaBetaInner(alpha, beta int32, depth int, ply int) int3
 		if bestScore <= alphaOrig {
 			bound = BoundUpper
 		}
-		TTStore(search.Pos.Hash, bestMove, ScoreToTT(bestScore, ply), depth, bound)
+		search.tt.store(search.ttKey(), bestMove, ScoreToTT(bestScore, ply), rawEval, depth, bound)
+		search.updateCorrectionHistory(bestMove, rawEval, staticEval, bestScore, bound, depth)
 	}
 
 	return bestScore
@@ -0,0 +1,143 @@
+package engine
+
+import "math"
+
+// Search pruning parameters. Package-level vars rather than consts so they
+// can be adjusted (by tests, or by a tuner) without a rebuild; each one's
+// default, and the range a tuner may move it in, is in Tunables below (see
+// tunable.go). The defaults are deliberately on the conservative side for
+// the same reason the forward-futility margins in alphaBetaInner are (see
+// the comment there). Margins are in Evaluate's units, which are roughly
+// centipawns.
+var (
+	// Reverse futility pruning (a.k.a. static null move pruning): at a
+	// shallow non-PV node, if the static eval beats beta by at least
+	// RFPMargin per remaining ply, assume the node fails high.
+	RFPMaxDepth int
+	RFPMargin   int32
+
+	// Razoring: at a very shallow non-PV node whose static eval is so far
+	// below alpha that only a tactic could save it, drop straight into
+	// quiescence and trust a fail-low from there.
+	RazorMaxDepth int
+	RazorMargin   int32
+
+	// Late move pruning: at a shallow node, once this many legal moves
+	// have been tried, remaining quiet moves are skipped outright. The
+	// threshold is LMPBase + depth^2, halved when not improving.
+	LMPMaxDepth int
+	LMPBase     int
+
+	// History updates: a cutoff at depth d adds
+	// min(HistoryBonusScale*d*d, HistoryBonusMax) (before gravity) to the
+	// cutoff move's history entries and subtracts it from those of the
+	// moves searched before it.
+	HistoryBonusScale int32
+	HistoryBonusMax   int32
+
+	// Internal iterative reduction: nodes at least this deep with no TT
+	// move are searched one ply shallower.
+	IIRMinDepth int
+
+	// Late move reductions. The base reduction for the n-th legal move at
+	// depth d is LMRBase/100 + ln(d)*ln(n)/(LMRDivisor/100), precomputed
+	// into lmrTable by InitLMRTable (which must be re-run after changing
+	// either). Kept in hundredths so every parameter here is an integer.
+	LMRBase       int
+	LMRDivisor    int
+	LMRMinDepth   int
+	LMRMinMoveNum int
+
+	// Per-node adjustments to the base reduction, in plies: less at PV
+	// nodes and for killers, more when not improving or when the TT move
+	// is a capture (a node whose best move is tactical is unlikely to be
+	// saved by a late quiet).
+	LMRPVAdjust        int
+	LMRKillerAdjust    int
+	LMRImprovingAdjust int
+	LMRTTCaptureAdjust int
+
+	// LMR history adjustment: a quiet's reduction shrinks by one ply per
+	// LMRHistoryDivisor of combined (butterfly + continuation) history,
+	// and grows by one per LMRHistoryDivisor below zero.
+	LMRHistoryDivisor int32
+
+	// Futility pruning: at depth <= FutilityMaxDepth, quiet moves are
+	// skipped when the static eval plus FutilityMargin per remaining ply
+	// can't reach alpha (see alphaBetaInner).
+	FutilityMaxDepth int
+	FutilityMargin   int32
+
+	// Null-move pruning: tried at depth >= NullMoveMinDepth, searching the
+	// null move NullMoveReduction plies shallower than a real move.
+	NullMoveMinDepth  int
+	NullMoveReduction int
+
+	// MaxQuiescenceDepth is how many plies of captures quiescence search
+	// follows before standing pat (check evasions go on past it).
+	MaxQuiescenceDepth int
+)
+
+// Tunables registers every search parameter above with its default and
+// tuning range. MaxKillerPly isn't here: it sizes the per-ply arrays of
+// Search, so it has to stay a compile-time constant, and it's a bound
+// on search depth rather than something with a strength tradeoff.
+var Tunables = []*Tunable{
+	tunable("RFPMaxDepth", &RFPMaxDepth, 6, 2, 10, 1),
+	tunable("RFPMargin", &RFPMargin, 90, 40, 200, 10),
+	tunable("RazorMaxDepth", &RazorMaxDepth, 2, 1, 4, 1),
+	tunable("RazorMargin", &RazorMargin, 300, 100, 600, 25),
+	tunable("LMPMaxDepth", &LMPMaxDepth, 4, 1, 8, 1),
+	tunable("LMPBase", &LMPBase, 3, 0, 10, 1),
+	tunable("HistoryBonusScale", &HistoryBonusScale, 32, 8, 64, 4),
+	tunable("HistoryBonusMax", &HistoryBonusMax, 1200, 400, 2400, 100),
+	tunable("IIRMinDepth", &IIRMinDepth, 4, 2, 8, 1),
+	tunable("LMRBase", &LMRBase, 75, 0, 150, 10).withChanged(InitLMRTable),
+	tunable("LMRDivisor", &LMRDivisor, 225, 150, 350, 15).withChanged(InitLMRTable),
+	tunable("LMRMinDepth", &LMRMinDepth, 3, 1, 6, 1),
+	tunable("LMRMinMoveNum", &LMRMinMoveNum, 3, 1, 8, 1),
+	tunable("LMRPVAdjust", &LMRPVAdjust, 1, 0, 3, 1),
+	tunable("LMRKillerAdjust", &LMRKillerAdjust, 1, 0, 3, 1),
+	tunable("LMRImprovingAdjust", &LMRImprovingAdjust, 1, 0, 3, 1),
+	tunable("LMRTTCaptureAdjust", &LMRTTCaptureAdjust, 1, 0, 3, 1),
+	tunable("LMRHistoryDivisor", &LMRHistoryDivisor, 8192, 2048, 16384, 512),
+	tunable("FutilityMaxDepth", &FutilityMaxDepth, 3, 1, 6, 1),
+	tunable("FutilityMargin", &FutilityMargin, 150, 50, 300, 15),
+	tunable("NullMoveMinDepth", &NullMoveMinDepth, 3, 2, 6, 1),
+	tunable("NullMoveReduction", &NullMoveReduction, 2, 1, 5, 1),
+	tunable("MaxQuiescenceDepth", &MaxQuiescenceDepth, 8, 2, 16, 1),
+}
+
+// lmrTableSize bounds the depth and move-number axes of lmrTable; larger
+// values are clamped onto the last row/column.
+const lmrTableSize = 64
+
+// lmrTable[depth][moveNum] is the base LMR reduction (see LMRBase).
+var lmrTable [lmrTableSize][lmrTableSize]int
+
+// InitLMRTable (re)builds lmrTable from LMRBase and LMRDivisor. Called from
+// Init(); must be called again after changing either parameter.
+func InitLMRTable() {
+	base := float64(LMRBase) / 100
+	divisor := float64(LMRDivisor) / 100
+	for depth := 1; depth < lmrTableSize; depth++ {
+		for moveNum := 1; moveNum < lmrTableSize; moveNum++ {
+			lmrTable[depth][moveNum] = int(base + math.Log(float64(depth))*math.Log(float64(moveNum))/divisor)
+		}
+	}
+}
+
+// lmrBaseReduction looks up lmrTable, clamping both indices into range.
+func lmrBaseReduction(depth, moveNum int) int {
+	return lmrTable[min(depth, lmrTableSize-1)][min(moveNum, lmrTableSize-1)]
+}
+
+// lmpThreshold returns how many legal moves are searched at depth before
+// late move pruning kicks in for the remaining quiets.
+func lmpThreshold(depth int, improving bool) int {
+	threshold := LMPBase + depth*depth
+	if !improving {
+		threshold /= 2
+	}
+	return threshold
+}
@@ -0,0 +1,92 @@
+package engine_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"silverfish/engine"
+)
+
+// searchSignature is everything a deterministic search should reproduce
+// exactly: best move, score, PV and node count.
+type searchSignature struct {
+	bestMove string
+	score    int32
+	pv       string
+	nodes    int
+}
+
+func (sig searchSignature) String() string {
+	return fmt.Sprintf("bestmove %s score %d nodes %d pv %s", sig.bestMove, sig.score, sig.nodes, sig.pv)
+}
+
+// deterministicSignature runs a deterministic search of fen, limited to
+// depth and (if nonzero) nodes, and returns its signature.
+func deterministicSignature(t *testing.T, fen string, depth, nodes int) searchSignature {
+	t.Helper()
+	pos := engine.FromFEN(fen)
+	search := engine.Search{MaxDepth: depth, TimeLimit: engine.InfiniteMovetime, NodeLimit: nodes}
+	search.Init(&pos)
+
+	var score int32
+	var move engine.Move
+	captureStdout(t, func() { score, move = engine.SearchLazySMP(&search) })
+
+	var pv []string
+	for _, m := range search.PV(engine.MaxKillerPly) {
+		pv = append(pv, m.ToString())
+	}
+	return searchSignature{move.ToString(), score, strings.Join(pv, " "), search.TotalNodes}
+}
+
+// assertStableSignatures searches each position in deterministic mode a
+// few times, with whatever TT contents and Threads setting earlier runs
+// leave behind in between, and fails if any run's signature differs from
+// the first.
+func assertStableSignatures(t *testing.T, fens []string, depth, nodes int) {
+	t.Helper()
+	defer func(det bool, threads int) { engine.Deterministic, engine.Threads = det, threads }(engine.Deterministic, engine.Threads)
+	engine.Deterministic = true
+
+	for _, fen := range fens {
+		engine.Threads = 1
+		want := deterministicSignature(t, fen, depth, nodes)
+		if want.nodes < nodes {
+			t.Errorf("%s: search stopped after %d nodes, before its %d-node limit", fen, want.nodes, nodes)
+		}
+
+		for run, threads := range []int{1, 4, 1} {
+			// Leave unrelated entries in the TT, as a previous game would.
+			other := engine.StartingPosition()
+			warm := engine.Search{MaxDepth: 4, TimeLimit: time.Second}
+			warm.Init(&other)
+			captureStdout(t, func() { warm.Search() })
+
+			engine.Threads = threads
+			if got := deterministicSignature(t, fen, depth, nodes); got != want {
+				t.Errorf("%s: run %d (Threads=%d) signature\n  %v\nwant\n  %v", fen, run+1, threads, got, want)
+			}
+		}
+	}
+}
+
+func TestDeterministicSearchSignature(t *testing.T) {
+	assertStableSignatures(t, []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4",
+		"r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	}, engine.InfiniteDepth, 20000)
+}
+
+// A depth-limited search has no node budget to stop it, only its depth --
+// and in deterministic mode no clock either, however long it runs -- so
+// it has to come out the same every time, down to the node count.
+func TestDeterministicDepthLimitedSignature(t *testing.T) {
+	assertStableSignatures(t, []string{
+		"r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+	}, 7, 0)
+}
@@ -232,6 +232,21 @@ func TestQuiescenceDetectsCheckmate(t *testing.T) {
 	}
 }
 
+// Quiescence searches quiet checks at its first ply, so a quiet mate-in-one
+// (here the back-rank Ra8#) is found by quiescence alone, with no full-width
+// search above it.
+func TestQuiescenceFindsQuietCheckmate(t *testing.T) {
+	engine.ClearTT()
+	pos := engine.FromFEN("6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1")
+	search := engine.Search{StartTime: time.Now(), TimeLimit: 4 * time.Second}
+	search.Init(&pos)
+
+	score := search.Quiescence(-engine.Infinity, engine.Infinity, 0, 0)
+	if score < engine.MateScoreThreshold {
+		t.Errorf("score = %d, want a mate score", score)
+	}
+}
+
 // Forced mates: any correct search must find them, independent of eval tuning.
 func TestSearchFindsMateInOne(t *testing.T) {
 	cases := []struct {
@@ -376,7 +391,7 @@ func TestUciInfoReportsScoreOncePerDepth(t *testing.T) {
 	// unscored-ping assertion below is meaningful -- move ordering
 	// improvements (full-sort OrderMoves, killers/history) make a given
 	// depth cheaper over time, so this may need bumping again later.
-	search := engine.Search{MaxDepth: 6, TimeLimit: engine.InfiniteMovetime}
+	search := engine.Search{MaxDepth: 8, TimeLimit: engine.InfiniteMovetime}
 	search.Init(&pos)
 
 	var finalScore int32
@@ -411,8 +426,8 @@ func TestUciInfoReportsScoreOncePerDepth(t *testing.T) {
 			t.Errorf("depth %d: got %d scored info lines, want exactly 1", d, count)
 		}
 	}
-	if lastDepth != 6 {
-		t.Errorf("last scored info line was depth %d, want 6 (MaxDepth)", lastDepth)
+	if lastDepth != 8 {
+		t.Errorf("last scored info line was depth %d, want 8 (MaxDepth)", lastDepth)
 	}
 	if lastScore != finalScore {
 		t.Errorf("last scored info line score = %d, want %d (Search()'s returned score)", lastScore, finalScore)
@@ -466,7 +481,9 @@ func TestUciInfoReportsMateFormat(t *testing.T) {
 // avoid the repeat by luck. Primes real game history (via DoMove, exactly
 // like main.go replays a UCI "position ... moves ..." command) with a
 // K+R vs K waiting-move sequence that returns to the exact starting
-// position, then re-offers the same waiting move (h1h2) as a candidate.
+// position twice, then re-offers the same waiting move (h1h2) as a
+// candidate -- which would now be a true threefold (a single repeat of a
+// pre-root position isn't scored as a draw; see Position.IsDraw).
 func TestSearchAvoidsKnownRepetition(t *testing.T) {
 	findMove := func(pos *engine.Position, uci string) engine.Move {
 		want := engine.NewMoveFromStr(uci)
@@ -479,7 +496,7 @@ func TestSearchAvoidsKnownRepetition(t *testing.T) {
 	}
 
 	pos := engine.FromFEN("4k3/8/8/8/2K5/8/8/7R w - - 0 1")
-	for _, uci := range []string{"h1h2", "e8e7", "h2h1", "e7e8"} {
+	for _, uci := range []string{"h1h2", "e8e7", "h2h1", "e7e8", "h1h2", "e8e7", "h2h1", "e7e8"} {
 		m := findMove(&pos, uci)
 		if m == engine.Move(0) {
 			t.Fatalf("priming move %s not legal in %s", uci, pos.ToFEN())
@@ -487,15 +504,15 @@ func TestSearchAvoidsKnownRepetition(t *testing.T) {
 		pos.DoMove(m)
 	}
 
-	// h1h2 recreates the position from right after the first h1h2 -- same
-	// side to move, same everything. Confirmed at the Position level too
+	// h1h2 recreates the position from right after each earlier h1h2 --
+	// same side to move, same everything. Confirmed at the Position level too
 	// (TestIsRepetition covers the mechanism directly); this checks it
 	// actually changes Search()'s behavior.
 	repeat := findMove(&pos, "h1h2")
 	clone := pos.Clone()
 	clone.DoMove(repeat)
-	if !clone.IsRepetition() {
-		t.Fatalf("test setup bug: h1h2 was expected to recreate a prior position")
+	if !clone.IsDraw(1) {
+		t.Fatalf("test setup bug: h1h2 was expected to make a threefold repetition")
 	}
 
 	for _, depth := range []int{1, 2, 3} {
@@ -514,3 +531,481 @@ func TestSearchAvoidsKnownRepetition(t *testing.T) {
 		}
 	}
 }
+
+// provesMateIn reports whether the side to move can force checkmate within
+// n moves, by exhaustive search over every legal move -- no pruning, no
+// evaluation, no TT. Far too slow for real use, but an independent oracle
+// for TestSearchMateInNSuite's expected distances.
+func provesMateIn(pos *engine.Position, n int) bool {
+	for _, move := range pos.LegalMoves() {
+		pos.DoMove(move)
+		ok := isMatedWithin(pos, n-1)
+		pos.UndoMove(move)
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isMatedWithin reports whether the side to move is checkmated now, or
+// whatever it plays, the opponent can mate within n more moves.
+func isMatedWithin(pos *engine.Position, n int) bool {
+	moves := pos.LegalMoves()
+	if len(moves) == 0 {
+		return pos.Checkers(pos.Turn) != 0
+	}
+	if n == 0 {
+		return false
+	}
+	for _, move := range moves {
+		pos.DoMove(move)
+		ok := provesMateIn(pos, n)
+		pos.UndoMove(move)
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Regression suite for mate-finding mode (`go mate N`, Search.MateLimit):
+// each position is a mate in exactly N for the side to move. The search
+// must report exactly that distance -- mate distance pruning and the
+// ply-adjusted mate scores together mean it should never settle for a
+// longer mate -- and must end iterative deepening on its own once the mate
+// is proven, well before the (generous) time limit.
+func TestSearchMateInNSuite(t *testing.T) {
+	cases := []struct {
+		name string
+		fen  string
+		mate int
+	}{
+		{"back rank", "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 1},
+		{"back rank, black", "r5k1/5ppp/8/8/8/8/5PPP/R5K1 b - - 0 1", 1},
+		{"smothered", "6rk/6pp/8/6N1/8/8/8/6QK w - - 0 1", 1},
+		{"scholar's", "r1bqkbnr/pppp1ppp/2n5/4p3/2B1P3/5Q2/PPPP1PPP/RNB1K1NR w KQkq - 0 1", 1},
+		{"Nf6+ gxf6 Bxf7", "r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 1", 2},
+		{"KQ vs K", "k7/8/2K5/8/8/8/8/7Q w - - 0 1", 2},
+		{"KQ vs K, black", "7q/8/8/8/8/2k5/8/K7 b - - 0 1", 2},
+		{"KR vs KP", "k7/p7/K7/8/8/8/8/1R6 w - - 0 1", 3},
+		{"KR vs KP, black", "1r6/8/8/8/8/k7/P7/K7 b - - 0 1", 3},
+		{"KR vs K", "2k5/8/8/2K5/8/8/8/7R w - - 0 1", 3},
+		{"KR vs K, centre", "4k3/8/8/4K3/8/8/8/R7 w - - 0 1", 3},
+	}
+
+	const timeLimit = 20 * time.Second
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pos := engine.FromFEN(tc.fen)
+			if !provesMateIn(&pos, tc.mate) || (tc.mate > 1 && provesMateIn(&pos, tc.mate-1)) {
+				t.Fatalf("test data: %q is not a mate in exactly %d", tc.fen, tc.mate)
+			}
+
+			engine.ClearTT()
+			search := engine.Search{MaxDepth: engine.InfiniteDepth, TimeLimit: timeLimit, MateLimit: tc.mate}
+			search.Init(&pos)
+
+			var score int32
+			var bestMove engine.Move
+			start := time.Now()
+			captureStdout(t, func() {
+				score, bestMove = search.Search()
+			})
+			if elapsed := time.Since(start); elapsed >= timeLimit {
+				t.Fatalf("mate search ran out its %s time limit instead of stopping once mate was proven", timeLimit)
+			}
+
+			if score < engine.MateScoreThreshold {
+				t.Fatalf("score = %d, want a mate score", score)
+			}
+			if got := (engine.Infinity - score + 1) / 2; int(got) != tc.mate {
+				t.Errorf("reported mate in %d, want mate in %d", got, tc.mate)
+			}
+			pos.DoMove(bestMove)
+			if !isMatedWithin(&pos, tc.mate-1) {
+				t.Errorf("best move %s does not keep a mate in %d", bestMove.ToString(), tc.mate)
+			}
+		})
+	}
+}
+
+// Tactical regression suite: positions with a known best move (or a few
+// equally good ones), which a fixed-depth search has to find with every
+// forward pruning -- reverse futility, razoring, null move, futility, late
+// move pruning and reductions -- in play. A margin or reduction that
+// starts pruning the refutation away shows up here as a wrong move. The
+// last few are in check at the root, where there is no static eval and
+// none of the eval-based pruning applies.
+func TestSearchTacticalSuite(t *testing.T) {
+	cases := []struct {
+		name  string
+		fen   string
+		depth int
+		best  []string
+	}{
+		{"knight fork", "r3k3/8/8/1N6/8/8/8/4K3 w - - 0 1", 6, []string{"b5c7"}},
+		{"promote capturing the rook", "r7/1P6/8/8/8/8/k7/4K3 w - - 0 1", 6, []string{"b7a8q"}},
+		{"back rank defence", "6k1/5ppp/8/8/8/8/r7/R5K1 b - - 0 1", 6, []string{"a2a1"}},
+		{"mate in 2 through a sacrifice", "r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 1", 6, []string{"d5f6"}},
+		{"quiet mate in 3", "2k5/8/8/2K5/8/8/8/7R w - - 0 1", 10, []string{"c5c6"}},
+		{"evade by capturing the checker", "4k3/8/8/8/8/8/3q4/4K3 w - - 0 1", 6, []string{"e1d2"}},
+		{"evade by capturing the knight", "4k3/8/8/8/8/3n4/8/3QK3 w - - 0 1", 6, []string{"d1d3"}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine.ClearTT()
+			pos := engine.FromFEN(tc.fen)
+			search := engine.Search{MaxDepth: tc.depth, TimeLimit: engine.InfiniteMovetime}
+			search.Init(&pos)
+
+			var bestMove engine.Move
+			captureStdout(t, func() { _, bestMove = search.Search() })
+			for _, best := range tc.best {
+				if bestMove.ToString() == best {
+					return
+				}
+			}
+			t.Errorf("depth %d: best move %s, want one of %v", tc.depth, bestMove.ToString(), tc.best)
+		})
+	}
+}
+
+// improving compares a node's static eval with its side's previous one.
+// In check there's no static eval, and so never improving; with no
+// previous eval to compare with (that node was in check), always.
+func TestIsImproving(t *testing.T) {
+	cases := []struct {
+		name                 string
+		staticEval, prevEval int32
+		want                 bool
+	}{
+		{"better", 50, 10, true},
+		{"worse", 10, 50, false},
+		{"unchanged", 10, 10, false},
+		{"in check", engine.NoEval, 10, false},
+		{"in check, previous in check", engine.NoEval, engine.NoEval, false},
+		{"previous in check", -300, engine.NoEval, true},
+	}
+	for _, tc := range cases {
+		if got := engine.IsImproving(tc.staticEval, tc.prevEval); got != tc.want {
+			t.Errorf("%s: IsImproving(%d, %d) = %v, want %v", tc.name, tc.staticEval, tc.prevEval, got, tc.want)
+		}
+	}
+}
+
+// The base LMR reduction grows with both depth and move number, and is
+// nothing at all for a node's first move however deep.
+func TestLMRBaseReduction(t *testing.T) {
+	for depth := 1; depth < 64; depth++ {
+		if got := engine.LMRBaseReduction(depth, 1); got != 0 {
+			t.Errorf("reduction(%d, 1) = %d, want 0", depth, got)
+		}
+		for moveNum := 1; moveNum < 64; moveNum++ {
+			r := engine.LMRBaseReduction(depth, moveNum)
+			if next := engine.LMRBaseReduction(depth+1, moveNum); next < r {
+				t.Errorf("reduction(%d, %d) = %d > reduction(%d, %d) = %d", depth, moveNum, r, depth+1, moveNum, next)
+			}
+			if next := engine.LMRBaseReduction(depth, moveNum+1); next < r {
+				t.Errorf("reduction(%d, %d) = %d > reduction(%d, %d) = %d", depth, moveNum, r, depth, moveNum+1, next)
+			}
+		}
+	}
+	if engine.LMRBaseReduction(30, 40) <= engine.LMRBaseReduction(3, 4) {
+		t.Errorf("reduction(30, 40) = %d, no more than reduction(3, 4) = %d",
+			engine.LMRBaseReduction(30, 40), engine.LMRBaseReduction(3, 4))
+	}
+	// past the end of the table it stays at the last entry
+	if got, want := engine.LMRBaseReduction(500, 500), engine.LMRBaseReduction(63, 63); got != want {
+		t.Errorf("reduction(500, 500) = %d, want %d", got, want)
+	}
+}
+
+// lmrStats counts what checkLMRTrace saw.
+type lmrStats struct {
+	reduced, reSearched, fullWindow int
+}
+
+// checkLMRTrace walks a traced tree, pos being node's position, and checks
+// every move searched below it went through LMR the way alphaBetaInner
+// should: only late quiet moves out of check at enough depth are reduced,
+// with a zero window; a reduced search that fails high is re-searched at
+// full depth, still zero-window, and one that then lands inside a PV
+// node's window is searched once more with the full window; nothing else
+// is searched twice.
+func checkLMRTrace(t *testing.T, node *engine.TraceNode, pos *engine.Position, stats *lmrStats) {
+	t.Helper()
+	if node.Truncated || node.Pruned == engine.PruneStopped {
+		return
+	}
+	inCheck := pos.Checkers(pos.Turn) != 0
+	pvNode := node.Beta-node.Alpha > 1
+	legal := map[string]engine.Move{}
+	for _, m := range pos.LegalMoves() {
+		legal[m.ToString()] = m
+	}
+
+	children := node.Children
+	moveNum := 0
+	for len(children) > 0 {
+		first := children[0]
+		n := 1
+		for n < len(children) && children[n].Move == first.Move {
+			n++
+		}
+		searches := children[:n]
+		children = children[n:]
+		if first.Move == "0000" {
+			continue // null move
+		}
+		moveNum++
+		if first.Pruned == engine.PruneFutility || first.Pruned == engine.PruneLateMove {
+			continue
+		}
+		move := legal[first.Move]
+
+		if first.Reduction == 0 {
+			if n != 1 {
+				t.Fatalf("%s: unreduced %s searched %d times", pos.ToFEN(), first.Move, n)
+			}
+		} else {
+			stats.reduced++
+			if inCheck || !engine.IsQuietMove(pos, move) || moveNum <= engine.LMRMinMoveNum || node.Depth < engine.LMRMinDepth {
+				t.Fatalf("%s: %s reduced (move %d, depth %d, in check %v)", pos.ToFEN(), first.Move, moveNum, node.Depth, inCheck)
+			}
+			if first.Beta-first.Alpha != 1 {
+				t.Fatalf("%s: %s reduced with window (%d, %d)", pos.ToFEN(), first.Move, first.Alpha, first.Beta)
+			}
+			alpha := -first.Beta
+			want := 1
+			if -first.Score > alpha {
+				want = 2
+				full := searches[min(1, n-1)]
+				if n > 1 && -full.Score > alpha && -full.Score < node.Beta && pvNode {
+					want = 3
+				}
+			}
+			if n != want {
+				t.Fatalf("%s: %s searched %d times, want %d: %+v", pos.ToFEN(), first.Move, n, want, searches)
+			}
+			fullDepth := first.Depth + first.Reduction
+			for i, s := range searches[1:] {
+				if s.Reduction != 0 || s.Depth != fullDepth {
+					t.Fatalf("%s: %s re-search %d at depth %d reduction %d, want full depth %d", pos.ToFEN(), first.Move, i+1, s.Depth, s.Reduction, fullDepth)
+				}
+			}
+			if n >= 2 {
+				stats.reSearched++
+				if searches[1].Alpha != first.Alpha || searches[1].Beta != first.Beta {
+					t.Fatalf("%s: %s full-depth re-search window (%d, %d), want the zero window (%d, %d)",
+						pos.ToFEN(), first.Move, searches[1].Alpha, searches[1].Beta, first.Alpha, first.Beta)
+				}
+			}
+			if n == 3 {
+				stats.fullWindow++
+				// (mate distance pruning may have pulled the node's beta in
+				// from the one it was called with)
+				if searches[2].Beta != -alpha || searches[2].Alpha >= first.Alpha || searches[2].Alpha < -node.Beta {
+					t.Fatalf("%s: %s full-window re-search window (%d, %d), want (%d, %d)",
+						pos.ToFEN(), first.Move, searches[2].Alpha, searches[2].Beta, -node.Beta, -alpha)
+				}
+			}
+		}
+
+		pos.DoMove(move)
+		checkLMRTrace(t, searches[n-1], pos, stats)
+		pos.UndoMove(move)
+	}
+}
+
+// Reduced searches follow the re-search ladder through a whole tree.
+func TestLMRReSearch(t *testing.T) {
+	var stats lmrStats
+	for _, fen := range []string{
+		"r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r1bq1rk1/pp2ppbp/2np1np1/8/3NP3/2N1BP2/PPPQ2PP/R3KB1R w KQ - 3 9",
+	} {
+		engine.ClearTT()
+		pos := engine.FromFEN(fen)
+		search := engine.Search{MaxDepth: 6, TimeLimit: engine.InfiniteMovetime, Trace: engine.NewTracer(4, 0)}
+		search.Init(&pos)
+		captureStdout(t, func() { search.Search() })
+		checkLMRTrace(t, search.Trace.Root, &pos, &stats)
+	}
+	if stats.reduced == 0 || stats.reSearched == 0 || stats.fullWindow == 0 {
+		t.Errorf("saw %d reduced searches, %d full-depth re-searches and %d full-window re-searches, want some of each",
+			stats.reduced, stats.reSearched, stats.fullWindow)
+	}
+}
+
+// In this position the reply the PV goes through is a late quiet move at
+// its node, so its first search is a reduced one -- which fails high -- and
+// only the re-searches find the score that makes it the best reply.
+func TestLMRReSearchFindsBestReply(t *testing.T) {
+	engine.ClearTT()
+	pos := engine.FromFEN("r1bq1rk1/pp2ppbp/2np1np1/8/3NP3/2N1BP2/PPPQ2PP/R3KB1R w KQ - 3 9")
+	search := engine.Search{MaxDepth: 5, TimeLimit: engine.InfiniteMovetime, Trace: engine.NewTracer(2, 0)}
+	search.Init(&pos)
+	var move engine.Move
+	captureStdout(t, func() { _, move = search.Search() })
+	pv := search.PV(2)
+	if len(pv) < 2 {
+		t.Fatalf("PV %v, want at least two moves", pv)
+	}
+
+	var node *engine.TraceNode
+	for _, child := range search.Trace.Root.Children {
+		if child.Move == move.ToString() {
+			node = child
+		}
+	}
+	if node == nil {
+		t.Fatalf("best move %s not in the trace", move.ToString())
+	}
+	var searches []*engine.TraceNode
+	for _, child := range node.Children {
+		if child.Move == pv[1].ToString() {
+			searches = append(searches, child)
+		}
+	}
+	if len(searches) < 2 || searches[0].Reduction == 0 {
+		t.Fatalf("reply %s searched %d times, not reduced then re-searched", pv[1].ToString(), len(searches))
+	}
+	last := searches[len(searches)-1]
+	if last.Reduction != 0 || last.Score != -node.Score {
+		t.Errorf("reply %s's last search: reduction %d, score %d; want full depth and the node's score %d",
+			pv[1].ToString(), last.Reduction, last.Score, -node.Score)
+	}
+}
+
+// Quiescence stores its results at depths below any real search's (see
+// TTDepthQS), so however good a quiescence entry looks, a node with depth
+// left to search mustn't take it as a cutoff. Here every root move's
+// position holds a wildly wrong exact quiescence score: the depth-1
+// searches below the root have to ignore it and search for themselves.
+func TestQuiescenceTTEntriesDontCutOffSearch(t *testing.T) {
+	const fen = "r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4"
+	for _, qsDepth := range []int{engine.TTDepthQS, engine.TTDepthQSNoChecks} {
+		engine.ClearTT()
+		pos := engine.FromFEN(fen)
+		search := engine.Search{MaxDepth: 2, TimeLimit: engine.InfiniteMovetime, Trace: engine.NewTracer(1, 0)}
+		search.Init(&pos)
+		for _, move := range pos.LegalMoves() {
+			search.Pos.DoMove(move)
+			engine.TTStore(search.TTKey(), 0, 3000, engine.NoEval, qsDepth, engine.BoundExact)
+			search.Pos.UndoMove(move)
+		}
+
+		var score int32
+		captureStdout(t, func() { score, _ = search.Search() })
+		for _, child := range search.Trace.Root.Children {
+			if !child.TTHit || child.TTCutoff {
+				t.Errorf("TT depth %d: %s at depth %d: TT hit %v, cutoff %v; want a hit and no cutoff",
+					qsDepth, child.Move, child.Depth, child.TTHit, child.TTCutoff)
+			}
+		}
+		if score < -500 {
+			t.Errorf("TT depth %d: score %d, taken from the planted quiescence entries", qsDepth, score)
+		}
+	}
+}
+
+// The TT only saves quiescence work, it doesn't change its answers: a
+// quiescence search over a table its own earlier searches (full and null
+// window, at a few bounds) have filled scores every position exactly as it
+// does over an empty one.
+func TestQuiescenceScoresIndependentOfTT(t *testing.T) {
+	fens := []string{
+		"r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"7k/6p1/7B/8/8/8/8/4K1Q1 w - - 0 1",
+		"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1",
+	}
+	qsearch := func(pos *engine.Position, alpha, beta int32) int32 {
+		search := engine.Search{StartTime: time.Now(), TimeLimit: engine.InfiniteMovetime}
+		search.Init(pos)
+		return search.Quiescence(alpha, beta, 0, 0)
+	}
+
+	for _, fen := range fens {
+		pos := engine.FromFEN(fen)
+		engine.ClearTT()
+		want := qsearch(&pos, -engine.Infinity, engine.Infinity)
+
+		for _, alpha := range []int32{want - 200, want + 100, want - 1, want} {
+			qsearch(&pos, alpha, alpha+1)
+		}
+		if got := qsearch(&pos, -engine.Infinity, engine.Infinity); got != want {
+			t.Errorf("%s: quiescence score %d over a warm TT, %d over an empty one", fen, got, want)
+		}
+	}
+}
+
+// A TT bound on the right side of the static eval replaces it as the
+// stand-pat score, even when it's too shallow to cut off: here, with no
+// captures or checks to search, quiescence returns exactly that stand
+// pat. A bound on the wrong side says nothing and is ignored.
+func TestQuiescenceStandPatUsesTTBound(t *testing.T) {
+	pos := engine.FromFEN("8/8/8/8/k7/8/4P3/4K3 w - - 0 1")
+	eval := engine.Evaluate(&pos)
+	cases := []struct {
+		name  string
+		score int32
+		bound uint8
+		want  int32
+	}{
+		{"no entry", 0, engine.BoundNone, eval},
+		{"lower bound above the eval", eval + 200, engine.BoundLower, eval + 200},
+		{"upper bound below the eval", eval - 200, engine.BoundUpper, eval - 200},
+		{"lower bound below the eval", eval - 200, engine.BoundLower, eval},
+		{"upper bound above the eval", eval + 200, engine.BoundUpper, eval},
+	}
+	for _, tc := range cases {
+		engine.ClearTT()
+		search := engine.Search{StartTime: time.Now(), TimeLimit: engine.InfiniteMovetime}
+		search.Init(&pos)
+		if tc.bound != engine.BoundNone {
+			// too shallow for the checks-searching first ply to cut off on
+			engine.TTStore(search.TTKey(), 0, tc.score, eval, engine.TTDepthQSNoChecks, tc.bound)
+		}
+		if got := search.Quiescence(-engine.Infinity, engine.Infinity, 0, 0); got != tc.want {
+			t.Errorf("%s: quiescence score %d, want %d (static eval %d)", tc.name, got, tc.want, eval)
+		}
+	}
+}
+
+// Past MaxQuiescenceDepth a quiet position just returns its static eval,
+// but one in check is still searched: its evasions are resolved, and with
+// none it's checkmate.
+func TestQuiescenceEvasionsPastMaxDepth(t *testing.T) {
+	qdepth := engine.MaxQuiescenceDepth + 1
+
+	quiet := engine.FromFEN("8/8/8/8/k7/8/4P3/4K3 w - - 0 1")
+	search := engine.Search{StartTime: time.Now(), TimeLimit: engine.InfiniteMovetime}
+	search.Init(&quiet)
+	if got, want := search.Quiescence(-engine.Infinity, engine.Infinity, qdepth, 5), engine.Evaluate(&quiet); got != want {
+		t.Errorf("quiet position: score %d, want the static eval %d", got, want)
+	}
+
+	// back-rank mate, black to move
+	engine.ClearTT()
+	mated := engine.FromFEN("R5k1/5ppp/8/8/8/8/8/6K1 b - - 0 1")
+	search = engine.Search{StartTime: time.Now(), TimeLimit: engine.InfiniteMovetime}
+	search.Init(&mated)
+	if got, want := search.Quiescence(-engine.Infinity, engine.Infinity, qdepth, 5), -(engine.Infinity - 5); got != want {
+		t.Errorf("checkmated: score %d, want %d", got, want)
+	}
+
+	// the only evasion takes the checking queen, leaving black two pawns up
+	engine.ClearTT()
+	evade := engine.FromFEN("6k1/5pQ1/6p1/8/8/8/8/6K1 b - - 0 1")
+	search = engine.Search{StartTime: time.Now(), TimeLimit: engine.InfiniteMovetime}
+	search.Init(&evade)
+	if got := search.Quiescence(-engine.Infinity, engine.Infinity, qdepth, 5); got < 100 {
+		t.Errorf("evasion capturing the queen: score %d, want black ahead", got)
+	}
+}
@@ -6,60 +6,175 @@ import (
 )
 
 // Threads is the number of search goroutines SearchLazySMP spawns (1 =
-// classic single-threaded search, no locking overhead anywhere -- see
-// ttSMPActive in tt.go). Set via the UCI "Threads" option, defaulting to 1
-// so existing single-threaded behavior is unchanged unless a GUI/tester
-// opts in.
+// classic single-threaded search). Set via the UCI "Threads" option,
+// defaulting to 1 so existing single-threaded behavior is unchanged unless
+// a GUI/tester opts in.
 var Threads = 1
 
 // SearchLazySMP runs Threads-1 helper searches alongside a main search, all
-// against the same position and all sharing the package-level TT (see
-// tt.go). Helpers get no dedicated time check of their own beyond the
+// against the same position and all sharing the main search's lockless TT
+// (see tt.go). Helpers get no dedicated time check of their own beyond the
 // shared stop signal below -- they run the same iterative-deepening loop as
 // the main search and simply get interrupted once the main search
-// concludes.
+// concludes. A NodeLimit is the exception: it's shared, every thread
+// counting its nodes against the one budget, so `go nodes N` searches
+// about N nodes in all however many threads there are (see sharedNodes).
 //
-// The result returned is always the main search's own best move/score:
-// helpers exist only to seed the shared TT with additional
-// depth/best-move/bound information (found via naturally-diverging
-// goroutine scheduling -- no explicit diversification of helper searches is
-// needed), not to be trusted for the final answer themselves. This is the
-// standard "Lazy SMP" design (as opposed to a proper split-point/YBWC
-// parallel search): dead simple, no work-stealing or synchronization beyond
-// the TT, and known to scale sub-linearly but positively up to a moderate
-// thread count.
+// Helpers are deliberately made to search differently from the main
+// thread and each other, so they fill the TT with information the main
+// thread hasn't got yet instead of racing it through the same tree: each
+// starts at a staggered depth and skips iterations on its own pattern (see
+// startDepth/skipDepth), and each is its own Search, so killers, history
+// and correction history evolve independently per thread. Once the main
+// search concludes, every thread's last completed iteration votes on the
+// move to play (see voteBestThread). This is the standard "Lazy SMP"
+// design (as opposed to a proper split-point/YBWC parallel search): no
+// work-stealing or synchronization beyond the TT, and known to scale
+// sub-linearly but positively up to a moderate thread count.
 func SearchLazySMP(main *Search) (int32, Move) {
-	if Threads <= 1 {
-		return main.Search()
+	if Deterministic {
+		main.prepareDeterministic()
+	} else {
+		main.tt.newSearch()
+	}
+
+	if Threads <= 1 || Deterministic {
+		score, move := main.Search()
+		main.TotalNodes = main.Nodes
+		return score, move
 	}
 
 	var stop int32
 	main.SetStopSignal(&stop)
+	var nodes int64
+	if main.NodeLimit > 0 {
+		main.sharedNodes, main.sharedFrom, main.sharedSeen = &nodes, main.Nodes, 0
+	}
 
-	atomic.StoreInt32(&ttSMPActive, 1)
-	defer atomic.StoreInt32(&ttSMPActive, 0)
+	results := make([]threadResult, Threads)
+	helpers := make([]*Search, Threads)
 
 	var wg sync.WaitGroup
 	for i := 1; i < Threads; i++ {
 		helper := &Search{
-			MaxDepth:  main.MaxDepth,
-			TimeLimit: main.TimeLimit,
-			silent:    true,
+			MaxDepth:    main.MaxDepth,
+			TimeLimit:   main.TimeLimit,
+			NodeLimit:   main.NodeLimit,
+			MateLimit:   main.MateLimit,
+			threadIndex: i,
+			silent:      true,
+			tt:          main.tt,
 		}
 		helper.Init(&main.Pos)
 		helper.SetStopSignal(&stop)
+		if main.NodeLimit > 0 {
+			helper.sharedNodes = &nodes
+		}
+		helpers[i] = helper
 
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			helper.Search()
+			score, move := helper.Search()
+			results[i] = threadResult{score, move, helper.completedDepth}
 		}()
 	}
 
 	score, move := main.Search()
+	results[0] = threadResult{score, move, main.completedDepth}
 
 	atomic.StoreInt32(&stop, 1)
 	wg.Wait()
 
-	return score, move
+	main.sharedNodes = nil
+	main.TotalNodes = main.Nodes
+	for _, helper := range helpers[1:] {
+		main.TotalNodes += helper.Nodes
+	}
+
+	best := voteBestThread(results)
+	if best != 0 && !main.silent {
+		// The GUI's last info line came from the main thread; report the
+		// depth and score that the move actually played stands on.
+		uciInfoDepth(results[best].depth, results[best].score, main.TotalNodes)
+	}
+	return results[best].score, results[best].move
+}
+
+// threadResult is one Lazy SMP thread's answer: its best move and score
+// from its deepest completed iteration.
+type threadResult struct {
+	score int32
+	move  Move
+	depth int
+}
+
+// voteBestThread picks which thread's move to play, returning its index.
+// Each move gets votes from every thread that chose it, weighted by how
+// deep that thread got and how well it scored the move (relative to the
+// worst-scoring thread, so every vote is positive): a move several
+// threads agree on at high depth beats one a single thread happened to
+// score highest. The main thread (index 0) wins ties, and proven mates
+// override the vote -- a thread that found a faster mate is simply right.
+// Threads that never completed an iteration don't vote.
+func voteBestThread(results []threadResult) int {
+	minScore := results[0].score
+	for _, r := range results {
+		if r.depth > 0 {
+			minScore = min(minScore, r.score)
+		}
+	}
+
+	votes := make(map[Move]int64)
+	for _, r := range results {
+		if r.depth > 0 {
+			votes[r.move&0xffff] += int64(r.score-minScore+14) * int64(r.depth)
+		}
+	}
+
+	best := 0
+	for i, r := range results[1:] {
+		i++
+		if r.depth == 0 {
+			continue
+		}
+		bestResult := results[best]
+		switch {
+		case r.score >= MateScoreThreshold || bestResult.score >= MateScoreThreshold:
+			if r.score > bestResult.score {
+				best = i
+			}
+		case votes[r.move&0xffff] > votes[bestResult.move&0xffff]:
+			best = i
+		}
+	}
+	return best
+}
+
+// Helper diversification patterns, indexed by (threadIndex-1) modulo their
+// length: helper n searches iteration d only if
+// (d+skipPhase[n])/skipSize[n] is even. Helpers 1 and 2 split the depths
+// between them odd/even, the next four each take two depths in four, and
+// so on, so at any moment the helpers are spread across several depths
+// rather than bunched on the main thread's.
+var skipSize = [...]int{1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4}
+var skipPhase = [...]int{0, 1, 0, 1, 2, 3, 0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 5, 6, 7}
+
+// startDepth is the first iteration this thread searches: 1 for the main
+// thread, staggered 1-3 across successive pairs of helpers.
+func (search *Search) startDepth() int {
+	if search.threadIndex == 0 {
+		return 1
+	}
+	return 1 + (search.threadIndex-1)/2%3
+}
+
+// skipDepth reports whether this thread skips iteration depth (see
+// skipSize). The main thread never does.
+func (search *Search) skipDepth(depth int) bool {
+	if search.threadIndex == 0 {
+		return false
+	}
+	n := (search.threadIndex - 1) % len(skipSize)
+	return (depth+skipPhase[n])/skipSize[n]%2 != 0
 }
@@ -0,0 +1,80 @@
+package engine_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"silverfish/engine"
+)
+
+// With several threads, each diversifying its iterative deepening
+// differently, the voted result must still be a correct one: here, the
+// forced mate in 2, reported with a mate score.
+func TestLazySMPFindsMate(t *testing.T) {
+	defer func(old int) { engine.Threads = old }(engine.Threads)
+	engine.Threads = 4
+	engine.ClearTT()
+
+	pos := engine.FromFEN("r2qkb1r/pp2nppp/3p4/2pNN1B1/2BnP3/3P4/PPP2PPP/R2bK2R w KQkq - 1 1")
+	search := engine.Search{MaxDepth: 6, TimeLimit: 10 * time.Second}
+	search.Init(&pos)
+
+	var score int32
+	var move engine.Move
+	captureStdout(t, func() { score, move = engine.SearchLazySMP(&search) })
+
+	if score < engine.MateScoreThreshold {
+		t.Errorf("score = %d, want a mate score", score)
+	}
+	legal := false
+	for _, lm := range pos.LegalMoves() {
+		if lm&0xffff == move&0xffff {
+			legal = true
+		}
+	}
+	if !legal {
+		t.Fatalf("best move %s is not legal", move.ToString())
+	}
+	pos.DoMove(move)
+	if !isMatedWithin(&pos, 1) {
+		t.Errorf("best move %s doesn't force mate in 2", move.ToString())
+	}
+	if search.TotalNodes <= search.Nodes {
+		t.Errorf("TotalNodes = %d, want more than the main thread's %d", search.TotalNodes, search.Nodes)
+	}
+}
+
+// `go nodes N` is a budget for all the threads together: with two, the
+// reported total has to come out at N -- give or take the batch of nodes
+// each thread searches between publishing its count, and the few it
+// counts as it unwinds, but nowhere near the 2N of each thread having a
+// budget of its own -- and no info line may report more.
+func TestLazySMPNodeLimit(t *testing.T) {
+	defer func(old int) { engine.Threads = old }(engine.Threads)
+	engine.Threads = 2
+	engine.ClearTT()
+
+	const limit, slack = 20000, 5000
+	pos := engine.FromFEN("r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3")
+	search := engine.Search{MaxDepth: engine.MaxKillerPly - 1, TimeLimit: engine.InfiniteMovetime, NodeLimit: limit}
+	search.Init(&pos)
+
+	output := captureStdout(t, func() { engine.SearchLazySMP(&search) })
+
+	if search.TotalNodes < limit || search.TotalNodes > limit+slack {
+		t.Errorf("TotalNodes = %d, want %d (+%d at most)", search.TotalNodes, limit, slack)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] != "nodes" {
+				continue
+			}
+			if nodes, _ := strconv.Atoi(fields[i+1]); nodes > limit+slack {
+				t.Errorf("info line reports %d nodes, over the %d limit: %q", nodes, limit, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Search tree tracing: with Search.Trace set, the main search records the
+// tree it actually walks -- every alphaBetaInner node with its window,
+// depth, LMR reduction, TT outcome, the reason it was cut short (if any)
+// and the score it returned, plus the moves skipped by futility and late
+// move pruning -- so a bad move can be explained after the fact instead of
+// guessed at from node counts. Quiescence nodes aren't recorded: a depth-0
+// node's score is its quiescence result, and recording the capture
+// sequences below it would swamp everything else.
+//
+// Only the latest iterative-deepening iteration is kept (each iteration
+// starts a new tree), and MaxPly/MaxNodes bound how much of it is
+// recorded, since a full tree at any interesting depth is millions of
+// nodes. Tracing costs a nil check per node when off. See
+// tools/search_trace.go for recording a dump and exploring it.
+
+// Reasons recorded in TraceNode.Pruned. The first group ends a node early,
+// the second marks a move that was skipped without being searched at all.
+const (
+	PruneDraw            = "draw"
+	PruneMateDistance    = "mate-distance"
+	PruneTT              = "tt"
+	PruneReverseFutility = "reverse-futility"
+	PruneRazoring        = "razoring"
+	PruneNullMove        = "null-move"
+	PruneStopped         = "stopped" // the search ran out of time/nodes: the score is meaningless
+
+	PruneFutility = "futility"
+	PruneLateMove = "late-move"
+)
+
+// TraceNode is one node of a traced search tree. Alpha, Beta and Score are
+// from the point of view of the side to move at the node (negamax), as
+// passed to and returned from alphaBetaInner; Depth is the remaining depth
+// it was called with (after any Reduction, before IIR). A move that LMR
+// re-searches appears once per search, in order, so the last child for a
+// move is the one whose score counted.
+type TraceNode struct {
+	Move      string       `json:"move,omitempty"` // move leading here; "0000" for a null move, "" at the root
+	Ply       int          `json:"ply"`
+	Depth     int          `json:"depth"`
+	Alpha     int32        `json:"alpha"`
+	Beta      int32        `json:"beta"`
+	Reduction int          `json:"reduction,omitempty"`
+	TTHit     bool         `json:"ttHit,omitempty"`
+	TTCutoff  bool         `json:"ttCutoff,omitempty"`
+	Pruned    string       `json:"pruned,omitempty"`
+	Score     int32        `json:"score"`
+	Truncated bool         `json:"truncated,omitempty"` // some children weren't recorded (MaxPly/MaxNodes)
+	Children  []*TraceNode `json:"children,omitempty"`
+}
+
+// Tracer collects a search tree. MaxPly and MaxNodes limit recording to
+// nodes at most MaxPly plies from the root, and to MaxNodes nodes per
+// iteration; 0 means no limit.
+type Tracer struct {
+	MaxPly   int
+	MaxNodes int
+
+	// Root is the tree of the latest iteration, and Nodes the number of
+	// nodes recorded in it.
+	Root  *TraceNode
+	Nodes int
+
+	// path is the stack of nodes from Root to the node being searched,
+	// with nil for nodes that weren't recorded (so enter/exit still pair
+	// up below them).
+	path []*TraceNode
+}
+
+// NewTracer returns a Tracer with the given limits.
+func NewTracer(maxPly, maxNodes int) *Tracer {
+	return &Tracer{MaxPly: maxPly, MaxNodes: maxNodes}
+}
+
+func (t *Tracer) newIteration(depth int, alpha, beta int32) {
+	t.Root = &TraceNode{Depth: depth, Alpha: alpha, Beta: beta}
+	t.Nodes = 1
+	t.path = append(t.path[:0], t.Root)
+}
+
+func (t *Tracer) current() *TraceNode {
+	if len(t.path) == 0 {
+		return nil
+	}
+	return t.path[len(t.path)-1]
+}
+
+// record adds a child of the current node, if the limits allow it.
+func (t *Tracer) record(move string, ply, depth int, alpha, beta int32, reduction int) *TraceNode {
+	parent := t.current()
+	if parent == nil {
+		return nil
+	}
+	if (t.MaxPly > 0 && ply > t.MaxPly) || (t.MaxNodes > 0 && t.Nodes >= t.MaxNodes) {
+		parent.Truncated = true
+		return nil
+	}
+	node := &TraceNode{Move: move, Ply: ply, Depth: depth, Alpha: alpha, Beta: beta, Reduction: reduction}
+	parent.Children = append(parent.Children, node)
+	t.Nodes++
+	return node
+}
+
+func (t *Tracer) enter(move string, ply, depth int, alpha, beta int32, reduction int) {
+	t.path = append(t.path, t.record(move, ply, depth, alpha, beta, reduction))
+}
+
+func (t *Tracer) exit(score int32, stopped bool) {
+	node := t.current()
+	t.path = t.path[:len(t.path)-1]
+	if node == nil {
+		return
+	}
+	node.Score = score
+	if stopped && node.Pruned == "" {
+		node.Pruned = PruneStopped
+	}
+}
+
+// The Search-side hooks, each a no-op unless tracing.
+
+func traceMoveString(move Move) string {
+	if move == 0 {
+		return "0000"
+	}
+	return move.ToString()
+}
+
+func (search *Search) traceIteration(depth int, alpha, beta int32) {
+	if search.Trace != nil {
+		search.Trace.newIteration(depth, alpha, beta)
+	}
+}
+
+// traceEnter is called just before searching move's child node, with the
+// child's own (negated) window.
+func (search *Search) traceEnter(move Move, ply, depth int, alpha, beta int32, reduction int) {
+	if search.Trace != nil {
+		search.Trace.enter(traceMoveString(move), ply, depth, alpha, beta, reduction)
+	}
+}
+
+// traceExit is called just after the child returns, with its score from
+// its own point of view.
+func (search *Search) traceExit(score int32) {
+	if search.Trace != nil {
+		search.Trace.exit(score, search.timedOut)
+	}
+}
+
+// traceSkip records a move skipped without a search.
+func (search *Search) traceSkip(move Move, ply, depth int, reason string) {
+	if search.Trace != nil {
+		if node := search.Trace.record(traceMoveString(move), ply, depth, 0, 0, 0); node != nil {
+			node.Pruned = reason
+		}
+	}
+}
+
+// tracePrune records why the current node returned early.
+func (search *Search) tracePrune(reason string) {
+	if search.Trace != nil {
+		if node := search.Trace.current(); node != nil && node.Pruned == "" {
+			node.Pruned = reason
+		}
+	}
+}
+
+func (search *Search) traceTT(hit, cutoff bool) {
+	if search.Trace != nil {
+		if node := search.Trace.current(); node != nil {
+			node.TTHit = hit
+			node.TTCutoff = cutoff
+			if cutoff {
+				node.Pruned = PruneTT
+			}
+		}
+	}
+}
+
+// TraceDump is a traced search as written to disk: the position and
+// outcome of the search, and the tree of its last iteration.
+type TraceDump struct {
+	FEN      string     `json:"fen"`
+	MaxPly   int        `json:"maxPly,omitempty"`
+	MaxNodes int        `json:"maxNodes,omitempty"`
+	Nodes    int        `json:"nodes"` // recorded in Root, not searched
+	BestMove string     `json:"bestMove"`
+	Score    int32      `json:"score"`
+	PV       []string   `json:"pv"`
+	Root     *TraceNode `json:"root"`
+}
+
+// NewTraceDump packages the trace of a finished search, given the score
+// and move it returned. Call it before anything else touches the TT, since
+// the PV is read back from it.
+func NewTraceDump(search *Search, score int32, bestMove Move) *TraceDump {
+	dump := &TraceDump{
+		FEN:      search.Pos.ToFEN(),
+		BestMove: bestMove.ToString(),
+		Score:    score,
+	}
+	if search.Trace != nil {
+		dump.MaxPly = search.Trace.MaxPly
+		dump.MaxNodes = search.Trace.MaxNodes
+		dump.Nodes = search.Trace.Nodes
+		dump.Root = search.Trace.Root
+	}
+	for _, move := range search.PV(MaxKillerPly) {
+		dump.PV = append(dump.PV, move.ToString())
+	}
+	return dump
+}
+
+// WriteJSON writes the dump as JSON.
+func (dump *TraceDump) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(dump)
+}
+
+// ReadTraceDump reads a dump written by WriteJSON.
+func ReadTraceDump(r io.Reader) (*TraceDump, error) {
+	var dump TraceDump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return nil, err
+	}
+	return &dump, nil
+}
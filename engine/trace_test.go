@@ -0,0 +1,85 @@
+package engine_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"silverfish/engine"
+)
+
+func maxTracePly(node *engine.TraceNode) int {
+	deepest := node.Ply
+	for _, child := range node.Children {
+		deepest = max(deepest, maxTracePly(child))
+	}
+	return deepest
+}
+
+func countTraceNodes(node *engine.TraceNode) int {
+	n := 1
+	for _, child := range node.Children {
+		n += countTraceNodes(child)
+	}
+	return n
+}
+
+// Tracing must only observe the search: the same result and node count as
+// an untraced one, a tree within the configured limits, and a dump that
+// survives a JSON round trip.
+func TestSearchTrace(t *testing.T) {
+	const fen = "r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4"
+	run := func(tracer *engine.Tracer) (*engine.Search, int32, engine.Move) {
+		engine.ClearTT()
+		pos := engine.FromFEN(fen)
+		search := &engine.Search{MaxDepth: 5, TimeLimit: 10 * time.Second, Trace: tracer}
+		search.Init(&pos)
+		var score int32
+		var move engine.Move
+		captureStdout(t, func() { score, move = search.Search() })
+		return search, score, move
+	}
+
+	plain, wantScore, wantMove := run(nil)
+	search, score, move := run(engine.NewTracer(4, 3000))
+	if score != wantScore || move != wantMove || search.Nodes != plain.Nodes {
+		t.Fatalf("traced search gave %s %d in %d nodes, untraced %s %d in %d",
+			move.ToString(), score, search.Nodes, wantMove.ToString(), wantScore, plain.Nodes)
+	}
+
+	root := search.Trace.Root
+	if root.Depth != 5 || root.Score != score {
+		t.Errorf("root depth %d score %d, want the last iteration (5) and the search's score %d", root.Depth, root.Score, score)
+	}
+	if got := countTraceNodes(root); got != search.Trace.Nodes || got > 3000 {
+		t.Errorf("tree holds %d nodes, Tracer.Nodes = %d, limit 3000", got, search.Trace.Nodes)
+	}
+	if got := maxTracePly(root); got > 4 {
+		t.Errorf("recorded a node at ply %d, past MaxPly 4", got)
+	}
+
+	pos := engine.FromFEN(fen)
+	legal := map[string]bool{}
+	for _, m := range pos.LegalMoves() {
+		legal[m.ToString()] = true
+	}
+	for _, child := range root.Children {
+		if !legal[child.Move] || child.Ply != 1 {
+			t.Errorf("root child %+v is not a legal ply-1 move", child)
+		}
+	}
+
+	var buf bytes.Buffer
+	dump := engine.NewTraceDump(search, score, move)
+	if err := dump.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	back, err := engine.ReadTraceDump(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.FEN != fen || back.BestMove != move.ToString() || len(back.PV) == 0 || back.PV[0] != back.BestMove ||
+		countTraceNodes(back.Root) != search.Trace.Nodes {
+		t.Errorf("dump didn't round-trip: fen %q bestmove %s pv %v, %d nodes", back.FEN, back.BestMove, back.PV, countTraceNodes(back.Root))
+	}
+}
@@ -1,8 +1,9 @@
 package engine
 
 import (
-	"sync"
+	"math"
 	"sync/atomic"
+	"unsafe"
 )
 
 // Transposition table: caches search results keyed by Position.Hash, so a
@@ -11,120 +12,280 @@ import (
 // available to order search at every node on every iterative-deepening
 // pass.
 //
-// Lazy SMP (see smp.go) shares this table across search goroutines with no
-// synchronization on individual reads/writes other than the shard locks
-// below -- torn reads are caught by the Key check (a torn read essentially
-// never coincides with a matching key), so any surviving corruption just
-// looks like an ordinary probe miss. The shard locks exist only to stop the
-// Go race detector/runtime from tripping over concurrent struct read/write
-// (a real data race on a multi-word struct in Go, unlike on e.g. x86 with
-// aligned words), not because the entry needs to be logically atomic.
+// The table is an array of 64-byte (one cache line) clusters of
+// ttClusterSize entries, each entry two 64-bit words: a packed data word
+// (move, score, eval) and a key word holding the key's upper 48 bits and
+// the entry's depth, bound and generation, XORed with the data word. Lazy
+// SMP (see smp.go) shares the table across search goroutines with no locks
+// at all: every word is read and written atomically (so the Go race
+// detector has nothing to report), but an entry's two words are written
+// separately, so a probe can see one thread's key word next to another's
+// data word. The XOR catches that -- un-XORing a torn pair yields garbage
+// key bits, which fail verification and read as an ordinary miss -- so a
+// probe never returns a data word that wasn't stored under its key.
+//
+// The engine's searches all use one table, sharedTT, which the exported TT
+// functions below operate on; a datagen SelfPlayer has one of its own (see
+// datagen.go), so its games don't depend on what the others played.
 
 const (
-	BoundNone uint8 = iota
+	BoundNone  uint8 = iota
 	BoundExact       // Score is the position's true value.
 	BoundLower       // Fail-high: the true value is >= Score.
 	BoundUpper       // Fail-low: the true value is <= Score.
 )
 
-// TTSizeMB is deliberately modest for a first implementation -- SPRT runs
-// many engine instances concurrently on one machine, so this is per-process
-// resident memory, not a one-off cost.
+// TTSizeMB is the default table size (the UCI "Hash" option can change
+// it), deliberately modest -- SPRT runs many engine instances concurrently
+// on one machine, so this is per-process resident memory, not a one-off
+// cost.
 const TTSizeMB = 16
 
+// MaxTTSizeMB is the largest table the UCI "Hash" option accepts.
+const MaxTTSizeMB = 65536
+
+// TTEntry is an unpacked table entry, as returned by TTProbe.
 type TTEntry struct {
 	Key   uint64
 	Move  Move // low 16 bits only -- Move's bits 16+ are a mutable score field, never compared/stored.
 	Score int32
+	Eval  int32 // static eval of the position, or noEval if none was computed (in check)
 	Depth int16
 	Bound uint8
 }
 
-const ttEntrySize = 32 // approx size of TTEntry in bytes, rounded up to a power of 2 for a clean table size
+// TTDepthQS and TTDepthQSNoChecks are the depths recorded for entries
+// stored by Quiescence: TTDepthQS at its first ply, which also searches
+// quiet checks, and TTDepthQSNoChecks deeper in, where only captures and
+// promotions are searched -- a result that never looked at quiet checks
+// must not cut off a probe that would have. Both are below every real
+// alphaBetaInner depth (those are always >= 1 by the time they store), so
+// a quiescence result is only ever used as a cutoff by another quiescence
+// probe or a depth-0 alphaBetaInner node -- which is itself about to drop
+// into quiescence -- and never passes for a real search.
+const (
+	TTDepthQS         = 0
+	TTDepthQSNoChecks = -1
+)
 
-var tt []TTEntry
-var ttMask uint64
+// ttClusterSize entries of two words each fill one 64-byte cache line, so
+// a probe touches exactly one line.
+const ttClusterSize = 4
 
-// ttShardBits sizes the shard-lock array well below any realistic table size
-// (TTSizeMB=16 gives ~2^19 entries), so lock contention is spread across
-// many shards rather than funneling through one mutex.
-const ttShardBits = 10
-const ttNumShards = 1 << ttShardBits
+type ttCluster [ttClusterSize][2]uint64
 
-var ttLocks [ttNumShards]sync.Mutex
+const ttClusterBytes = int(unsafe.Sizeof(ttCluster{}))
+
+// ttTable is a transposition table.
+type ttTable struct {
+	clusters []ttCluster
+	mask     uint64 // number of clusters minus one; key&mask picks the cluster
+
+	// generation is bumped once per search (newSearch) and stamped on
+	// every entry stored, so replacement can tell this search's entries
+	// from stale ones left over from earlier moves. Wraps within
+	// ttGenerationBits.
+	generation uint32
+}
 
-// ttSMPActive gates shard locking entirely. Single-threaded search (the
-// common case -- Threads=1) never touches this, so it pays no locking cost
-// at all; it's flipped on only around a multi-goroutine Lazy SMP search (see
-// smp.go).
-var ttSMPActive int32
+// sharedTT is the table every search uses unless given its own (see
+// Search.tt).
+var sharedTT ttTable
 
-// allocTT allocates the transposition table. Called from Init().
-func allocTT(sizeMB int) {
-	numEntries := sizeMB * 1024 * 1024 / ttEntrySize
-	// round down to a power of two so key&ttMask is a valid index
+// Packed layout. The data word holds the move (16 bits), score (24 bits,
+// signed) and static eval (24 bits, signed) -- ample for mate scores, which
+// sit just below +-Infinity. The key word's low 16 bits hold the depth
+// (signed byte), bound (2 bits) and generation (ttGenerationBits); the
+// remaining 48 are the key's own upper 48 bits, verified on probe. The low
+// bits of the key pick the cluster, so they'd add nothing to the check.
+const (
+	ttScoreShift = 16
+	ttEvalShift  = 40
+	ttFieldBits  = 24
+	ttFieldMax   = 1<<(ttFieldBits-1) - 1
+
+	ttBoundShift     = 8
+	ttGenShift       = 10
+	ttGenerationBits = 6
+	ttGenerationMask = 1<<ttGenerationBits - 1
+	ttMetaMask       = 0xffff
+)
+
+// ttReplaceAgeWeight is how many plies of depth one generation of age is
+// worth when choosing which entry of a full cluster to overwrite: the
+// victim is the entry with the lowest depth - ttReplaceAgeWeight*age.
+const ttReplaceAgeWeight = 8
+
+// alloc (re)allocates the table at sizeMB megabytes, rounded down to a
+// power-of-two number of clusters, discarding its contents.
+func (t *ttTable) alloc(sizeMB int) {
+	numClusters := sizeMB * 1024 * 1024 / ttClusterBytes
+	// round down to a power of two so key&mask is a valid index
 	pow := 1
-	for pow*2 <= numEntries {
+	for pow*2 <= numClusters {
 		pow *= 2
 	}
-	tt = make([]TTEntry, pow)
-	ttMask = uint64(pow - 1)
+	t.clusters = newTTClusters(pow)
+	t.mask = uint64(pow - 1)
+	t.generation = 0
+}
+
+// reset empties the table.
+func (t *ttTable) reset() {
+	clear(t.clusters)
+	t.generation = 0
+}
+
+// newSearch starts a new table generation.
+func (t *ttTable) newSearch() {
+	t.generation = (t.generation + 1) & ttGenerationMask
+}
+
+// newTTClusters allocates n zeroed clusters, aligned to a cache line: Go
+// only guarantees 8-byte alignment for a []ttCluster, so this allocates one
+// spare cluster and starts the table at the first cache-line boundary
+// inside it -- otherwise most clusters would straddle two lines and every
+// probe would pay for both.
+func newTTClusters(n int) []ttCluster {
+	buf := make([]ttCluster, n+1)
+	offset := 0
+	if misalign := int(uintptr(unsafe.Pointer(&buf[0])) % uintptr(ttClusterBytes)); misalign != 0 {
+		offset = ttClusterBytes - misalign
+	}
+	return unsafe.Slice((*ttCluster)(unsafe.Add(unsafe.Pointer(&buf[0]), offset)), n)
+}
+
+// ResizeTT reallocates the transposition table at sizeMB megabytes (rounded
+// down to a power-of-two number of clusters), discarding its contents. Set
+// via the UCI "Hash" option. Must not run concurrently with a search.
+func ResizeTT(sizeMB int) {
+	sharedTT.alloc(sizeMB)
+}
+
+// TTSize returns the transposition table's current size in megabytes.
+func TTSize() int {
+	return int(sharedTT.mask+1) * ttClusterBytes / (1024 * 1024)
 }
 
 // ClearTT resets the transposition table. Should be called on ucinewgame:
 // stale entries from a previous game are still key-verified before use, but
-// clearing avoids wasting the table on positions that can't recur.
+// clearing avoids wasting the table on positions that can't recur. Must not
+// run concurrently with a search.
 func ClearTT() {
-	for i := range tt {
-		tt[i] = TTEntry{}
-	}
+	sharedTT.reset()
+}
+
+// TTNewSearch starts a new table generation. Called once per search, before
+// any thread starts (see SearchLazySMP).
+func TTNewSearch() {
+	sharedTT.newSearch()
+}
+
+func packTTData(move Move, score, eval int32) uint64 {
+	score = max(-ttFieldMax, min(ttFieldMax, score))
+	eval = max(-ttFieldMax, min(ttFieldMax, eval))
+	return uint64(move&0xffff) |
+		uint64(uint32(score)&(1<<ttFieldBits-1))<<ttScoreShift |
+		uint64(uint32(eval)&(1<<ttFieldBits-1))<<ttEvalShift
+}
+
+// unpackTTField sign-extends one of the data word's 24-bit fields.
+func unpackTTField(data uint64, shift int) int32 {
+	return int32(uint32(data>>shift)<<(32-ttFieldBits)) >> (32 - ttFieldBits)
+}
+
+func packTTMeta(depth int, bound uint8, generation uint32) uint64 {
+	depth = max(-128, min(127, depth))
+	return uint64(uint8(int8(depth))) | uint64(bound)<<ttBoundShift | uint64(generation)<<ttGenShift
+}
+
+func ttMetaDepth(meta uint64) int           { return int(int8(uint8(meta))) }
+func ttMetaBound(meta uint64) uint8         { return uint8(meta>>ttBoundShift) & 3 }
+func ttMetaGen(meta uint64) uint32          { return uint32(meta>>ttGenShift) & ttGenerationMask }
+func ttKeyMatches(key, keyWord uint64) bool { return keyWord&^ttMetaMask == key&^ttMetaMask }
+
+// loadTTEntry atomically reads both words of an entry and returns the data
+// word and the un-XORed key word.
+func loadTTEntry(entry *[2]uint64) (data, keyWord uint64) {
+	data = atomic.LoadUint64(&entry[1])
+	keyWord = atomic.LoadUint64(&entry[0]) ^ data
+	return data, keyWord
+}
+
+// age is how many generations ago an entry was stored.
+func (t *ttTable) age(meta uint64) int {
+	return int((t.generation - ttMetaGen(meta)) & ttGenerationMask)
 }
 
 // TTProbe returns the entry for key and whether it was found. A non-zero
 // Move field is usable for ordering even when the caller can't use the
 // score itself (e.g. insufficient stored depth).
 func TTProbe(key uint64) (TTEntry, bool) {
-	idx := key & ttMask
-	if atomic.LoadInt32(&ttSMPActive) != 0 {
-		mu := &ttLocks[idx&(ttNumShards-1)]
-		mu.Lock()
-		e := tt[idx]
-		mu.Unlock()
-		if e.Bound == BoundNone || e.Key != key {
-			return TTEntry{}, false
+	return sharedTT.probe(key)
+}
+
+func (t *ttTable) probe(key uint64) (TTEntry, bool) {
+	cluster := &t.clusters[key&t.mask]
+	for i := range cluster {
+		data, keyWord := loadTTEntry(&cluster[i])
+		if !ttKeyMatches(key, keyWord) || ttMetaBound(keyWord) == BoundNone {
+			continue
 		}
-		return e, true
+		return TTEntry{
+			Key:   key,
+			Move:  Move(data & 0xffff),
+			Score: unpackTTField(data, ttScoreShift),
+			Eval:  unpackTTField(data, ttEvalShift),
+			Depth: int16(ttMetaDepth(keyWord)),
+			Bound: ttMetaBound(keyWord),
+		}, true
 	}
-	e := tt[idx]
-	if e.Bound == BoundNone || e.Key != key {
-		return TTEntry{}, false
-	}
-	return e, true
-}
-
-// TTStore records a search result. Replacement is simple depth-preferred:
-// an incoming entry always wins on an empty slot, a different key (a
-// collision -- always replacing avoids permanently wedging a stale entry
-// from a different position into that slot), or when it comes from at
-// least as deep a search as what's already there.
-func TTStore(key uint64, move Move, score int32, depth int, bound uint8) {
-	idx := key & ttMask
-	entry := TTEntry{
-		Key:   key,
-		Move:  move & 0xffff,
-		Score: score,
-		Depth: int16(depth),
-		Bound: bound,
-	}
-	if atomic.LoadInt32(&ttSMPActive) != 0 {
-		mu := &ttLocks[idx&(ttNumShards-1)]
-		mu.Lock()
-		defer mu.Unlock()
-	}
-	existing := &tt[idx]
-	if existing.Bound == BoundNone || existing.Key != key || int16(depth) >= existing.Depth {
-		*existing = entry
+	return TTEntry{}, false
+}
+
+// TTStore records a search result, along with the position's static eval
+// (so a later visit can skip re-evaluating it). If the cluster already
+// holds this key, that entry is updated only if the incoming result comes
+// from at least as deep a search, or the existing one is from an earlier
+// generation; a result without a move keeps the one already stored.
+// Otherwise the new entry takes an empty slot, or failing that evicts the
+// slot with the lowest depth - ttReplaceAgeWeight*age -- shallow entries
+// and ones left over from earlier searches go first.
+func TTStore(key uint64, move Move, score int32, eval int32, depth int, bound uint8) {
+	sharedTT.store(key, move, score, eval, depth, bound)
+}
+
+func (t *ttTable) store(key uint64, move Move, score int32, eval int32, depth int, bound uint8) {
+	cluster := &t.clusters[key&t.mask]
+
+	victim := 0
+	victimValue := math.MaxInt
+	for i := range cluster {
+		data, keyWord := loadTTEntry(&cluster[i])
+		if ttMetaBound(keyWord) != BoundNone && ttKeyMatches(key, keyWord) {
+			if depth < ttMetaDepth(keyWord) && t.age(keyWord) == 0 {
+				return
+			}
+			if move&0xffff == 0 {
+				move = Move(data & 0xffff)
+			}
+			victim = i
+			break
+		}
+
+		value := math.MinInt // an empty slot is always the first choice
+		if ttMetaBound(keyWord) != BoundNone {
+			value = ttMetaDepth(keyWord) - ttReplaceAgeWeight*t.age(keyWord)
+		}
+		if value < victimValue {
+			victim, victimValue = i, value
+		}
 	}
+
+	data := packTTData(move, score, eval)
+	keyWord := key&^ttMetaMask | packTTMeta(depth, bound, t.generation)
+	atomic.StoreUint64(&cluster[victim][1], data)
+	atomic.StoreUint64(&cluster[victim][0], keyWord^data)
 }
 
 // ScoreToTT/ScoreFromTT convert between a node-relative score (as used
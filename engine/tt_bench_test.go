@@ -0,0 +1,47 @@
+package engine_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"silverfish/engine"
+)
+
+// Probe throughput of the shared, lockless TT with 1-16 goroutines
+// hammering it at once (a 1:8 store:probe mix over a working set far
+// bigger than the cache, roughly what Lazy SMP does to it). ns/op is per
+// operation summed over all goroutines, so perfect scaling shows as ns/op
+// falling in proportion to the goroutine count (up to the core count).
+func BenchmarkTTProbeParallel(b *testing.B) {
+	const workingSet = 1 << 20
+	keys := make([]uint64, workingSet)
+	for i := range keys {
+		keys[i] = engine.Rng.Uint64()
+	}
+
+	for _, threads := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("threads=%d", threads), func(b *testing.B) {
+			engine.ClearTT()
+			perThread := b.N/threads + 1
+
+			b.ResetTimer()
+			var wg sync.WaitGroup
+			for g := 0; g < threads; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < perThread; i++ {
+						key := keys[(i*threads+g)%workingSet]
+						if i%8 == 0 {
+							engine.TTStore(key, engine.Move(i), int32(i), 0, i%20, engine.BoundExact)
+						} else {
+							engine.TTProbe(key)
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Transposition table persistence: SaveTT writes the whole table to a
+// versioned binary file and LoadTT reads one back, so a long analysis can
+// be paused and resumed without losing its hash contents. The layout (all
+// little-endian) is a ttFileHeader, then every cluster's words in table
+// order, then a CRC-32C of everything before it.
+//
+// A saved table is only meaningful to an engine hashing positions exactly
+// the same way, so the header also carries a fingerprint of the Zobrist
+// keys; a file from a build with different keys is rejected rather than
+// loaded as garbage that happens to pass key verification. The table's
+// size is part of the file too: loading resizes the table to the size it
+// was saved with (each key's cluster depends on the cluster count, so the
+// entries can't be redistributed into a table of a different size).
+
+const (
+	ttFileMagic   = "SFTT"
+	ttFileVersion = 1
+
+	// maxTTFileClusters bounds the cluster count a file may claim (64 GB
+	// of table), so a corrupt header can't trigger an absurd allocation
+	// before the checksum gets a chance to reject it.
+	maxTTFileClusters = 1 << 30
+)
+
+type ttFileHeader struct {
+	Magic          [4]byte
+	Version        uint32
+	ClusterBytes   uint32
+	Generation     uint32
+	NumClusters    uint64 // the table's mask+1
+	KeyFingerprint uint64
+}
+
+var ttFileCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// zobristFingerprint condenses the Zobrist keys into one value that changes
+// if any of them does.
+func zobristFingerprint() uint64 {
+	h := TurnKey
+	for piece := range PieceSqKeys {
+		for sq := range PieceSqKeys[piece] {
+			h = h*0x100000001b3 ^ PieceSqKeys[piece][sq]
+		}
+	}
+	for _, key := range CastleKeys {
+		h = h*0x100000001b3 ^ key
+	}
+	for _, key := range EnPassantKeys {
+		h = h*0x100000001b3 ^ key
+	}
+	for _, key := range ContemptKeys {
+		h = h*0x100000001b3 ^ key
+	}
+	return h
+}
+
+// SaveTT writes the transposition table to w. Must not run concurrently
+// with a search.
+func SaveTT(w io.Writer) error {
+	crc := crc32.New(ttFileCRCTable)
+	bw := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	header := ttFileHeader{
+		Version:        ttFileVersion,
+		ClusterBytes:   uint32(ttClusterBytes),
+		Generation:     sharedTT.generation,
+		NumClusters:    sharedTT.mask + 1,
+		KeyFingerprint: zobristFingerprint(),
+	}
+	copy(header.Magic[:], ttFileMagic)
+	if err := binary.Write(bw, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	var buf [ttClusterBytes]byte
+	for i := range sharedTT.clusters {
+		for j := range sharedTT.clusters[i] {
+			binary.LittleEndian.PutUint64(buf[j*16:], sharedTT.clusters[i][j][0])
+			binary.LittleEndian.PutUint64(buf[j*16+8:], sharedTT.clusters[i][j][1])
+		}
+		if _, err := bw.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.LittleEndian, crc.Sum32())
+}
+
+// LoadTT replaces the transposition table with one read from r (as written
+// by SaveTT), resizing it to the saved size. The file is validated in full
+// -- magic, version, layout, Zobrist fingerprint, checksum, no trailing
+// data -- before anything is installed, so on error the current table is
+// left untouched. Must not run concurrently with a search.
+func LoadTT(r io.Reader) error {
+	crc := crc32.New(ttFileCRCTable)
+	br := bufio.NewReader(r)
+	tr := io.TeeReader(br, crc)
+
+	var header ttFileHeader
+	if err := binary.Read(tr, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	switch {
+	case string(header.Magic[:]) != ttFileMagic:
+		return errors.New("not a transposition table file")
+	case header.Version != ttFileVersion:
+		return fmt.Errorf("unsupported version %d (want %d)", header.Version, ttFileVersion)
+	case header.ClusterBytes != uint32(ttClusterBytes):
+		return fmt.Errorf("cluster size %d bytes, want %d", header.ClusterBytes, ttClusterBytes)
+	case header.NumClusters == 0 || header.NumClusters&(header.NumClusters-1) != 0 || header.NumClusters > maxTTFileClusters:
+		return fmt.Errorf("invalid cluster count %d", header.NumClusters)
+	case header.KeyFingerprint != zobristFingerprint():
+		return errors.New("saved by an engine with different Zobrist keys")
+	}
+
+	clusters := newTTClusters(int(header.NumClusters))
+	var buf [ttClusterBytes]byte
+	for i := range clusters {
+		if _, err := io.ReadFull(tr, buf[:]); err != nil {
+			return fmt.Errorf("reading cluster %d: %w", i, err)
+		}
+		for j := range clusters[i] {
+			clusters[i][j][0] = binary.LittleEndian.Uint64(buf[j*16:])
+			clusters[i][j][1] = binary.LittleEndian.Uint64(buf[j*16+8:])
+		}
+	}
+
+	want := crc.Sum32()
+	var got uint32
+	if err := binary.Read(br, binary.LittleEndian, &got); err != nil {
+		return fmt.Errorf("reading checksum: %w", err)
+	}
+	if got != want {
+		return fmt.Errorf("checksum mismatch (file %08x, computed %08x)", got, want)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return errors.New("trailing data after checksum")
+	}
+
+	sharedTT = ttTable{
+		clusters:   clusters,
+		mask:       header.NumClusters - 1,
+		generation: header.Generation & ttGenerationMask,
+	}
+	return nil
+}
+
+// SaveTTFile writes the transposition table to the file at path (see
+// SaveTT).
+func SaveTTFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := SaveTT(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadTTFile loads the transposition table from the file at path (see
+// LoadTT).
+func LoadTTFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return LoadTT(f)
+}
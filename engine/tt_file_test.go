@@ -0,0 +1,86 @@
+package engine_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"silverfish/engine"
+)
+
+// fillTT runs a short search so the table holds real entries, returning
+// the searched position's key and root entry.
+func fillTT(t *testing.T) (uint64, engine.TTEntry) {
+	t.Helper()
+	engine.ClearTT()
+	pos := engine.FromFEN("r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3")
+	search := engine.Search{MaxDepth: 5, TimeLimit: 10 * time.Second}
+	search.Init(&pos)
+	captureStdout(t, func() { search.Search() })
+
+	entry, ok := engine.TTProbe(pos.Hash)
+	if !ok {
+		t.Fatalf("no root entry after searching")
+	}
+	return pos.Hash, entry
+}
+
+func TestSaveLoadTTRoundTrip(t *testing.T) {
+	defer engine.ResizeTT(engine.TTSizeMB)
+	key, want := fillTT(t)
+
+	path := filepath.Join(t.TempDir(), "hash.tt")
+	if err := engine.SaveTTFile(path); err != nil {
+		t.Fatalf("SaveTTFile: %v", err)
+	}
+
+	// Loading restores the saved size as well as the contents.
+	engine.ResizeTT(1)
+	if err := engine.LoadTTFile(path); err != nil {
+		t.Fatalf("LoadTTFile: %v", err)
+	}
+	if engine.TTSize() != engine.TTSizeMB {
+		t.Errorf("TTSize() = %d after loading, want the saved %d", engine.TTSize(), engine.TTSizeMB)
+	}
+	got, ok := engine.TTProbe(key)
+	if !ok || got != want {
+		t.Errorf("after reload: got %+v (hit %v), want %+v", got, ok, want)
+	}
+}
+
+// A damaged file must be rejected whole, leaving the current table as it
+// was.
+func TestLoadTTRejectsDamagedFiles(t *testing.T) {
+	defer engine.ResizeTT(engine.TTSizeMB)
+	key, want := fillTT(t)
+
+	var saved bytes.Buffer
+	if err := engine.SaveTT(&saved); err != nil {
+		t.Fatalf("SaveTT: %v", err)
+	}
+	good := saved.Bytes()
+
+	flip := func(i int) []byte {
+		b := bytes.Clone(good)
+		b[i] ^= 0x40
+		return b
+	}
+	cases := map[string][]byte{
+		"bad magic":      flip(0),
+		"bad version":    flip(4),
+		"corrupt entry":  flip(len(good) / 2),
+		"bad checksum":   flip(len(good) - 1),
+		"truncated":      good[:len(good)-100],
+		"trailing bytes": append(bytes.Clone(good), 0),
+		"empty":          nil,
+	}
+	for name, data := range cases {
+		if err := engine.LoadTT(bytes.NewReader(data)); err == nil {
+			t.Errorf("%s: LoadTT succeeded, want an error", name)
+		}
+		if got, ok := engine.TTProbe(key); !ok || got != want {
+			t.Errorf("%s: failed load changed the table: got %+v (hit %v), want %+v", name, got, ok, want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package engine_test
 
 import (
+	"sync"
 	"testing"
 
 	"silverfish/engine"
@@ -62,14 +63,14 @@ func TestTTStoreAndProbe(t *testing.T) {
 	pos := engine.StartingPosition()
 	move := engine.NewMoveFromStr("e2e4")
 
-	engine.TTStore(pos.Hash, move, 123, 4, engine.BoundExact)
+	engine.TTStore(pos.Hash, move, 123, 77, 4, engine.BoundExact)
 
 	entry, ok := engine.TTProbe(pos.Hash)
 	if !ok {
 		t.Fatalf("expected a hit after store")
 	}
-	if entry.Score != 123 || entry.Depth != 4 || entry.Bound != engine.BoundExact {
-		t.Errorf("got entry %+v, want score=123 depth=4 bound=Exact", entry)
+	if entry.Score != 123 || entry.Eval != 77 || entry.Depth != 4 || entry.Bound != engine.BoundExact {
+		t.Errorf("got entry %+v, want score=123 eval=77 depth=4 bound=Exact", entry)
 	}
 	if entry.Move.From() != move.From() || entry.Move.To() != move.To() {
 		t.Errorf("got move %v, want %v", entry.Move, move)
@@ -82,7 +83,7 @@ func TestTTMoveIsMaskedToLow16Bits(t *testing.T) {
 	move := engine.NewMoveFromStr("e2e4")
 	move.GiveScore(999) // sets bits 16+, as move ordering does in practice
 
-	engine.TTStore(0xabc, move, 0, 1, engine.BoundExact)
+	engine.TTStore(0xabc, move, 0, 0, 1, engine.BoundExact)
 	entry, ok := engine.TTProbe(0xabc)
 	if !ok {
 		t.Fatalf("expected a hit")
@@ -99,7 +100,7 @@ func TestTTProbeRejectsIndexCollision(t *testing.T) {
 	engine.ClearTT()
 
 	keyA := uint64(0x1122334455667788)
-	engine.TTStore(keyA, engine.NewMoveFromStr("e2e4"), 50, 3, engine.BoundExact)
+	engine.TTStore(keyA, engine.NewMoveFromStr("e2e4"), 50, 0, 3, engine.BoundExact)
 
 	// Same low bits (same table index under any power-of-two mask), but a
 	// different full 64-bit key.
@@ -126,8 +127,8 @@ func TestTTStorePrefersDeeperOnCollision(t *testing.T) {
 	// key twice with different depths, which also exercises the "same key,
 	// deeper replaces shallower" path directly used during real search
 	// (repeated probes/stores of the same position at increasing ID depth).
-	engine.TTStore(keyA, engine.NewMoveFromStr("e2e4"), 10, 2, engine.BoundExact)
-	engine.TTStore(keyA, engine.NewMoveFromStr("d2d4"), 20, 5, engine.BoundExact)
+	engine.TTStore(keyA, engine.NewMoveFromStr("e2e4"), 10, 0, 2, engine.BoundExact)
+	engine.TTStore(keyA, engine.NewMoveFromStr("d2d4"), 20, 0, 5, engine.BoundExact)
 
 	entry, ok := engine.TTProbe(keyA)
 	if !ok {
@@ -138,7 +139,7 @@ func TestTTStorePrefersDeeperOnCollision(t *testing.T) {
 	}
 
 	// A shallower store for the same key must NOT overwrite the deeper one.
-	engine.TTStore(keyA, engine.NewMoveFromStr("g1f3"), 30, 1, engine.BoundExact)
+	engine.TTStore(keyA, engine.NewMoveFromStr("g1f3"), 30, 0, 1, engine.BoundExact)
 	entry, _ = engine.TTProbe(keyA)
 	if entry.Depth != 5 || entry.Score != 20 {
 		t.Errorf("a shallower store overwrote a deeper entry: got depth=%d score=%d", entry.Depth, entry.Score)
@@ -146,7 +147,7 @@ func TestTTStorePrefersDeeperOnCollision(t *testing.T) {
 }
 
 func TestClearTT(t *testing.T) {
-	engine.TTStore(0x42, engine.NewMoveFromStr("e2e4"), 100, 5, engine.BoundExact)
+	engine.TTStore(0x42, engine.NewMoveFromStr("e2e4"), 100, 0, 5, engine.BoundExact)
 	if _, ok := engine.TTProbe(0x42); !ok {
 		t.Fatalf("expected a hit before clearing")
 	}
@@ -157,3 +158,118 @@ func TestClearTT(t *testing.T) {
 		t.Errorf("expected no hit after ClearTT")
 	}
 }
+
+// Every field must survive packing into the table's 64-bit words intact,
+// including the negative extremes: mated-in-N scores, the noEval sentinel,
+// and the quiescence depth sentinels.
+func TestTTPackingRoundTrip(t *testing.T) {
+	cases := []struct {
+		score, eval int32
+		depth       int
+		bound       uint8
+	}{
+		{0, 0, 1, engine.BoundExact},
+		{engine.Infinity - 7, 250, 42, engine.BoundLower},
+		{-(engine.Infinity - 3), -engine.Infinity, engine.TTDepthQS, engine.BoundUpper},
+		{-1234, 5678, engine.TTDepthQSNoChecks, engine.BoundLower},
+		{17, -17, 127, engine.BoundExact},
+	}
+	for i, tc := range cases {
+		engine.ClearTT()
+		key := uint64(0x9e3779b97f4a7c15) * uint64(i+1)
+		move := engine.NewPromotionMove(engine.SquareA7, engine.SquareB8, engine.Knight)
+		engine.TTStore(key, move, tc.score, tc.eval, tc.depth, tc.bound)
+
+		entry, ok := engine.TTProbe(key)
+		if !ok {
+			t.Fatalf("case %d: expected a hit", i)
+		}
+		if entry.Move != move || entry.Score != tc.score || entry.Eval != tc.eval ||
+			int(entry.Depth) != tc.depth || entry.Bound != tc.bound {
+			t.Errorf("case %d: got %+v, want move=%v score=%d eval=%d depth=%d bound=%d",
+				i, entry, move, tc.score, tc.eval, tc.depth, tc.bound)
+		}
+	}
+}
+
+// sameClusterKeys returns n distinct keys that all map to the same cluster
+// (same low bits, differing only in the verified upper bits).
+func sameClusterKeys(n int) []uint64 {
+	keys := make([]uint64, n)
+	for i := range keys {
+		keys[i] = 0x5555 | uint64(i+1)<<50
+	}
+	return keys
+}
+
+// Once a cluster is full, a new key evicts the entry with the lowest depth
+// after discounting for age: shallow entries first, and entries from
+// earlier searches before this search's own.
+func TestTTReplacementByDepthAndAge(t *testing.T) {
+	engine.ClearTT()
+	keys := sameClusterKeys(6)
+	move := engine.NewMoveFromStr("e2e4")
+
+	for i, depth := range []int{5, 2, 7, 4} {
+		engine.TTStore(keys[i], move, 0, 0, depth, engine.BoundExact)
+	}
+	engine.TTStore(keys[4], move, 0, 0, 3, engine.BoundExact)
+
+	if _, ok := engine.TTProbe(keys[1]); ok {
+		t.Errorf("shallowest entry (depth 2) survived a store into a full cluster")
+	}
+	for _, i := range []int{0, 2, 3, 4} {
+		if _, ok := engine.TTProbe(keys[i]); !ok {
+			t.Errorf("entry %d evicted instead of the shallowest one", i)
+		}
+	}
+
+	// Two searches later, even the deepest entry from back then is worth
+	// less than a shallow one from the current search.
+	engine.TTNewSearch()
+	engine.TTNewSearch()
+	engine.TTStore(keys[4], move, 0, 0, 3, engine.BoundExact) // refresh: now current
+	engine.TTStore(keys[5], move, 0, 0, 1, engine.BoundExact)
+	if _, ok := engine.TTProbe(keys[4]); !ok {
+		t.Errorf("current-generation entry evicted ahead of stale ones")
+	}
+	if _, ok := engine.TTProbe(keys[5]); !ok {
+		t.Errorf("new entry not stored")
+	}
+}
+
+// Many goroutines storing and probing overlapping keys with no locking
+// (run under -race to check the table is data-race free): whatever a probe
+// returns must be exactly what some store wrote under that key, never a
+// mix of two stores or another key's data.
+func TestTTConcurrentAccess(t *testing.T) {
+	engine.ClearTT()
+	keys := sameClusterKeys(12) // more keys than slots: constant eviction
+
+	// Each key always stores the same key-derived fields, so a hit is
+	// consistent exactly when its fields match its key.
+	scoreFor := func(key uint64) int32 { return int32(key>>50) * 1000 }
+	evalFor := func(key uint64) int32 { return -int32(key>>50) * 7 }
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20000; i++ {
+				key := keys[(i*7+g)%len(keys)]
+				if i%2 == 0 {
+					engine.TTStore(key, engine.Move(key>>50), scoreFor(key), evalFor(key), int(key>>50), engine.BoundExact)
+					continue
+				}
+				entry, ok := engine.TTProbe(key)
+				if ok && (entry.Score != scoreFor(key) || entry.Eval != evalFor(key) ||
+					entry.Move != engine.Move(key>>50) || int(entry.Depth) != int(key>>50)) {
+					t.Errorf("inconsistent entry for key %x: %+v", key, entry)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
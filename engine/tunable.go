@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Tunable search parameters. Each one is a package-level var (read
+// directly by the search, so tuning costs nothing at runtime) plus an
+// entry in Tunables giving its default and the range and step a tuner
+// should explore. The var itself is declared without a value: Tunables
+// sets every one to its default at package initialization, so the
+// default lives in exactly one place.
+//
+// In a tuning build (go build -tags tuning) every tunable is also a UCI
+// spin option, so an SPSA tuner can set parameters through the engine's
+// normal UCI interface without a rebuild per experiment; normal builds
+// don't advertise them, to keep GUIs' option lists short.
+
+// Tunable is one registered parameter. Step is SPSA's perturbation size
+// (OpenBench's c_end, weather-factory's step): how far apart two values
+// have to be to play measurably differently.
+type Tunable struct {
+	Name                    string
+	Default, Min, Max, Step int
+
+	get func() int
+	set func(int)
+
+	// changed, if set, is called after Set -- for parameters that feed a
+	// precomputed table.
+	changed func()
+}
+
+// Value returns the parameter's current value.
+func (t *Tunable) Value() int {
+	return t.get()
+}
+
+// Set sets the parameter, clamped into [Min, Max].
+func (t *Tunable) Set(value int) {
+	t.set(min(max(value, t.Min), t.Max))
+	if t.changed != nil {
+		t.changed()
+	}
+}
+
+// tunable registers the var at p, setting it to def.
+func tunable[T ~int | ~int32](name string, p *T, def, lo, hi, step int) *Tunable {
+	*p = T(def)
+	return &Tunable{
+		Name:    name,
+		Default: def,
+		Min:     lo,
+		Max:     hi,
+		Step:    step,
+		get:     func() int { return int(*p) },
+		set:     func(v int) { *p = T(v) },
+	}
+}
+
+// withChanged sets t's changed hook.
+func (t *Tunable) withChanged(fn func()) *Tunable {
+	t.changed = fn
+	return t
+}
+
+// FindTunable looks up a registered parameter by name, case-insensitively
+// like UCI option names.
+func FindTunable(name string) *Tunable {
+	for _, t := range Tunables {
+		if strings.EqualFold(t.Name, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+// ResetTunables puts every parameter back to its default.
+func ResetTunables() {
+	for _, t := range Tunables {
+		t.Set(t.Default)
+	}
+}
+
+// uciTunableOptions prints the tunables as UCI spin options (tuning builds
+// only; see UciOptions).
+func uciTunableOptions() {
+	for _, t := range Tunables {
+		fmt.Printf("option name %s type spin default %d min %d max %d\n", t.Name, t.Default, t.Min, t.Max)
+	}
+}
+
+// SPSAInputRate is the r_end written to OpenBench SPSA configs: the final
+// learning rate, OpenBench's customary default.
+const SPSAInputRate = 0.002
+
+// WriteOpenBenchSPSA writes the tunables in OpenBench's SPSA input format,
+// one "name, int, default, min, max, c_end, r_end" line each.
+func WriteOpenBenchSPSA(w io.Writer) error {
+	for _, t := range Tunables {
+		_, err := fmt.Fprintf(w, "%s, int, %d.0, %d.0, %d.0, %d.0, %g\n", t.Name, t.Default, t.Min, t.Max, t.Step, SPSAInputRate)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteWeatherFactorySPSA writes the tunables as a weather-factory
+// config.json parameter object.
+func WriteWeatherFactorySPSA(w io.Writer) error {
+	type param struct {
+		Value    int `json:"value"`
+		MinValue int `json:"min_value"`
+		MaxValue int `json:"max_value"`
+		Step     int `json:"step"`
+	}
+	// Built by hand rather than from a map so the output keeps Tunables'
+	// order.
+	var b strings.Builder
+	b.WriteString("{\n")
+	for i, t := range Tunables {
+		value, err := json.Marshal(param{t.Default, t.Min, t.Max, t.Step})
+		if err != nil {
+			return err
+		}
+		sep := ","
+		if i == len(Tunables)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&b, "  %q: %s%s\n", t.Name, value, sep)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
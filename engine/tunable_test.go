@@ -0,0 +1,114 @@
+package engine_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"silverfish/engine"
+)
+
+func TestTunablesRegistry(t *testing.T) {
+	seen := map[string]bool{}
+	for _, tunable := range engine.Tunables {
+		if seen[strings.ToLower(tunable.Name)] {
+			t.Errorf("%s registered twice", tunable.Name)
+		}
+		seen[strings.ToLower(tunable.Name)] = true
+
+		if tunable.Min > tunable.Default || tunable.Default > tunable.Max || tunable.Step <= 0 {
+			t.Errorf("%s: default %d outside [%d, %d] or step %d not positive",
+				tunable.Name, tunable.Default, tunable.Min, tunable.Max, tunable.Step)
+		}
+		if tunable.Value() != tunable.Default {
+			t.Errorf("%s = %d at startup, want its default %d", tunable.Name, tunable.Value(), tunable.Default)
+		}
+	}
+
+	margin := engine.FindTunable("rfpmargin")
+	if margin == nil {
+		t.Fatalf("FindTunable didn't find RFPMargin case-insensitively")
+	}
+	defer engine.ResetTunables()
+	margin.Set(margin.Max + 1000)
+	if engine.RFPMargin != int32(margin.Max) {
+		t.Errorf("Set past Max gave RFPMargin = %d, want it clamped to %d", engine.RFPMargin, margin.Max)
+	}
+	engine.ResetTunables()
+	if engine.RFPMargin != int32(margin.Default) {
+		t.Errorf("ResetTunables left RFPMargin = %d, want %d", engine.RFPMargin, margin.Default)
+	}
+}
+
+func TestSPSAConfigs(t *testing.T) {
+	var openBench bytes.Buffer
+	if err := engine.WriteOpenBenchSPSA(&openBench); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(openBench.String()), "\n")
+	if len(lines) != len(engine.Tunables) {
+		t.Errorf("OpenBench config has %d lines, want one per tunable (%d)", len(lines), len(engine.Tunables))
+	}
+	if want := "RFPMargin, int, 90.0, 40.0, 200.0, 10.0, 0.002"; !strings.Contains(openBench.String(), want+"\n") {
+		t.Errorf("OpenBench config lacks %q:\n%s", want, openBench.String())
+	}
+
+	var weather bytes.Buffer
+	if err := engine.WriteWeatherFactorySPSA(&weather); err != nil {
+		t.Fatal(err)
+	}
+	var params map[string]struct {
+		Value    int `json:"value"`
+		MinValue int `json:"min_value"`
+		MaxValue int `json:"max_value"`
+		Step     int `json:"step"`
+	}
+	if err := json.Unmarshal(weather.Bytes(), &params); err != nil {
+		t.Fatalf("weather-factory config isn't valid JSON: %v\n%s", err, weather.String())
+	}
+	if p := params["NullMoveReduction"]; len(params) != len(engine.Tunables) || p.Value != 2 || p.Step != 1 {
+		t.Errorf("weather-factory config has %d params, NullMoveReduction %+v", len(params), p)
+	}
+}
+
+// Every value a tunable's range admits -- through setoption, or an SPSA
+// run -- has to give a search that terminates. Each tunable is tried at
+// its min and its max with the rest at their defaults, and then all of
+// them at their mins and all at their maxes together, on a short
+// fixed-depth search that has to finish well within a node budget (a
+// search that recursed past the horizon would run into it instead).
+func TestTunableExtremesSearch(t *testing.T) {
+	defer engine.ResetTunables()
+	const budget = 2000000
+	search := func(setting string) {
+		engine.ClearTT()
+		pos := engine.FromFEN("r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3")
+		s := engine.Search{MaxDepth: 5, TimeLimit: engine.InfiniteMovetime, NodeLimit: budget}
+		s.Init(&pos)
+		var move engine.Move
+		captureStdout(t, func() { _, move = s.Search() })
+		if move == 0 || s.Nodes >= budget {
+			t.Errorf("%s: depth 5 gave move %s after %d nodes", setting, move.ToString(), s.Nodes)
+		}
+	}
+
+	for _, tunable := range engine.Tunables {
+		for _, value := range []int{tunable.Min, tunable.Max} {
+			engine.ResetTunables()
+			tunable.Set(value)
+			search(fmt.Sprintf("%s=%d", tunable.Name, value))
+		}
+	}
+	for _, extreme := range []string{"min", "max"} {
+		for _, tunable := range engine.Tunables {
+			if extreme == "min" {
+				tunable.Set(tunable.Min)
+			} else {
+				tunable.Set(tunable.Max)
+			}
+		}
+		search("all at " + extreme)
+	}
+}
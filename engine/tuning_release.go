@@ -0,0 +1,7 @@
+//go:build !tuning
+
+package engine
+
+// TuningBuild reports whether this binary was built with -tags tuning, which
+// exposes every Tunable as a UCI option.
+const TuningBuild = false
@@ -191,6 +191,8 @@ const BB_Rank8 = Bitboard(0xff00000000000000)
 const BB_FileA = Bitboard(0x101010101010101)
 const BB_FileH = Bitboard(0x8080808080808080)
 const BB_Empty = Bitboard(0)
+const BB_DarkSquares = Bitboard(0xaa55aa55aa55aa55)
+const BB_LightSquares = ^BB_DarkSquares
 const BB_Full = Bitboard(0xffffffffffffffff)
 const FlipVertical = 0b111000 // xor mask for flipping a square vertically
 
@@ -21,6 +21,12 @@ type UciGoMessage struct {
 	Depth    int16
 	Movetime int32
 
+	// Search for a mate in this many moves (`go mate N`); 0 if not given
+	Mate int16
+
+	// Stop after searching this many nodes (`go nodes N`); 0 if not given
+	Nodes int
+
 	WTime int32
 	BTime int32
 	WInc  int32
@@ -53,6 +59,17 @@ const (
 	UciStopClientMessage
 	UciSetOptionClientMessage
 	UciNewGameClientMessage
+
+	// Extensions, not part of the UCI protocol: "savehash <file>" and
+	// "loadhash <file>" persist and restore the transposition table (see
+	// SaveTT/LoadTT). Path holds the file name.
+	UciSaveHashClientMessage
+	UciLoadHashClientMessage
+
+	// "eval" prints the current position's evaluation broken down (see
+	// TraceEval), and "eval json" prints it as one line of JSON, with
+	// JSON set.
+	UciEvalClientMessage
 )
 
 // EvalFileDefaultLabel is the sentinel value UCI GUIs are expected to send
@@ -86,6 +103,8 @@ type UciClientMessage struct {
 	Position    *Position
 	GoMessage   *UciGoMessage
 	SetOption   *UciSetOptionMessage
+	Path        string
+	JSON        bool
 	MessageType uint8
 }
 
@@ -127,6 +146,14 @@ func uciProcessGoMessage(message string) UciGoMessage {
 			if depth, ok := intArg(i); ok {
 				result.Depth = int16(depth)
 			}
+		case "mate":
+			if mate, ok := intArg(i); ok {
+				result.Mate = int16(mate)
+			}
+		case "nodes":
+			if nodes, ok := intArg(i); ok {
+				result.Nodes = nodes
+			}
 		case "movetime":
 			if movetime, ok := intArg(i); ok {
 				result.Movetime = int32(movetime)
@@ -227,6 +254,18 @@ func UciProcessClientMessage(stdin *bufio.Scanner) UciClientMessage {
 	} else if textMessage == "ucinewgame" {
 		message.MessageType = UciNewGameClientMessage
 		return message
+	} else if strings.HasPrefix(textMessage, "savehash ") {
+		message.Path = strings.TrimSpace(strings.TrimPrefix(textMessage, "savehash "))
+		message.MessageType = UciSaveHashClientMessage
+		return message
+	} else if textMessage == "eval" || textMessage == "eval json" {
+		message.JSON = textMessage == "eval json"
+		message.MessageType = UciEvalClientMessage
+		return message
+	} else if strings.HasPrefix(textMessage, "loadhash ") {
+		message.Path = strings.TrimSpace(strings.TrimPrefix(textMessage, "loadhash "))
+		message.MessageType = UciLoadHashClientMessage
+		return message
 	}
 
 	// Just return the empty message at this point
@@ -296,4 +335,11 @@ func UciSetEngineName(name string) {
 func UciOptions() {
 	fmt.Printf("option name EvalFile type string default %s\n", EvalFileDefaultLabel)
 	fmt.Printf("option name Threads type spin default 1 min 1 max 64\n")
+	fmt.Printf("option name Hash type spin default %d min 1 max %d\n", TTSizeMB, MaxTTSizeMB)
+	fmt.Printf("option name Contempt type spin default 0 min -200 max 200\n")
+	fmt.Printf("option name DynamicContempt type check default false\n")
+	fmt.Printf("option name Deterministic type check default false\n")
+	if TuningBuild {
+		uciTunableOptions()
+	}
 }
@@ -15,3 +15,44 @@ func TestUciProcessClientMessageParsesNewGame(t *testing.T) {
 		t.Errorf("got MessageType %d, want UciNewGameClientMessage", message.MessageType)
 	}
 }
+
+func TestUciProcessClientMessageParsesGoMate(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader("go mate 3\n"))
+	message := engine.UciProcessClientMessage(scanner)
+	if message.MessageType != engine.UciGoClientMessage {
+		t.Fatalf("got MessageType %d, want UciGoClientMessage", message.MessageType)
+	}
+	if message.GoMessage.Mate != 3 {
+		t.Errorf("got Mate %d, want 3", message.GoMessage.Mate)
+	}
+}
+
+func TestUciProcessClientMessageParsesHashFileCommands(t *testing.T) {
+	cases := []struct {
+		line        string
+		messageType uint8
+		path        string
+	}{
+		{"savehash /tmp/analysis.tt\n", engine.UciSaveHashClientMessage, "/tmp/analysis.tt"},
+		{"loadhash my hash file.tt\n", engine.UciLoadHashClientMessage, "my hash file.tt"},
+	}
+	for _, tc := range cases {
+		scanner := bufio.NewScanner(strings.NewReader(tc.line))
+		message := engine.UciProcessClientMessage(scanner)
+		if message.MessageType != tc.messageType {
+			t.Errorf("%q: got MessageType %d, want %d", tc.line, message.MessageType, tc.messageType)
+		}
+		if message.Path != tc.path {
+			t.Errorf("%q: got Path %q, want %q", tc.line, message.Path, tc.path)
+		}
+	}
+}
+
+func TestUciProcessClientMessageParsesEval(t *testing.T) {
+	for line, json := range map[string]bool{"eval\n": false, "eval json\n": true} {
+		message := engine.UciProcessClientMessage(bufio.NewScanner(strings.NewReader(line)))
+		if message.MessageType != engine.UciEvalClientMessage || message.JSON != json {
+			t.Errorf("%q: got MessageType %d, JSON %v", line, message.MessageType, message.JSON)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package engine
 
+import "math/bits"
+
 // Zobrist hashing: a random 64-bit key per (piece, square), castling-rights
 // state, en-passant file, and side to move, XORed together. XOR is its own
 // inverse, so a move can update the hash incrementally (XOR out what
@@ -15,6 +17,13 @@ var CastleKeys [16]uint64 // 2**4 possible castling-rights combinations
 var EnPassantKeys [8]uint64
 var TurnKey uint64
 
+// MaterialKeys[piece][n] is the key of the (n+1)-th piece of a kind (same
+// 0-11 indexing as PieceSqKeys): a position's MaterialKey XORs together
+// the keys of all its pieces' ordinals, so it depends only on how many of
+// each piece there are, not where. Ten per kind covers every legal
+// position (two knights plus eight promoted ones).
+var MaterialKeys [12][10]uint64
+
 func InitZobrist() {
 	for piece := 0; piece < 12; piece++ {
 		for sq := SquareA1; sq <= SquareH8; sq++ {
@@ -28,6 +37,14 @@ func InitZobrist() {
 		EnPassantKeys[i] = Rng.Uint64()
 	}
 	TurnKey = Rng.Uint64()
+	for i := range ContemptKeys {
+		ContemptKeys[i] = Rng.Uint64() | 1 // odd, so every nonzero contempt maps to a distinct key
+	}
+	for piece := range MaterialKeys {
+		for n := range MaterialKeys[piece] {
+			MaterialKeys[piece][n] = Rng.Uint64()
+		}
+	}
 }
 
 // pieceSqKeyIndex remaps Board's piece encoding (0-5 white, 10-15 black) to
@@ -51,6 +68,26 @@ func pieceSqKey(sq Square, piece uint8) uint64 {
 	return PieceSqKeys[index][sq]
 }
 
+// pawnSqKey is pieceSqKey restricted to pawns: a piece's contribution to
+// Position.PawnHash.
+func pawnSqKey(sq Square, piece uint8) uint64 {
+	if piece != Pawn && piece != Pawn+10 {
+		return 0
+	}
+	return pieceSqKey(sq, piece)
+}
+
+// materialKey returns the MaterialKeys entry for the (n+1)-th piece of a
+// kind, piece in Board's encoding. 0 for NoPiece, and for counts past what
+// MaterialKeys covers (only reachable from an illegal FEN).
+func materialKey(piece uint8, n int) uint64 {
+	index, ok := pieceSqKeyIndex(piece)
+	if !ok || n < 0 || n >= len(MaterialKeys[index]) {
+		return 0
+	}
+	return MaterialKeys[index][n]
+}
+
 // enPassantKey returns the hash contribution of an en-passant target
 // square, or 0 if none is set (NoSquare, or -- defensively -- a square that
 // isn't actually a valid EP rank).
@@ -79,3 +116,32 @@ func Hash(pos *Position) uint64 {
 	}
 	return h
 }
+
+// PawnHash computes a position's pawn-only Zobrist key (Position.PawnHash)
+// from scratch.
+func PawnHash(pos *Position) uint64 {
+	h := uint64(0)
+	for sq := SquareA1; sq <= SquareH8; sq++ {
+		h ^= pawnSqKey(sq, pos.Board[sq])
+	}
+	return h
+}
+
+// MaterialKey computes a position's material key (Position.MaterialKey)
+// from scratch.
+func MaterialKey(pos *Position) uint64 {
+	h := uint64(0)
+	for color := White; color <= Black; color++ {
+		for piece := Pawn; piece <= King; piece++ {
+			boardPiece := piece
+			if color == Black {
+				boardPiece += 10
+			}
+			count := bits.OnesCount64(uint64(pos.Pieces[color][piece]))
+			for n := 0; n < count; n++ {
+				h ^= materialKey(boardPiece, n)
+			}
+		}
+	}
+	return h
+}
@@ -65,6 +65,7 @@ func TestZobristIncrementalMatchesFromScratch(t *testing.T) {
 				if pos.Hash != want {
 					t.Fatalf("after %s: incremental=%x fromScratch=%x (fen %s)", ms, pos.Hash, want, pos.ToFEN())
 				}
+				checkSecondaryKeys(t, &pos, "after "+ms)
 			}
 
 			// Undo everything and check the hash is restored exactly, at
@@ -75,11 +76,49 @@ func TestZobristIncrementalMatchesFromScratch(t *testing.T) {
 				if pos.Hash != want {
 					t.Fatalf("after undoing move %d: incremental=%x fromScratch=%x", i, pos.Hash, want)
 				}
+				checkSecondaryKeys(t, &pos, "after undoing "+tc.moves[i])
 			}
 		})
 	}
 }
 
+// checkSecondaryKeys checks the incrementally-maintained PawnHash and
+// MaterialKey against from-scratch recomputes, like the Hash checks in
+// TestZobristIncrementalMatchesFromScratch.
+func checkSecondaryKeys(t *testing.T, pos *engine.Position, stage string) {
+	t.Helper()
+	if want := engine.PawnHash(pos); pos.PawnHash != want {
+		t.Fatalf("%s: PawnHash incremental=%x fromScratch=%x (fen %s)", stage, pos.PawnHash, want, pos.ToFEN())
+	}
+	if want := engine.MaterialKey(pos); pos.MaterialKey != want {
+		t.Fatalf("%s: MaterialKey incremental=%x fromScratch=%x (fen %s)", stage, pos.MaterialKey, want, pos.ToFEN())
+	}
+}
+
+// PawnHash must depend on the pawns alone and MaterialKey on the piece
+// counts alone: positions differing only in piece placement share a
+// MaterialKey, and only in non-pawn placement share a PawnHash.
+func TestSecondaryKeys(t *testing.T) {
+	a := engine.FromFEN("r3k2r/pp3ppp/8/8/8/8/PP3PPP/R3K2R w KQkq - 0 1")
+	b := engine.FromFEN("1r2k1r1/pp3ppp/8/8/8/8/PP3PPP/2R1KR2 w - - 0 1")
+	c := engine.FromFEN("r3k2r/p4ppp/1p6/8/8/8/PP3PPP/R3K2R w KQkq - 0 1")
+	d := engine.FromFEN("r3k2r/pp3ppp/8/8/8/8/PP3PPP/R3K1R1 w kq - 0 1")
+	e := engine.FromFEN("r3k2r/pp3ppp/8/8/8/8/PP3PPP/R3K1N1 w Qkq - 0 1")
+
+	if a.PawnHash != b.PawnHash {
+		t.Errorf("PawnHash differs between positions with identical pawns")
+	}
+	if a.PawnHash == c.PawnHash {
+		t.Errorf("PawnHash identical for different pawn structures")
+	}
+	if a.MaterialKey != c.MaterialKey || a.MaterialKey != d.MaterialKey {
+		t.Errorf("MaterialKey differs between positions with identical material")
+	}
+	if a.MaterialKey == e.MaterialKey {
+		t.Errorf("MaterialKey identical for different material")
+	}
+}
+
 func TestIsRepetition(t *testing.T) {
 	pos := engine.FromFEN("4k3/8/8/8/8/8/8/4K3 w - - 0 1")
 
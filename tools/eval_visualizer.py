@@ -1,7 +1,19 @@
+"""Board editor showing Silverfish's evaluation of the position on it.
+
+The evaluation comes from the engine itself: the visualizer runs a
+Silverfish binary and asks for `eval json` (see engine/eval_trace.go), so it
+shows exactly what the engine computes -- whatever the network's
+architecture -- and each piece's contribution to the network's output,
+under the piece, along with the hand-crafted evaluation's terms.
+
+Usage:
+  tools/eval_visualizer.py [path/to/silverfish]    (default: bin/silverfish)
+"""
 import chess
-import numpy as np
+import json
+import subprocess
+import sys
 from pathlib import Path
-import struct
 import tkinter as tk
 from tkinter import ttk, filedialog, messagebox
 
@@ -14,99 +26,36 @@ FONT = ("Consolas", 12)
 
 PIECE_LETTERS = ["K", "Q", "R", "B", "N", "P"]
 
-FLIP = 0b111000
-def feature(perspective, piece_color, piece_type, sq: int) -> int:
-    friendly = (piece_color == perspective)
-    piece_idx = piece_type + (0 if friendly else 6)  # 0..11
-    if perspective == chess.BLACK:
-        sq ^= FLIP
-    return 64 * piece_idx + sq  # 0..767
 
-class NNUEModel:
-    def __init__(self):
-        self.loaded = False
-        self.num_inputs = None
-        self.l1 = None
-        self.W_in = None   # shape (L1, NUM_INPUTS)
-        self.b_in = None   # shape (L1,)
-        self.W_out = None  # shape (1, 2*L1)
-        self.b_out = None  # scalar
-
-    def load_from_file(self, path: Path):
-        with open(path, "rb") as f:
-            magic = f.read(4)
-            if magic != b"NNUE":
-                raise ValueError("not an NNUE file")
-            version_bytes = f.read(4)
-            version = struct.unpack("<I", version_bytes)[0]
-            assert version == 1
-            num_inputs = struct.unpack("<I", f.read(4))[0]
-            l1 = struct.unpack("<I", f.read(4))[0]
-
-            rest = f.read()
-            floats = np.frombuffer(rest, dtype="<f4")  # little-endian float32
-
-            expected = l1 * num_inputs + l1 + (2 * l1) + 1
-            if floats.size != expected:
-                raise ValueError(f"unexpected float count in NNUE file. Expected {expected}, got {floats.size}")
-
-            idx = 0
-            W_in = floats[idx: idx + (l1 * num_inputs)].reshape((l1, num_inputs))
-            idx += l1 * num_inputs
-            b_in = floats[idx: idx + l1]
-            idx += l1
-            W_out = floats[idx: idx + (2 * l1)].reshape((1, 2 * l1))
-            idx += 2 * l1
-            b_out = floats[idx]
-            # done
-
-            self.num_inputs = num_inputs
-            self.l1 = l1
-            self.W_in = W_in
-            self.b_in = b_in
-            self.W_out = W_out
-            self.b_out = b_out
-            self.loaded = True
-
-    def evaluate(self, board: chess.Board) -> tuple[float, float]:
-        if not self.loaded:
-            raise RuntimeError("model not loaded")
-
-        num_inputs = self.num_inputs
-        feats_side = np.zeros(num_inputs, dtype=np.float32)
-        feats_opp = np.zeros(num_inputs, dtype=np.float32)
-
-        piece_type_to_idx = {chess.PAWN:0, chess.KNIGHT:1, chess.BISHOP:2,
-                             chess.ROOK:3, chess.QUEEN:4, chess.KING:5}
-
-        stm = board.turn  # true=white, false=black
-
-        for sq in chess.SQUARES:
-            piece = board.piece_at(sq)
-            if piece is None:
-                continue
-            pt_idx = piece_type_to_idx[piece.piece_type]
-            feature_index = feature(stm, piece.color, pt_idx, sq)
-            opp_feature_index = feature(not stm, piece.color, pt_idx, sq)
-            
-            feats_side[feature_index] = 1.0
-            feats_opp[opp_feature_index] = 1.0
-        
-        # np.set_printoptions(threshold=np.inf)
-        # print(self.W_in.transpose())
-
-        # W_in shape: (L1, NUM_INPUTS)
-        a_side = np.dot(self.W_in, feats_side) + self.b_in
-        a_opp  = np.dot(self.W_in, feats_opp)  + self.b_in
-        # print(a_side)
-        # print("\n\n\n\n\n\n")
-        # print(a_opp)
-        h_side = np.maximum(0.0, a_side)
-        h_opp  = np.maximum(0.0, a_opp)
-        concat = np.concatenate([h_side, h_opp])  # shape (2*L1,)
-        raw = float(np.dot(self.W_out, concat) + self.b_out)  # in pawns (assumption)
-        centipawns = raw * 1000.0
-        return raw, centipawns
+class Engine:
+    """A Silverfish process, queried over UCI for evaluation traces."""
+
+    def __init__(self, path: str):
+        self.proc = subprocess.Popen([path], stdin=subprocess.PIPE, stdout=subprocess.PIPE, text=True, bufsize=1)
+        self.send("uci")
+        self.wait_for("uciok")
+
+    def send(self, command: str):
+        self.proc.stdin.write(command + "\n")
+        self.proc.stdin.flush()
+
+    def wait_for(self, prefix: str) -> str:
+        for line in self.proc.stdout:
+            if line.startswith(prefix):
+                return line
+            if line.startswith("info error"):
+                raise RuntimeError(line.removeprefix("info error").strip())
+        raise RuntimeError("engine exited")
+
+    def load_network(self, path: Path):
+        self.send(f"setoption name EvalFile value {path}")
+        self.send("isready")
+        self.wait_for("readyok")
+
+    def trace(self, board: chess.Board) -> dict:
+        self.send(f"position fen {board.fen()}")
+        self.send("eval json")
+        return json.loads(self.wait_for("{"))
 
 
 class NNUEVisualizer(tk.Tk):
@@ -117,7 +66,8 @@ class NNUEVisualizer(tk.Tk):
         self.resizable(False, False)
 
         self.board = chess.Board.empty()  # start with empty board
-        self.model = NNUEModel()
+        self.engine = Engine(sys.argv[1] if len(sys.argv) > 1 else "bin/silverfish")
+        self.trace = None
 
         # drawing canvas
         self.canvas = tk.Canvas(self, width=CANVAS_SIZE, height=CANVAS_SIZE, bg="#aaa")
@@ -161,13 +111,14 @@ class NNUEVisualizer(tk.Tk):
         eval_frame = ttk.Frame(self)
         eval_frame.grid(row=4, column=0, columnspan=6, pady=6)
         ttk.Label(eval_frame, text="Evaluation:", font=("Consolas", 14, "bold")).grid(row=0, column=0, padx=5)
-        self.var_eval = tk.StringVar(value="(no model loaded)")
+        self.var_eval = tk.StringVar(value="")
         ttk.Label(eval_frame, textvariable=self.var_eval, font=("Consolas", 14)).grid(row=0, column=1, padx=5)
         self.var_raw = tk.StringVar(value="")
-        ttk.Label(eval_frame, textvariable=self.var_raw, font=("Consolas", 10)).grid(row=1, column=0, columnspan=2)
+        ttk.Label(eval_frame, textvariable=self.var_raw, font=("Consolas", 10), justify="left").grid(row=1, column=0, columnspan=2)
 
         self.draw_board()
         self.update_fen()
+        self.update_evaluation()
 
     def browse_nnue(self):
         path = filedialog.askopenfilename(filetypes=[("NNUE files", "*.nnue"), ("All files","*.*")])
@@ -180,8 +131,7 @@ class NNUEVisualizer(tk.Tk):
             messagebox.showwarning("No file", "Please select a .nnue file path first.")
             return
         try:
-            self.model.load_from_file(Path(path))
-            messagebox.showinfo("Loaded", f"Loaded NNUE (NUM_INPUTS={self.model.num_inputs}, L1={self.model.l1})")
+            self.engine.load_network(Path(path))
             self.update_evaluation()
         except Exception as e:
             messagebox.showerror("Load error", f"Failed to load NNUE: {e}")
@@ -273,6 +223,16 @@ class NNUEVisualizer(tk.Tk):
         self.update_fen()
         self.update_evaluation()
 
+    def contribution(self, sq):
+        """The traced piece's contribution to the network's output, if any."""
+        if self.trace is None:
+            return None
+        name = chess.square_name(sq)
+        for piece in self.trace["pieces"]:
+            if piece["square"] == name:
+                return piece["contribution"]
+        return None
+
     def draw_board(self):
         self.canvas.delete("all")
         # squares
@@ -294,7 +254,11 @@ class NNUEVisualizer(tk.Tk):
                     # we draw uppercase on canvas and prefix color via fill
                     display = letter.upper()
                     fill = "white" if piece.color == chess.WHITE else "black"
-                    self.canvas.create_text((x0+x1)//2, (y0+y1)//2, text=display, font=("Consolas", 28, "bold"), fill=fill)
+                    self.canvas.create_text((x0+x1)//2, (y0+y1)//2 - 6, text=display, font=("Consolas", 28, "bold"), fill=fill)
+                    contribution = self.contribution(sq)
+                    if contribution is not None:
+                        shade = "#080" if contribution >= 0 else "#c00"
+                        self.canvas.create_text((x0+x1)//2, y1 - 10, text=f"{contribution:+d}", font=("Consolas", 10, "bold"), fill=shade)
 
         # column labels
         for c in range(GRID_SIZE):
@@ -308,22 +272,28 @@ class NNUEVisualizer(tk.Tk):
             self.canvas.create_text(x, y, text=str(8 - r), font=FONT, fill="black")
 
     def update_evaluation(self):
-        if not self.model.loaded:
-            self.var_eval.set("(no model loaded)")
+        self.trace = None
+        if self.board.king(chess.WHITE) is None or self.board.king(chess.BLACK) is None:
+            self.var_eval.set("(place both kings)")
             self.var_raw.set("")
+            self.draw_board()
             return
         try:
-            raw_pawns, cp = self.model.evaluate(self.board)
-            # show centipawns rounded
-            if abs(cp) > 100000:
-                eval_str = f"{cp:.1f} cp"
-            else:
-                eval_str = f"{int(round(cp))} cp"
-            self.var_eval.set(eval_str)
-            self.var_raw.set(f"Raw (pawns): {raw_pawns:.6f}   (converted: {cp:.2f} cp)")
+            self.trace = self.engine.trace(self.board)
         except Exception as e:
             self.var_eval.set("(eval error)")
             self.var_raw.set(str(e))
+            return
+        t = self.trace
+        self.var_eval.set(f"NNUE {t['nnue']:+d} cp   HCE {t['hce']['total']:+d} cp   (White's view)")
+        lines = [t["network"]]
+        for acc in t["accumulators"]:
+            lines.append(f"{acc['perspective']} accumulator: {acc['active']}/{acc['size']} active, "
+                         f"{acc['saturated']} saturated, mean {acc['mean']:.1f}")
+        terms = ", ".join(f"{term['name']} {term['white'] - term['black']:+d}" for term in t["hce"]["terms"])
+        lines.append("HCE: " + terms)
+        self.var_raw.set("\n".join(lines))
+        self.draw_board()
 
 if __name__ == "__main__":
     app = NNUEVisualizer()
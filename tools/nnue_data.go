@@ -0,0 +1,186 @@
+//go:build ignore
+
+// Training data tools for packed position files (see engine/packed.go and
+// trainer/dataset.go), the format `silverfish datagen` writes and
+// nnue_train.go reads: converting PGNs, EPDs and the text format to it,
+// shuffling, deduplicating and interleaving files, and printing a file's
+// result, piece count and score distributions.
+//
+// Usage:
+//
+//	go run tools/nnue_data.go convert -quiet -o games.bin games.pgn more.pgn
+//	go run tools/nnue_data.go shuffle -o shuffled.bin -memory 4096 data.bin
+//	go run tools/nnue_data.go dedup -o unique.bin data.bin
+//	go run tools/nnue_data.go interleave -o mixed.bin a.bin b.bin c.bin
+//	go run tools/nnue_data.go stats data.bin
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"silverfish/engine"
+	"silverfish/trainer"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "convert":
+		convert(os.Args[2:])
+	case "shuffle":
+		shuffle(os.Args[2:])
+	case "dedup":
+		dedup(os.Args[2:])
+	case "interleave":
+		interleave(os.Args[2:])
+	case "stats":
+		stats(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: nnue_data.go convert|shuffle|dedup|interleave|stats [flags] files...")
+	os.Exit(2)
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	os.Exit(1)
+}
+
+// parse parses a subcommand's flags and requires at least one file.
+func parse(flags *flag.FlagSet, args []string) []string {
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	return flags.Args()
+}
+
+// seeded returns an rng from a -seed flag's value, 0 meaning the clock.
+func seeded(seed int64) *rand.Rand {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+func convert(args []string) {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	out := flags.String("o", "data.bin", "output file")
+	quiet := flags.Bool("quiet", false, "keep only positions not in check whose move is neither a capture nor a promotion")
+	unscored := flags.Bool("unscored", false, "keep positions without a score, scored 0")
+	ins := parse(flags, args)
+
+	engine.Init()
+	f, err := os.Create(*out)
+	if err != nil {
+		fail(err)
+	}
+	w := engine.NewPackedWriter(f)
+	opts := trainer.ConvertOptions{Quiet: *quiet, Unscored: *unscored}
+	var total trainer.ConvertStats
+	for _, in := range ins {
+		fn, err := trainer.ConverterFor(in)
+		if err != nil {
+			fail(err)
+		}
+		r, err := os.Open(in)
+		if err != nil {
+			fail(err)
+		}
+		stats, err := fn(r, w, opts)
+		r.Close()
+		if err != nil {
+			fail(fmt.Errorf("%s: %w", in, err))
+		}
+		fmt.Printf("%s: %v\n", in, stats)
+		total.Kept += stats.Kept
+		total.Dropped += stats.Dropped
+	}
+	if err := w.Flush(); err != nil {
+		fail(err)
+	}
+	if err := f.Close(); err != nil {
+		fail(err)
+	}
+	fmt.Printf("wrote %s: %v\n", *out, total)
+}
+
+func shuffle(args []string) {
+	flags := flag.NewFlagSet("shuffle", flag.ExitOnError)
+	out := flags.String("o", "", "output file (default: shuffle in place)")
+	memory := flags.Int64("memory", 2048, "MB of positions to hold in memory at once")
+	seed := flags.Int64("seed", 0, "shuffle seed (0: from the clock)")
+	ins := parse(flags, args)
+	if len(ins) != 1 {
+		fail(fmt.Errorf("shuffle takes one file (interleave several first)"))
+	}
+	if *out == "" {
+		*out = ins[0]
+	}
+
+	start := time.Now()
+	if err := trainer.ShuffleFile(ins[0], *out, seeded(*seed), *memory<<20); err != nil {
+		fail(err)
+	}
+	n, _ := trainer.CountPacked(*out)
+	fmt.Printf("shuffled %d positions into %s in %v\n", n, *out, time.Since(start).Round(time.Millisecond))
+}
+
+func dedup(args []string) {
+	flags := flag.NewFlagSet("dedup", flag.ExitOnError)
+	out := flags.String("o", "dedup.bin", "output file")
+	ins := parse(flags, args)
+	if len(ins) != 1 {
+		fail(fmt.Errorf("dedup takes one file (interleave several first)"))
+	}
+
+	engine.Init()
+	kept, dropped, err := trainer.DedupFile(ins[0], *out)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("wrote %s: %d positions kept, %d duplicates dropped\n", *out, kept, dropped)
+}
+
+func interleave(args []string) {
+	flags := flag.NewFlagSet("interleave", flag.ExitOnError)
+	out := flags.String("o", "interleaved.bin", "output file")
+	seed := flags.Int64("seed", 0, "interleaving seed (0: from the clock)")
+	ins := parse(flags, args)
+
+	if err := trainer.InterleaveFiles(ins, *out, seeded(*seed)); err != nil {
+		fail(err)
+	}
+	n, _ := trainer.CountPacked(*out)
+	fmt.Printf("wrote %s: %d positions from %d files\n", *out, n, len(ins))
+}
+
+func stats(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	ins := parse(flags, args)
+
+	for i, in := range ins {
+		stats, err := trainer.ComputeStats(in)
+		if err != nil {
+			fail(err)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		if len(ins) > 1 {
+			fmt.Printf("== %s ==\n", in)
+		}
+		stats.Write(os.Stdout)
+	}
+}
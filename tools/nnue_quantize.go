@@ -0,0 +1,126 @@
+//go:build ignore
+
+// Converts a float .nnue network into the quantized format the engine
+// evaluates with (see engine/nnue_quant.go), then checks the quantized
+// network against the float one on a corpus of random-playout positions
+// and reports how far their evals drift apart.
+//
+// Float networks are quantized on load anyway, so the quantized file is
+// mainly a smaller (int16 instead of float32) and faster-loading copy --
+// and the way to pick non-default scales or SCReLU. The comparison is
+// always against the float network as trained (plain ReLU), so SCReLU
+// only makes sense for a network trained with it.
+//
+// Usage:
+//
+//	go run tools/nnue_quantize.go -out 256q.nnue                         # embedded net, default scales
+//	go run tools/nnue_quantize.go -in net.nnue -out netq.nnue -qa 255 -qb 64 -activation screlu -name net-screlu
+//	go run tools/nnue_quantize.go -in net.nnue -positions 20000         # verify only
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+
+	"silverfish/engine"
+)
+
+var corpusStarts = []string{
+	"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+	"6k1/5p1p/1q2p1p1/1PnpP3/3N4/1Pr5/P5PP/3QR1K1 w - - 3 37",
+	"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+}
+
+func main() {
+	in := flag.String("in", "", "float network to convert (default: the embedded net)")
+	out := flag.String("out", "", "write the quantized network here (default: verify only)")
+	activation := flag.String("activation", "crelu", "activation: crelu or screlu")
+	qa := flag.Int("qa", engine.DefaultQA, "first-layer scale")
+	qb := flag.Int("qb", engine.DefaultQB, "output-layer scale")
+	positions := flag.Int("positions", 10000, "corpus size for the float/quantized comparison")
+	name := flag.String("name", "", "network name to record in the file's metadata (default: the float net's)")
+	flag.Parse()
+
+	engine.Init()
+	float, err := engine.LoadNNUE(*in)
+	if err != nil {
+		fail(err)
+	}
+
+	act := engine.ActivationCReLU
+	switch strings.ToLower(*activation) {
+	case "crelu":
+	case "screlu":
+		act = engine.ActivationSCReLU
+	default:
+		fail(fmt.Errorf("unknown activation %q", *activation))
+	}
+	quantized, err := float.Quantize(act, int32(*qa), int32(*qb))
+	if err != nil {
+		fail(err)
+	}
+	if *name != "" {
+		quantized.Info.Name = *name
+	}
+
+	compare(quantized, *positions)
+
+	if *out == "" {
+		return
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		fail(err)
+	}
+	if err := quantized.WriteQuantized(f); err != nil {
+		fail(err)
+	}
+	if err := f.Close(); err != nil {
+		fail(err)
+	}
+	fmt.Printf("wrote %s (%s, QA=%d, QB=%d)\n", *out, act, *qa, *qb)
+}
+
+// compare evaluates random-playout positions with both parameter sets of
+// net and prints the distribution of the differences.
+func compare(net *engine.Network, n int) {
+	rng := rand.New(rand.NewSource(1))
+	var diffs []int
+	for len(diffs) < n {
+		pos := engine.FromFEN(corpusStarts[len(diffs)%len(corpusStarts)])
+		pos.SetNetwork(net)
+
+		for ply := 0; ply < 60 && len(diffs) < n; ply++ {
+			moves := pos.LegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			pos.DoMove(moves[rng.Intn(len(moves))])
+			want, _ := engine.EvaluateFloat(&pos)
+			diff := int(engine.EvaluateNNUE(&pos) - want)
+			if diff < 0 {
+				diff = -diff
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+
+	sort.Ints(diffs)
+	total := 0
+	for _, d := range diffs {
+		total += d
+	}
+	fmt.Printf("%d positions: |quantized - float| mean %.2f, median %d, p99 %d, max %d\n",
+		len(diffs), float64(total)/float64(len(diffs)), diffs[len(diffs)/2], diffs[len(diffs)*99/100], diffs[len(diffs)-1])
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	os.Exit(1)
+}
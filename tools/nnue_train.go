@@ -0,0 +1,124 @@
+//go:build ignore
+
+// Trains a (768->L1)x2->1 network on labeled positions with the trainer
+// package, on the CPU, and writes it as a float .nnue file the engine
+// loads directly (EvalFile, or `silverfish net info` to inspect it).
+//
+// Training data is packed positions, as `silverfish datagen` and
+// nnue_data.go write them, or, for files ending in .txt, text: one
+// "<FEN> | <score> | <result>" line per position, score and result from
+// White's point of view (see trainer/data.go). A slice of it, every Nth
+// position, is held out to measure the validation loss after each epoch.
+//
+// Usage:
+//
+//	go run tools/nnue_train.go -data positions.bin -out net.nnue -name my-net
+//	go run tools/nnue_train.go -data a.bin,b.txt -out net.nnue -epochs 30 -lr cosine:0.001:0.00001 -wdl 0.3 -checkpoints ckpt
+//	go run tools/nnue_train.go -data a.bin,b.txt -out net.nnue -epochs 40 -resume ckpt/epoch-030.ckpt
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"silverfish/engine"
+	"silverfish/trainer"
+)
+
+func main() {
+	data := flag.String("data", "", "comma-separated labeled position files (packed, or text if .txt)")
+	out := flag.String("out", "", "write the trained network here")
+	l1 := flag.Int("l1", 256, "accumulator size per perspective")
+	epochs := flag.Int("epochs", 10, "total epochs to train (including any already done by a resumed checkpoint)")
+	batch := flag.Int("batch", 16384, "positions per optimizer step")
+	lr := flag.String("lr", "cosine:0.001:0.0001", "learning rate schedule: constant:LR, step:LR:GAMMA:STEP or cosine:LR:END")
+	wdl := flag.Float64("wdl", 0.25, "weight of the game result in the target (0: search score only, 1: result only)")
+	evalScale := flag.Float64("eval-scale", 400, "centipawn scale of the win-probability sigmoid")
+	threads := flag.Int("threads", 0, "gradient goroutines (default: GOMAXPROCS)")
+	seed := flag.Int64("seed", 1, "seed for the initial weights and shuffling")
+	holdout := flag.Int("validation-every", 50, "hold out every Nth position for validation (0: none)")
+	checkpoints := flag.String("checkpoints", "", "directory to write a checkpoint to after every epoch")
+	resume := flag.String("resume", "", "resume from this checkpoint")
+	name := flag.String("name", "", "network name to record in the file's metadata")
+	flag.Parse()
+	if *data == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	engine.Init()
+	var samples, validation []trainer.Sample
+	for _, path := range strings.Split(*data, ",") {
+		loaded, err := trainer.Load(path)
+		if err != nil {
+			fail(err)
+		}
+		for i, s := range loaded {
+			if *holdout > 0 && (len(samples)+len(validation)+i)%*holdout == 0 {
+				validation = append(validation, s)
+			} else {
+				samples = append(samples, s)
+			}
+		}
+	}
+	fmt.Printf("%d training positions, %d validation positions\n", len(samples), len(validation))
+
+	schedule, err := trainer.ParseSchedule(*lr, *epochs)
+	if err != nil {
+		fail(err)
+	}
+	cfg := trainer.Config{
+		L1:            *l1,
+		Epochs:        *epochs,
+		BatchSize:     *batch,
+		Schedule:      schedule,
+		WDL:           *wdl,
+		EvalScale:     *evalScale,
+		Threads:       *threads,
+		Seed:          *seed,
+		CheckpointDir: *checkpoints,
+	}
+	var tr *trainer.Trainer
+	if *resume != "" {
+		cfg.L1 = 0
+		tr, err = trainer.Resume(cfg, *resume)
+		if err == nil {
+			fmt.Printf("resuming %s after epoch %d\n", *resume, tr.Epoch())
+		}
+	} else {
+		tr, err = trainer.New(cfg)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	err = tr.Train(samples, validation, func(s trainer.EpochStats) {
+		fmt.Printf("epoch %3d  lr %.6f  train loss %.6f  validation loss %.6f  %s",
+			s.Epoch, s.LR, s.TrainLoss, s.ValidationLoss, s.Duration.Round(time.Millisecond))
+		if s.Checkpoint != "" {
+			fmt.Printf("  -> %s", s.Checkpoint)
+		}
+		fmt.Println()
+	})
+	if err != nil {
+		fail(err)
+	}
+
+	info := engine.NetworkInfo{
+		Name:         *name,
+		TrainingData: *data,
+		Date:         time.Now().UTC().Format("2006-01-02"),
+	}
+	if err := tr.WriteNNUE(*out, info); err != nil {
+		fail(err)
+	}
+	fmt.Printf("wrote %s\n", *out)
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,261 @@
+//go:build ignore
+
+// Search tree tracer. Records the tree one search walks (see
+// engine/trace.go) to a JSON dump, and explores a dump afterwards:
+// printing it with subtrees collapsed below a given level, jumping to the
+// node a move path leads to, and following the best line down the tree to
+// show where it was reduced, pruned or cut off.
+//
+// Usage:
+//
+//	go run tools/search_trace.go record -fen "<fen>" -depth 8 -maxply 6 -maxnodes 200000 -o trace.json
+//	go run tools/search_trace.go show -expand 2 trace.json
+//	go run tools/search_trace.go find -expand 1 trace.json e2e4 e7e5
+//	go run tools/search_trace.go pv trace.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"silverfish/engine"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "record":
+		record(os.Args[2:])
+	case "show":
+		show(os.Args[2:])
+	case "find":
+		find(os.Args[2:])
+	case "pv":
+		pv(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: search_trace.go record|show|find|pv [flags] ...")
+	os.Exit(2)
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	os.Exit(1)
+}
+
+func record(args []string) {
+	flags := flag.NewFlagSet("record", flag.ExitOnError)
+	fen := flags.String("fen", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "position to search")
+	depth := flags.Int("depth", 6, "search depth")
+	maxPly := flags.Int("maxply", 0, "record nodes at most this many plies from the root (0 = no limit)")
+	maxNodes := flags.Int("maxnodes", 500000, "record at most this many nodes (0 = no limit)")
+	out := flags.String("o", "trace.json", "output file")
+	flags.Parse(args)
+
+	engine.Init()
+	pos := engine.FromFEN(*fen)
+	search := engine.Search{
+		MaxDepth:  *depth,
+		TimeLimit: engine.InfiniteMovetime,
+		Trace:     engine.NewTracer(*maxPly, *maxNodes),
+	}
+	search.Init(&pos)
+
+	start := time.Now()
+	score, move := search.Search()
+	dump := engine.NewTraceDump(&search, score, move)
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fail(err)
+	}
+	defer f.Close()
+	if err := dump.WriteJSON(f); err != nil {
+		fail(err)
+	}
+	fmt.Printf("searched %d nodes in %v, recorded %d; bestmove %s score %d\nwrote %s\n",
+		search.Nodes, time.Since(start).Round(time.Millisecond), dump.Nodes, dump.BestMove, dump.Score, *out)
+}
+
+func load(path string) *engine.TraceDump {
+	f, err := os.Open(path)
+	if err != nil {
+		fail(err)
+	}
+	defer f.Close()
+	dump, err := engine.ReadTraceDump(f)
+	if err != nil {
+		fail(fmt.Errorf("%s: %w", path, err))
+	}
+	if dump.Root == nil {
+		fail(fmt.Errorf("%s: no trace recorded", path))
+	}
+	return dump
+}
+
+func show(args []string) {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	expand := flags.Int("expand", 1, "levels to print before collapsing subtrees")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	dump := load(flags.Arg(0))
+	fmt.Printf("%s  bestmove %s score %d  pv %s\n", dump.FEN, dump.BestMove, dump.Score, strings.Join(dump.PV, " "))
+	printTree(dump.Root, 0, *expand)
+}
+
+func find(args []string) {
+	flags := flag.NewFlagSet("find", flag.ExitOnError)
+	expand := flags.Int("expand", 1, "levels to print before collapsing subtrees")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		usage()
+	}
+
+	node := load(flags.Arg(0)).Root
+	for i, move := range flags.Args()[1:] {
+		child := lastChild(node, move)
+		if child == nil {
+			fail(fmt.Errorf("no recorded node for %s after %s", move, strings.Join(flags.Args()[1:i+1], " ")))
+		}
+		node = child
+	}
+	printTree(node, 0, *expand)
+}
+
+// pv follows the best line down the tree, one node per move, and reports
+// how each was searched -- and, where the recorded tree stops short of the
+// line, why.
+func pv(args []string) {
+	flags := flag.NewFlagSet("pv", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	dump := load(flags.Arg(0))
+	node := dump.Root
+	fmt.Printf("root: %s\n", describe(node))
+	for i, move := range dump.PV {
+		searches := children(node, move)
+		if len(searches) == 0 {
+			switch {
+			case node.Pruned != "":
+				fmt.Printf("ply %d %s: never searched, parent returned early (%s)\n", i+1, move, node.Pruned)
+			case node.Truncated:
+				fmt.Printf("ply %d %s: not recorded (trace limit)\n", i+1, move)
+			default:
+				fmt.Printf("ply %d %s: not searched in the traced iteration\n", i+1, move)
+			}
+			return
+		}
+		for _, s := range searches {
+			fmt.Printf("ply %d %s\n", i+1, describe(s))
+		}
+		last := searches[len(searches)-1]
+		if last.Pruned == engine.PruneFutility || last.Pruned == engine.PruneLateMove {
+			fmt.Printf("  best line pruned here: %s skipped by %s\n", move, last.Pruned)
+			return
+		}
+		if best := bestChild(node); best != nil && best.Score < last.Score {
+			fmt.Printf("  (in the tree, %s scored best here)\n", best.Move)
+		}
+		node = last
+	}
+	if node.Pruned != "" {
+		fmt.Printf("line ends at a node cut by %s\n", node.Pruned)
+	}
+}
+
+func children(node *engine.TraceNode, move string) []*engine.TraceNode {
+	var found []*engine.TraceNode
+	for _, child := range node.Children {
+		if child.Move == move {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+// lastChild returns the final search of move from node: after LMR
+// re-searches, the one whose score counted.
+func lastChild(node *engine.TraceNode, move string) *engine.TraceNode {
+	found := children(node, move)
+	if len(found) == 0 {
+		return nil
+	}
+	return found[len(found)-1]
+}
+
+// bestChild returns the first searched child with the best score from
+// node's point of view (children score from their own side, so lowest).
+func bestChild(node *engine.TraceNode) *engine.TraceNode {
+	var best *engine.TraceNode
+	for _, child := range node.Children {
+		if child.Move == "0000" || child.Pruned == engine.PruneFutility || child.Pruned == engine.PruneLateMove {
+			continue
+		}
+		if best == nil || child.Score < best.Score {
+			best = lastChild(node, child.Move)
+		}
+	}
+	return best
+}
+
+func countNodes(node *engine.TraceNode) int {
+	n := 1
+	for _, child := range node.Children {
+		n += countNodes(child)
+	}
+	return n
+}
+
+func describe(node *engine.TraceNode) string {
+	var b strings.Builder
+	if node.Move != "" {
+		b.WriteString(node.Move + " ")
+	}
+	if node.Pruned == engine.PruneFutility || node.Pruned == engine.PruneLateMove {
+		fmt.Fprintf(&b, "skipped (%s)", node.Pruned)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "d=%d [%d,%d] score=%d", node.Depth, node.Alpha, node.Beta, node.Score)
+	if node.Reduction > 0 {
+		fmt.Fprintf(&b, " r=%d", node.Reduction)
+	}
+	if node.TTCutoff {
+		b.WriteString(" tt-cutoff")
+	} else if node.TTHit {
+		b.WriteString(" tt-hit")
+	}
+	if node.Pruned != "" && node.Pruned != engine.PruneTT {
+		fmt.Fprintf(&b, " pruned=%s", node.Pruned)
+	}
+	if node.Truncated {
+		b.WriteString(" truncated")
+	}
+	return b.String()
+}
+
+func printTree(node *engine.TraceNode, level, expand int) {
+	line := strings.Repeat("  ", level) + describe(node)
+	if level >= expand && len(node.Children) > 0 {
+		fmt.Printf("%s  [+%d nodes]\n", line, countNodes(node)-1)
+		return
+	}
+	fmt.Println(line)
+	for _, child := range node.Children {
+		printTree(child, level+1, expand)
+	}
+}
@@ -0,0 +1,96 @@
+//go:build ignore
+
+// Lazy SMP scaling benchmark. Searches a fixed set of positions to a fixed
+// depth with 1, 2, 4 and 8 threads (TT cleared before each search) and
+// reports, per thread count, total nodes across all threads, nodes per
+// second, and time-to-depth -- the wall time for the main thread to
+// complete the target depth, which is what actually buys strength. Speedup
+// is relative to the single-threaded run.
+//
+// Unlike search_bench.go, multi-threaded results aren't deterministic
+// (thread scheduling decides what each helper finds first), and on a
+// machine with fewer cores than threads the numbers mostly measure
+// contention, so run it on an otherwise idle machine with at least 8 cores.
+//
+// Usage:
+//
+//	go run tools/smp_bench.go              # default depth and thread counts
+//	go run tools/smp_bench.go -depth 12    # override depth
+//	go run tools/smp_bench.go -threads 1,4 # override thread counts
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"silverfish/engine"
+)
+
+var benchPositions = []string{
+	"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+	"r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+	"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3",
+	"6k1/5p1p/1q2p1p1/1PnpP3/3N4/1Pr5/P5PP/3QR1K1 w - - 3 37",
+	"r1b2rk1/2q1bppp/p2p1n2/np2p3/3PP3/5N1P/PPBN1PP1/R1BQR1K1 w - - 0 13",
+}
+
+func main() {
+	depth := flag.Int("depth", 10, "search depth for every position")
+	threadList := flag.String("threads", "1,2,4,8", "comma-separated thread counts")
+	flag.Parse()
+
+	var threadCounts []int
+	for _, s := range strings.Split(*threadList, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 1 {
+			fmt.Printf("error: invalid thread count %q\n", s)
+			os.Exit(1)
+		}
+		threadCounts = append(threadCounts, n)
+	}
+
+	engine.Init()
+
+	// Search prints UCI info lines as it goes; keep them out of the report.
+	stdout := os.Stdout
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var baseTime time.Duration
+	for _, threads := range threadCounts {
+		engine.Threads = threads
+
+		var totalNodes int
+		var totalTime time.Duration
+		for _, fen := range benchPositions {
+			engine.ClearTT()
+			pos := engine.FromFEN(fen)
+			search := engine.Search{MaxDepth: *depth, TimeLimit: engine.InfiniteMovetime}
+			search.Init(&pos)
+
+			os.Stdout = devNull
+			start := time.Now()
+			engine.SearchLazySMP(&search)
+			elapsed := time.Since(start)
+			os.Stdout = stdout
+
+			totalNodes += search.TotalNodes
+			totalTime += elapsed
+		}
+
+		if baseTime == 0 {
+			baseTime = totalTime
+		}
+		fmt.Printf("threads=%-2d nodes=%-11d nps=%-9.0f time-to-depth=%-14s speedup=%.2fx\n",
+			threads, totalNodes, float64(totalNodes)/totalTime.Seconds(), totalTime,
+			float64(baseTime)/float64(totalTime))
+	}
+}
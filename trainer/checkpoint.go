@@ -0,0 +1,109 @@
+package trainer
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// A checkpoint is everything a run needs to carry on exactly where it
+// stopped: the parameters, the optimizer's state and the epoch. The run's
+// Config isn't part of it -- resuming with another schedule, batch size or
+// WDL blend is how a run gets fine-tuned -- except for L1, which has to
+// match.
+
+// checkpointVersion is bumped whenever checkpoint's layout changes.
+const checkpointVersion = 1
+
+type checkpoint struct {
+	Version int
+	L1      int
+	Epoch   int
+	Steps   int
+	Params  [][]float32
+	M, V    [][]float32
+}
+
+// CheckpointPath returns the name Train gives the checkpoint written
+// after epoch in dir.
+func CheckpointPath(dir string, epoch int) string {
+	return filepath.Join(dir, fmt.Sprintf("epoch-%03d.ckpt", epoch))
+}
+
+// SaveCheckpoint writes the run's state to path. The file is written
+// under a temporary name and then renamed, so an interrupted save never
+// leaves a truncated checkpoint behind.
+func (t *Trainer) SaveCheckpoint(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(checkpoint{
+		Version: checkpointVersion,
+		L1:      t.cfg.L1,
+		Epoch:   t.epoch,
+		Steps:   t.opt.steps,
+		Params:  t.model.params(),
+		M:       t.opt.m,
+		V:       t.opt.v,
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Resume continues the run checkpointed at path, with cfg (whose L1 may
+// be left zero) for the epochs still to go.
+func Resume(cfg Config, path string) (*Trainer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ckpt checkpoint
+	if err := gob.NewDecoder(f).Decode(&ckpt); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if ckpt.Version != checkpointVersion {
+		return nil, fmt.Errorf("%s: unsupported checkpoint version %d", path, ckpt.Version)
+	}
+	if cfg.L1 == 0 {
+		cfg.L1 = ckpt.L1
+	} else if cfg.L1 != ckpt.L1 {
+		return nil, fmt.Errorf("%s: checkpoint has L1 %d, not %d", path, ckpt.L1, cfg.L1)
+	}
+
+	t, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	params := t.model.params()
+	for _, saved := range [][][]float32{ckpt.Params, ckpt.M, ckpt.V} {
+		if len(saved) != len(params) {
+			return nil, fmt.Errorf("%s: corrupt checkpoint", path)
+		}
+		for k, p := range saved {
+			if len(p) != len(params[k]) {
+				return nil, fmt.Errorf("%s: corrupt checkpoint", path)
+			}
+		}
+	}
+	for k, p := range params {
+		copy(p, ckpt.Params[k])
+		copy(t.opt.m[k], ckpt.M[k])
+		copy(t.opt.v[k], ckpt.V[k])
+	}
+	t.opt.steps = ckpt.Steps
+	t.epoch = ckpt.Epoch
+	return t, nil
+}
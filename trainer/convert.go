@@ -0,0 +1,437 @@
+package trainer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"silverfish/engine"
+)
+
+// Conversion to packed positions, from the formats training data tends to
+// arrive in: PGNs of engine games, EPDs labeled with results, and the text
+// format (see data.go).
+//
+// A PGN's positions take the scores engines leave in move comments -- the
+// cutechess and fastchess "{+0.35/12 0.51s}" (in pawns, from the mover's
+// point of view) or the lichess "[%eval 0.35]" (from White's) -- and the
+// game's Result tag. Positions without a score are dropped (or, with
+// Unscored, kept with a score of 0), and so are book moves and positions
+// scored as mates, whose scores say nothing a network can learn.
+
+// ConvertOptions select which positions a conversion keeps.
+type ConvertOptions struct {
+	// Quiet keeps only positions not in check whose move -- the move played
+	// in a PGN, the best move (bm) in an EPD -- is neither a capture nor a
+	// promotion, like the positions datagen keeps. An EPD position with no
+	// best move counts as quiet if it's not in check.
+	Quiet bool
+
+	// Unscored keeps positions that have no score, scoring them 0.
+	Unscored bool
+}
+
+// ConvertStats counts the positions a conversion kept and dropped.
+type ConvertStats struct {
+	Kept, Dropped int64
+}
+
+func (cs ConvertStats) String() string {
+	return fmt.Sprintf("%d positions kept, %d dropped", cs.Kept, cs.Dropped)
+}
+
+// ConvertFunc is the signature the Convert functions share.
+type ConvertFunc func(r io.Reader, w *engine.PackedWriter, opts ConvertOptions) (ConvertStats, error)
+
+// ConverterFor returns the converter for a file, by its extension: .pgn,
+// .epd or .txt.
+func ConverterFor(path string) (ConvertFunc, error) {
+	switch {
+	case strings.HasSuffix(path, ".pgn"):
+		return ConvertPGN, nil
+	case strings.HasSuffix(path, ".epd"):
+		return ConvertEPD, nil
+	case strings.HasSuffix(path, ".txt"):
+		return ConvertText, nil
+	}
+	return nil, fmt.Errorf("%s: unknown format (want .pgn, .epd or .txt)", path)
+}
+
+// quiet reports whether pos is not in check and move, if any, is neither a
+// capture nor a promotion.
+func quiet(pos *engine.Position, move engine.Move) bool {
+	if pos.Checkers(pos.Turn) != 0 {
+		return false
+	}
+	if move == 0 {
+		return true
+	}
+	_, victim := pos.GetSquare(move.To())
+	return victim == engine.NoPiece && !move.IsPromotion() && !move.IsEnPassant()
+}
+
+// pgnPly is a position of a game being converted, waiting for its score
+// and the game's result.
+type pgnPly struct {
+	packed engine.PackedPosition
+	keep   bool // passes the Quiet filter
+	scored bool
+	drop   bool // a book move or a mate score
+}
+
+// ConvertPGN converts the games of a PGN. A game whose result is unknown
+// ("*") is skipped; a game with an illegal or unreadable move is an error.
+// engine.Init must have been called.
+func ConvertPGN(r io.Reader, w *engine.PackedWriter, opts ConvertOptions) (ConvertStats, error) {
+	var stats ConvertStats
+	var tags map[string]string
+	var movetext strings.Builder
+	games, line := 0, 0
+	flush := func() error {
+		if tags == nil && movetext.Len() == 0 {
+			return nil
+		}
+		games++
+		if err := convertGame(tags, movetext.String(), w, opts, &stats); err != nil {
+			return fmt.Errorf("game %d (ending line %d): %w", games, line, err)
+		}
+		tags = nil
+		movetext.Reset()
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "[") && !strings.HasPrefix(text, "[%") {
+			// a tag after movetext starts the next game
+			if movetext.Len() > 0 {
+				if err := flush(); err != nil {
+					return stats, err
+				}
+			}
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			name, value, ok := parseTag(text)
+			if !ok {
+				return stats, fmt.Errorf("line %d: invalid tag %q", line, text)
+			}
+			tags[name] = value
+			continue
+		}
+		movetext.WriteString(text)
+		movetext.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, err
+	}
+	return stats, flush()
+}
+
+// parseTag parses a PGN tag pair, `[Name "value"]`.
+func parseTag(s string) (name, value string, ok bool) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	name, value, ok = strings.Cut(s, " ")
+	if !ok {
+		return "", "", false
+	}
+	value, err := strconv.Unquote(strings.TrimSpace(value))
+	return name, value, err == nil
+}
+
+func convertGame(tags map[string]string, movetext string, w *engine.PackedWriter, opts ConvertOptions, stats *ConvertStats) error {
+	var result uint8
+	switch tags["Result"] {
+	case "1-0":
+		result = engine.PackedWhiteWins
+	case "1/2-1/2":
+		result = engine.PackedDraw
+	case "0-1":
+		result = engine.PackedBlackWins
+	default:
+		return nil
+	}
+	pos := engine.StartingPosition()
+	if fen, ok := tags["FEN"]; ok {
+		var err error
+		if pos, err = parseFEN(fen); err != nil {
+			return err
+		}
+	}
+
+	var plies []pgnPly
+	for i := 0; i < len(movetext); {
+		c := movetext[i]
+		switch {
+		case c == '{':
+			end := strings.IndexByte(movetext[i:], '}')
+			if end < 0 {
+				return fmt.Errorf("unterminated comment")
+			}
+			if len(plies) > 0 {
+				parseComment(movetext[i+1:i+end], &plies[len(plies)-1])
+			}
+			i += end + 1
+		case c == ';':
+			end := strings.IndexByte(movetext[i:], '\n')
+			if end < 0 {
+				end = len(movetext) - i
+			}
+			i += end
+		case c == '(':
+			// a variation: skip it, and any nested in it
+			depth := 0
+			for ; i < len(movetext); i++ {
+				if movetext[i] == '(' {
+					depth++
+				} else if movetext[i] == ')' {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			i++
+		case c == ' ' || c == '\n' || c == '\t' || c == '\r':
+			i++
+		default:
+			end := strings.IndexAny(movetext[i:], " \n\t\r{};()")
+			if end < 0 {
+				end = len(movetext) - i
+			}
+			token := movetext[i : i+end]
+			i += end
+			switch token {
+			case "1-0", "0-1", "1/2-1/2", "*":
+				continue
+			}
+			// move numbers, "12." or "12...", possibly run into the move
+			token = strings.TrimLeft(strings.TrimLeft(token, "0123456789"), ".")
+			if token == "" || token[0] == '$' { // or a NAG
+				continue
+			}
+			move, err := pos.ParseSAN(token)
+			if err != nil {
+				return err
+			}
+			plies = append(plies, pgnPly{
+				packed: pos.Pack(0),
+				keep:   !opts.Quiet || quiet(&pos, move),
+			})
+			pos.DoMove(move)
+		}
+	}
+
+	for i := range plies {
+		ply := &plies[i]
+		if !ply.keep || ply.drop || !(ply.scored || opts.Unscored) {
+			stats.Dropped++
+			continue
+		}
+		ply.packed.Result = result
+		if err := w.Write(&ply.packed); err != nil {
+			return err
+		}
+		stats.Kept++
+	}
+	return nil
+}
+
+// parseComment takes a score from a move's comment, if it has one: a
+// lichess "[%eval 0.35]" or "[%eval #-3]", White's point of view, or a
+// cutechess "+0.35/12 0.51s", "-M5/20" or "book", the mover's.
+func parseComment(comment string, ply *pgnPly) {
+	comment = strings.TrimSpace(comment)
+	if _, eval, ok := strings.Cut(comment, "[%eval "); ok {
+		eval, _, _ = strings.Cut(eval, "]")
+		eval = strings.TrimSpace(eval)
+		if strings.HasPrefix(eval, "#") {
+			ply.drop = true
+		} else if pawns, err := strconv.ParseFloat(eval, 64); err == nil {
+			ply.packed.Score, ply.scored = pawnsToCentipawns(pawns), true
+		}
+		return
+	}
+	if strings.HasPrefix(comment, "book") {
+		ply.drop = true
+		return
+	}
+	score, _, ok := strings.Cut(comment, "/")
+	if !ok {
+		return
+	}
+	if unsigned := strings.TrimLeft(score, "+-"); strings.HasPrefix(unsigned, "M") {
+		ply.drop = true
+		return
+	}
+	pawns, err := strconv.ParseFloat(score, 64)
+	if err != nil {
+		return
+	}
+	if ply.packed.Turn() == engine.Black {
+		pawns = -pawns
+	}
+	ply.packed.Score, ply.scored = pawnsToCentipawns(pawns), true
+}
+
+func pawnsToCentipawns(pawns float64) int16 {
+	return int16(max(min(math.Round(pawns*100), math.MaxInt16), math.MinInt16))
+}
+
+// ConvertEPD converts an EPD, one position per line: the four FEN fields
+// of an EPD, optionally followed by the FEN's two clocks, and then
+// operations, of which it reads
+//
+//	c9 "1-0"   the result, from White's point of view
+//	ce 35      the score in centipawns, from the side to move's
+//	bm Nf3     the best move, for the Quiet filter
+//	hmvc 0     the half-move clock, if not given as a clock
+//	fmvn 1     the full-move number, likewise
+//
+// A result may be given instead as a bracketed "[1.0]", "[0.5]", "[0.0]"
+// or "[1-0]" after the position, as some trainers' EPDs do. A position
+// without a result is an error. engine.Init must have been called.
+func ConvertEPD(r io.Reader, w *engine.PackedWriter, opts ConvertOptions) (ConvertStats, error) {
+	var stats ConvertStats
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		kept, err := convertEPDLine(line, w, opts)
+		if err != nil {
+			return stats, fmt.Errorf("line %d: %w", n, err)
+		}
+		if kept {
+			stats.Kept++
+		} else {
+			stats.Dropped++
+		}
+	}
+	return stats, scanner.Err()
+}
+
+func convertEPDLine(line string, w *engine.PackedWriter, opts ConvertOptions) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return false, fmt.Errorf("invalid EPD %q", line)
+	}
+	board, rest := fields[:4], strings.Join(fields[4:], " ")
+	clocks := []string{"0", "1"}
+	if f := fields[4:]; len(f) >= 2 && isNumber(f[0]) && isNumber(strings.TrimSuffix(f[1], ";")) {
+		clocks = []string{f[0], strings.TrimSuffix(f[1], ";")}
+		rest = strings.Join(f[2:], " ")
+	}
+
+	result := ""
+	if strings.HasPrefix(rest, "[") {
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return false, fmt.Errorf("invalid EPD %q", line)
+		}
+		result, rest = rest[1:end], rest[end+1:]
+	}
+	score, scored, bestMove := 0, false, ""
+	for _, op := range strings.Split(rest, ";") {
+		opcode, operand, _ := strings.Cut(strings.TrimSpace(op), " ")
+		operand = strings.TrimSpace(operand)
+		switch opcode {
+		case "c9":
+			unquoted, err := strconv.Unquote(operand)
+			if err != nil {
+				return false, fmt.Errorf("invalid c9 %q", operand)
+			}
+			result = unquoted
+		case "ce":
+			var err error
+			if score, err = strconv.Atoi(operand); err != nil {
+				return false, fmt.Errorf("invalid ce %q", operand)
+			}
+			scored = true
+		case "bm":
+			bestMove = strings.Fields(operand)[0]
+		case "hmvc":
+			clocks[0] = operand
+		case "fmvn":
+			clocks[1] = operand
+		}
+	}
+	if result == "" {
+		return false, fmt.Errorf("no result in %q", line)
+	}
+	white, err := parseResult(result)
+	if err != nil {
+		return false, err
+	}
+
+	pos, err := parseFEN(strings.Join(append(board, clocks...), " "))
+	if err != nil {
+		return false, err
+	}
+	var move engine.Move
+	if bestMove != "" {
+		if move, err = pos.ParseSAN(bestMove); err != nil {
+			return false, err
+		}
+	}
+	if (opts.Quiet && !quiet(&pos, move)) || !(scored || opts.Unscored) {
+		return false, nil
+	}
+	if pos.Turn == engine.Black {
+		score = -score
+	}
+	packed := pos.Pack(int32(score))
+	packed.Result = uint8(white * 2)
+	return true, w.Write(&packed)
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// ConvertText converts the text format. Every position is scored, so only
+// Quiet's check test applies. engine.Init must have been called.
+func ConvertText(r io.Reader, w *engine.PackedWriter, opts ConvertOptions) (ConvertStats, error) {
+	var stats ConvertStats
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		parts := strings.Split(line, "|")
+		if len(parts) != 3 {
+			return stats, fmt.Errorf("line %d: want <fen> | <score> | <result>, got %q", n, line)
+		}
+		score, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return stats, fmt.Errorf("line %d: invalid score: %w", n, err)
+		}
+		result, err := parseResult(strings.TrimSpace(parts[2]))
+		if err != nil {
+			return stats, fmt.Errorf("line %d: %w", n, err)
+		}
+		pos, err := parseFEN(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return stats, fmt.Errorf("line %d: %w", n, err)
+		}
+		if opts.Quiet && !quiet(&pos, 0) {
+			stats.Dropped++
+			continue
+		}
+		packed := pos.Pack(int32(score))
+		packed.Result = uint8(result * 2)
+		if err := w.Write(&packed); err != nil {
+			return stats, err
+		}
+		stats.Kept++
+	}
+	return stats, scanner.Err()
+}
@@ -0,0 +1,167 @@
+package trainer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"silverfish/engine"
+)
+
+// Labeled position data. The trainer learns from positions labeled with a
+// search score and the result of the game they were played in; in text
+// form, one position per line:
+//
+//	<FEN> | <score> | <result>
+//
+// with the score in centipawns and the result as 1.0, 0.5 or 0.0 (or 1-0,
+// 1/2-1/2, 0-1), both from White's point of view -- the text format most
+// NNUE trainers read. Blank lines and lines starting with '#' are skipped.
+
+// maxFeatures is how many features one perspective can have active: one
+// per piece on the board.
+const maxFeatures = 32
+
+// Sample is one labeled position, reduced to what training needs: its
+// active features from both perspectives, side to move first, and its
+// labels from the side to move's point of view.
+type Sample struct {
+	Features [2][maxFeatures]uint16
+	N        uint8 // features active per perspective (the piece count)
+
+	Score  float32 // search score in centipawns
+	Result float32 // 1 for a win, 0.5 for a draw, 0 for a loss
+}
+
+// NewSample returns pos as a Sample, given a score (in centipawns) and a
+// result (1, 0.5 or 0) from White's point of view. The features are
+// engine.FeatureIndex's, the plain 768-feature layout.
+func NewSample(pos *engine.Position, score int, result float32) (Sample, error) {
+	return newSample(&pos.Pieces, pos.Turn, score, result)
+}
+
+// SampleFromPacked returns a packed position as a Sample.
+func SampleFromPacked(p *engine.PackedPosition) (Sample, error) {
+	pieces, err := p.Bitboards()
+	if err != nil {
+		return Sample{}, err
+	}
+	return newSample(&pieces, p.Turn(), int(p.Score), float32(p.Result)/2)
+}
+
+func newSample(pieces *[2][6]engine.Bitboard, us uint8, score int, result float32) (Sample, error) {
+	var s Sample
+	for color := engine.White; color <= engine.Black; color++ {
+		for piece := engine.Pawn; piece <= engine.King; piece++ {
+			bb := pieces[color][piece]
+			for bb != 0 {
+				if s.N == maxFeatures {
+					return Sample{}, fmt.Errorf("more than %d pieces", maxFeatures)
+				}
+				sq := engine.PopLsb(&bb)
+				s.Features[0][s.N] = engine.FeatureIndex(us, color, piece, sq)
+				s.Features[1][s.N] = engine.FeatureIndex(us^1, color, piece, sq)
+				s.N++
+			}
+		}
+	}
+	s.Score, s.Result = float32(score), result
+	if us == engine.Black {
+		s.Score, s.Result = -s.Score, 1-s.Result
+	}
+	return s, nil
+}
+
+// ParseSample parses one line of the text format. engine.Init must have
+// been called.
+func ParseSample(line string) (Sample, error) {
+	parts := strings.Split(line, "|")
+	if len(parts) != 3 {
+		return Sample{}, fmt.Errorf("want <fen> | <score> | <result>, got %q", line)
+	}
+	score, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return Sample{}, fmt.Errorf("invalid score: %w", err)
+	}
+	result, err := parseResult(strings.TrimSpace(parts[2]))
+	if err != nil {
+		return Sample{}, err
+	}
+	pos, err := parseFEN(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return Sample{}, err
+	}
+	return NewSample(&pos, score, result)
+}
+
+func parseResult(s string) (float32, error) {
+	switch s {
+	case "1-0":
+		return 1, nil
+	case "1/2-1/2":
+		return 0.5, nil
+	case "0-1":
+		return 0, nil
+	}
+	r, err := strconv.ParseFloat(s, 32)
+	if err != nil || (r != 0 && r != 0.5 && r != 1) {
+		return 0, fmt.Errorf("invalid result %q", s)
+	}
+	return float32(r), nil
+}
+
+// parseFEN is engine.FromFEN, with its panic on a malformed FEN turned
+// into an error -- a bad line in a data file shouldn't end a training run.
+func parseFEN(fen string) (pos engine.Position, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid FEN %q: %v", fen, r)
+		}
+	}()
+	if len(strings.Fields(fen)) != 6 {
+		return pos, fmt.Errorf("invalid FEN %q", fen)
+	}
+	return engine.FromFEN(fen), nil
+}
+
+// ReadText reads labeled positions in the text format.
+func ReadText(r io.Reader) ([]Sample, error) {
+	var samples []Sample
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		s, err := ParseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		samples = append(samples, s)
+	}
+	return samples, scanner.Err()
+}
+
+// LoadText reads a file of labeled positions in the text format.
+func LoadText(path string) ([]Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	samples, err := ReadText(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return samples, nil
+}
+
+// WriteText writes a labeled position in the text format, with score and
+// result from White's point of view.
+func WriteText(w io.Writer, pos *engine.Position, score int, result float32) error {
+	_, err := fmt.Fprintf(w, "%s | %d | %.1f\n", pos.ToFEN(), score, result)
+	return err
+}
@@ -0,0 +1,398 @@
+package trainer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"silverfish/engine"
+)
+
+// Packed data files: engine.PackedPosition records back to back (see
+// engine/packed.go), the format datagen writes and the one training data is
+// best kept in. Being fixed-size, records are counted from the file size
+// and shuffled, deduplicated and interleaved without parsing anything but
+// the records themselves.
+
+// Load reads labeled positions from path: text (see data.go) if its name
+// ends in .txt, packed positions otherwise.
+func Load(path string) ([]Sample, error) {
+	if strings.HasSuffix(path, ".txt") {
+		return LoadText(path)
+	}
+	return LoadPacked(path)
+}
+
+// LoadPacked reads a file of packed positions.
+func LoadPacked(path string) ([]Sample, error) {
+	n, err := CountPacked(path)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]Sample, 0, n)
+	err = forEachPacked(path, func(p *engine.PackedPosition) error {
+		s, err := SampleFromPacked(p)
+		samples = append(samples, s)
+		return err
+	})
+	return samples, err
+}
+
+// CountPacked returns how many packed positions the file at path holds.
+func CountPacked(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if info.Size()%engine.PackedSize != 0 {
+		return 0, fmt.Errorf("%s: size %d is not a whole number of %d-byte positions", path, info.Size(), engine.PackedSize)
+	}
+	return info.Size() / engine.PackedSize, nil
+}
+
+// forEachPacked calls fn on every position of a packed file, in order.
+func forEachPacked(path string, fn func(p *engine.PackedPosition) error) error {
+	if _, err := CountPacked(path); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := engine.NewPackedReader(f)
+	for n := int64(0); ; n++ {
+		p, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			err = fn(&p)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: position %d: %w", path, n, err)
+		}
+	}
+}
+
+// packedFile is a packed file being written.
+type packedFile struct {
+	f *os.File
+	*engine.PackedWriter
+}
+
+func createPacked(path string) (*packedFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &packedFile{f, engine.NewPackedWriter(f)}, nil
+}
+
+// Close flushes and closes the file, returning the first error either
+// step meets.
+func (pf *packedFile) Close() error {
+	err := pf.Flush()
+	if cerr := pf.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ShuffleFile writes in's positions to out in a uniformly random order,
+// keeping at most about maxMemory bytes of positions in memory. A file
+// that fits is shuffled in memory; a larger one is first scattered at
+// random into temporary bucket files next to out, each small enough to
+// fit, and then each bucket is shuffled in memory and appended to out --
+// which is still a uniform shuffle, since every position lands in every
+// bucket, and every bucket order, with equal probability. out may be in.
+func ShuffleFile(in, out string, rng *rand.Rand, maxMemory int64) error {
+	n, err := CountPacked(in)
+	if err != nil {
+		return err
+	}
+	perBucket := max(maxMemory/engine.PackedSize, 1)
+	// twice the minimum, so buckets overfilled by chance still fit
+	buckets := int((2*n + perBucket - 1) / perBucket)
+	if buckets <= 1 {
+		return shuffleInMemory(in, out, rng)
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(out), "shuffle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	paths := make([]string, buckets)
+	files := make([]*packedFile, buckets)
+	for i := range files {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("bucket-%d", i))
+		if files[i], err = createPacked(paths[i]); err != nil {
+			return err
+		}
+	}
+	err = forEachPacked(in, func(p *engine.PackedPosition) error {
+		return files[rng.Intn(buckets)].Write(p)
+	})
+	for _, f := range files {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := createPacked(out)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		var positions []engine.PackedPosition
+		if positions, err = readPacked(path); err != nil {
+			break
+		}
+		if err = writeShuffled(positions, result, rng); err != nil {
+			break
+		}
+	}
+	if cerr := result.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// shuffleInMemory shuffles a file that fits in memory, reading all of it
+// before creating out, which may be the same file.
+func shuffleInMemory(in, out string, rng *rand.Rand) error {
+	positions, err := readPacked(in)
+	if err != nil {
+		return err
+	}
+	result, err := createPacked(out)
+	if err != nil {
+		return err
+	}
+	err = writeShuffled(positions, result, rng)
+	if cerr := result.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func readPacked(path string) ([]engine.PackedPosition, error) {
+	var positions []engine.PackedPosition
+	err := forEachPacked(path, func(p *engine.PackedPosition) error {
+		positions = append(positions, *p)
+		return nil
+	})
+	return positions, err
+}
+
+func writeShuffled(positions []engine.PackedPosition, out *packedFile, rng *rand.Rand) error {
+	rng.Shuffle(len(positions), func(i, j int) {
+		positions[i], positions[j] = positions[j], positions[i]
+	})
+	for i := range positions {
+		if err := out.Write(&positions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DedupFile copies in's positions to out, keeping only the first of any
+// that share a Position.Hash (the board, side to move, castling rights and
+// en passant square), and returns how many it kept and dropped. out must
+// not be in.
+func DedupFile(in, out string) (kept, dropped int64, err error) {
+	n, err := CountPacked(in)
+	if err != nil {
+		return 0, 0, err
+	}
+	result, err := createPacked(out)
+	if err != nil {
+		return 0, 0, err
+	}
+	seen := make(map[uint64]struct{}, n)
+	err = forEachPacked(in, func(p *engine.PackedPosition) error {
+		pos, err := p.Unpack()
+		if err != nil {
+			return err
+		}
+		if _, dup := seen[pos.Hash]; dup {
+			dropped++
+			return nil
+		}
+		seen[pos.Hash] = struct{}{}
+		kept++
+		return result.Write(p)
+	})
+	if cerr := result.Close(); err == nil {
+		err = cerr
+	}
+	return kept, dropped, err
+}
+
+// InterleaveFiles writes every position of ins to out, taking each next
+// position from a file chosen at random in proportion to how many it has
+// left, so every file's positions are spread evenly through the output
+// (each file's own order is kept; shuffle them first for a full mix). out
+// must not be one of ins.
+func InterleaveFiles(ins []string, out string, rng *rand.Rand) error {
+	remaining := make([]int64, len(ins))
+	readers := make([]*engine.PackedReader, len(ins))
+	var total int64
+	for i, in := range ins {
+		var err error
+		if remaining[i], err = CountPacked(in); err != nil {
+			return err
+		}
+		f, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers[i] = engine.NewPackedReader(f)
+		total += remaining[i]
+	}
+
+	result, err := createPacked(out)
+	if err != nil {
+		return err
+	}
+	for ; total > 0 && err == nil; total-- {
+		pick := rng.Int63n(total)
+		i := 0
+		for pick >= remaining[i] {
+			pick -= remaining[i]
+			i++
+		}
+		remaining[i]--
+		var p engine.PackedPosition
+		if p, err = readers[i].Read(); err != nil {
+			err = fmt.Errorf("%s: %w", ins[i], err)
+			break
+		}
+		err = result.Write(&p)
+	}
+	if cerr := result.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Score histogram buckets: StatsScoreBucket centipawns wide, from
+// -statsScoreRange to statsScoreRange, with everything beyond in the two
+// outermost buckets.
+const (
+	StatsScoreBucket = 100
+	statsScoreRange  = 2000
+	statsScoreBins   = 2*statsScoreRange/StatsScoreBucket + 2
+)
+
+// DataStats describes a packed data file.
+type DataStats struct {
+	Positions int64
+	Results   [3]int64  // indexed by PackedPosition.Result
+	Pieces    [33]int64 // positions by piece count, kings included
+
+	// Scores is the score histogram (see StatsScoreBucket), from White's
+	// point of view; ScoreSum and ScoreSquares give the mean and spread.
+	Scores             [statsScoreBins]int64
+	ScoreSum           float64
+	ScoreSquares       float64
+	MinScore, MaxScore int16
+}
+
+// ComputeStats reads a packed file's statistics.
+func ComputeStats(path string) (DataStats, error) {
+	stats := DataStats{MinScore: math.MaxInt16, MaxScore: math.MinInt16}
+	err := forEachPacked(path, func(p *engine.PackedPosition) error {
+		if p.Result > engine.PackedWhiteWins {
+			return errors.New("invalid result")
+		}
+		if _, err := p.Bitboards(); err != nil {
+			return err
+		}
+		count := bits.OnesCount64(uint64(p.Occupied))
+		stats.Positions++
+		stats.Results[p.Result]++
+		stats.Pieces[count]++
+		stats.Scores[scoreBin(p.Score)]++
+		stats.ScoreSum += float64(p.Score)
+		stats.ScoreSquares += float64(p.Score) * float64(p.Score)
+		stats.MinScore = min(stats.MinScore, p.Score)
+		stats.MaxScore = max(stats.MaxScore, p.Score)
+		return nil
+	})
+	return stats, err
+}
+
+func scoreBin(score int16) int {
+	switch {
+	case score < -statsScoreRange:
+		return 0
+	case score >= statsScoreRange:
+		return statsScoreBins - 1
+	}
+	return (int(score)+statsScoreRange)/StatsScoreBucket + 1
+}
+
+// Write prints the statistics as text, with bar charts for the
+// histograms.
+func (s *DataStats) Write(w io.Writer) {
+	if s.Positions == 0 {
+		fmt.Fprintln(w, "no positions")
+		return
+	}
+	percent := func(n int64) float64 { return 100 * float64(n) / float64(s.Positions) }
+	mean := s.ScoreSum / float64(s.Positions)
+	fmt.Fprintf(w, "positions: %d\n", s.Positions)
+	fmt.Fprintf(w, "results:   White %.1f%%, draw %.1f%%, Black %.1f%%\n",
+		percent(s.Results[engine.PackedWhiteWins]), percent(s.Results[engine.PackedDraw]), percent(s.Results[engine.PackedBlackWins]))
+	fmt.Fprintf(w, "scores:    mean %.1f, stddev %.1f, min %d, max %d\n",
+		mean, math.Sqrt(max(s.ScoreSquares/float64(s.Positions)-mean*mean, 0)), s.MinScore, s.MaxScore)
+
+	bar := func(label string, n, most int64) {
+		line := fmt.Sprintf("%14s %9d %5.1f%% %s", label, n, percent(n), strings.Repeat("#", int(40*n/max(most, 1))))
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+	fmt.Fprintln(w, "\npieces:")
+	most := int64(0)
+	for _, n := range s.Pieces {
+		most = max(most, n)
+	}
+	for count, n := range s.Pieces {
+		if n > 0 {
+			bar(fmt.Sprint(count), n, most)
+		}
+	}
+	// scores from the lowest bucket used to the highest
+	fmt.Fprintln(w, "\nscores (White's view):")
+	most, first, last := int64(0), len(s.Scores), 0
+	for bin, n := range s.Scores {
+		most = max(most, n)
+		if n > 0 {
+			first, last = min(first, bin), bin
+		}
+	}
+	for bin := first; bin <= last; bin++ {
+		n := s.Scores[bin]
+		lo := (bin-1)*StatsScoreBucket - statsScoreRange
+		label := fmt.Sprintf("[%d, %d)", lo, lo+StatsScoreBucket)
+		switch bin {
+		case 0:
+			label = fmt.Sprintf("< %d", -statsScoreRange)
+		case len(s.Scores) - 1:
+			label = fmt.Sprintf(">= %d", statsScoreRange)
+		}
+		bar(label, n, most)
+	}
+}
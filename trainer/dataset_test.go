@@ -0,0 +1,318 @@
+package trainer_test
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"silverfish/engine"
+	"silverfish/trainer"
+)
+
+const testPGN = `[Event "cutechess"]
+[Result "1-0"]
+
+1. e4 {book} e5 {book} 2. Nf3 {+0.45/12 0.10s} Nc6 {-0.30/11 0.09s}
+3. Bb5 {+0.50/12} a6 {-0.40/12} 4. Bxc6 {+0.60/10} dxc6 {-M3/9} 1-0
+
+[Event "lichess"]
+[Result "0-1"]
+[FEN "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1"]
+[SetUp "1"]
+
+1. e4 { [%eval -0.2] } 1... Kd7 { [%eval #-3] } (1... Ke7 { [%eval 0.1] } 2. e5)
+2. Kd2 { [%clk 0:01:00] } 0-1
+
+[Event "unfinished"]
+[Result "*"]
+
+1. e4 {+0.30/10} *
+`
+
+// convert runs a converter over text and returns what it wrote.
+func convert(t *testing.T, fn trainer.ConvertFunc, text string, opts trainer.ConvertOptions) ([]engine.PackedPosition, trainer.ConvertStats) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := engine.NewPackedWriter(&buf)
+	stats, err := fn(strings.NewReader(text), w, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	var positions []engine.PackedPosition
+	for b := buf.Bytes(); len(b) > 0; b = b[engine.PackedSize:] {
+		positions = append(positions, engine.DecodePackedPosition(b))
+	}
+	return positions, stats
+}
+
+func TestConvertPGN(t *testing.T) {
+	positions, stats := convert(t, trainer.ConvertPGN, testPGN, trainer.ConvertOptions{})
+	if stats != (trainer.ConvertStats{Kept: 6, Dropped: 5}) {
+		t.Errorf("got %v, want 6 kept, 5 dropped", stats)
+	}
+	// scores from White's point of view, whoever moved
+	want := []struct {
+		fen    string
+		score  int16
+		result uint8
+	}{
+		{"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq e6 0 2", 45, engine.PackedWhiteWins},
+		{"rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2", 30, engine.PackedWhiteWins},
+		{"r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3", 50, engine.PackedWhiteWins},
+		{"r1bqkbnr/pppp1ppp/2n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R b KQkq - 3 3", 40, engine.PackedWhiteWins},
+		{"r1bqkbnr/1ppp1ppp/p1n5/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 0 4", 60, engine.PackedWhiteWins},
+		{"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", -20, engine.PackedBlackWins},
+	}
+	for i, p := range positions {
+		pos, err := p.Unpack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(want) || pos.ToFEN() != want[i].fen || p.Score != want[i].score || p.Result != want[i].result {
+			t.Errorf("position %d: %s scored %d, result %d", i, pos.ToFEN(), p.Score, p.Result)
+		}
+	}
+
+	// quiet drops the capture Bxc6; unscored keeps the clock-only Kd2
+	_, stats = convert(t, trainer.ConvertPGN, testPGN, trainer.ConvertOptions{Quiet: true, Unscored: true})
+	if stats != (trainer.ConvertStats{Kept: 6, Dropped: 5}) {
+		t.Errorf("quiet, unscored: got %v, want 6 kept, 5 dropped", stats)
+	}
+
+	var buf bytes.Buffer
+	w := engine.NewPackedWriter(&buf)
+	if _, err := trainer.ConvertPGN(strings.NewReader("[Result \"1-0\"]\n\n1. e4 e4 1-0\n"), w, trainer.ConvertOptions{}); err == nil {
+		t.Errorf("converted a game with an illegal move")
+	}
+}
+
+func TestConvertEPD(t *testing.T) {
+	epd := `rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - c9 "1/2-1/2"; ce 20; bm e4;
+rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1 [0.0] ce 15;
+r3k2r/8/8/8/8/8/8/R3K2R w KQkq - hmvc 7; fmvn 30; c9 "1-0"; ce 100; bm Rxa8+;
+4k3/8/8/8/8/8/8/4K3 w - - c9 "0-1";
+`
+	positions, stats := convert(t, trainer.ConvertEPD, epd, trainer.ConvertOptions{})
+	if stats != (trainer.ConvertStats{Kept: 3, Dropped: 1}) || len(positions) != 3 {
+		t.Fatalf("got %v, want 3 kept, 1 dropped", stats)
+	}
+	want := []struct {
+		fen    string
+		score  int16
+		result uint8
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 20, engine.PackedDraw},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", -15, engine.PackedBlackWins},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 7 30", 100, engine.PackedWhiteWins},
+	}
+	for i, p := range positions {
+		pos, err := p.Unpack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pos.ToFEN() != want[i].fen || p.Score != want[i].score || p.Result != want[i].result {
+			t.Errorf("position %d: %s scored %d, result %d", i, pos.ToFEN(), p.Score, p.Result)
+		}
+	}
+
+	// quiet drops the capture Rxa8; unscored keeps the bare kings
+	_, stats = convert(t, trainer.ConvertEPD, epd, trainer.ConvertOptions{Quiet: true, Unscored: true})
+	if stats != (trainer.ConvertStats{Kept: 3, Dropped: 1}) {
+		t.Errorf("quiet, unscored: got %v, want 3 kept, 1 dropped", stats)
+	}
+
+	var buf bytes.Buffer
+	w := engine.NewPackedWriter(&buf)
+	if _, err := trainer.ConvertEPD(strings.NewReader("4k3/8/8/8/8/8/8/4K3 w - - ce 5;\n"), w, trainer.ConvertOptions{}); err == nil {
+		t.Errorf("converted a position without a result")
+	}
+}
+
+// packedCorpus writes n random-playout positions, scored by their index,
+// to a packed file, and returns them.
+func packedCorpus(t *testing.T, path string, n int) []engine.PackedPosition {
+	positions, _ := labeledCorpus(t, n)
+	packed := make([]engine.PackedPosition, n)
+	for i := range positions {
+		packed[i] = positions[i].Pack(int32(i))
+	}
+	writePacked(t, path, packed)
+	return packed
+}
+
+func writePacked(t *testing.T, path string, positions []engine.PackedPosition) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := engine.WritePackedPositions(f, positions); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readPacked(t *testing.T, path string) []engine.PackedPosition {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var positions []engine.PackedPosition
+	for ; len(b) > 0; b = b[engine.PackedSize:] {
+		positions = append(positions, engine.DecodePackedPosition(b))
+	}
+	return positions
+}
+
+func byScore(a, b engine.PackedPosition) int { return int(a.Score) - int(b.Score) }
+
+func TestShuffleFile(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.bin"), filepath.Join(dir, "out.bin")
+	original := packedCorpus(t, in, 1000)
+
+	// through temporary buckets of about 100 positions, then in place in
+	// memory
+	for _, tc := range []struct {
+		in, out   string
+		maxMemory int64
+	}{{in, out, 100 * engine.PackedSize}, {out, out, 1 << 20}} {
+		rng := rand.New(rand.NewSource(1))
+		if err := trainer.ShuffleFile(tc.in, tc.out, rng, tc.maxMemory); err != nil {
+			t.Fatal(err)
+		}
+		shuffled := readPacked(t, tc.out)
+		if slices.Equal(shuffled, original) {
+			t.Errorf("max memory %d: order unchanged", tc.maxMemory)
+		}
+		slices.SortFunc(shuffled, byScore)
+		if !slices.Equal(shuffled, original) {
+			t.Errorf("max memory %d: shuffled positions differ from the original's", tc.maxMemory)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("%d files left in %s, want 2", len(entries), dir)
+	}
+}
+
+func TestDedupFile(t *testing.T) {
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.bin"), filepath.Join(dir, "out.bin")
+	original := packedCorpus(t, in, 300)
+	// the same positions again, scored differently: the first copy is kept
+	repeated := slices.Clone(original)
+	for i := range repeated {
+		repeated[i].Score += 1000
+	}
+	writePacked(t, in, append(slices.Clone(original), repeated...))
+
+	unique := map[uint64]bool{}
+	for _, p := range original {
+		pos, _ := p.Unpack()
+		unique[pos.Hash] = true
+	}
+	kept, dropped, err := trainer.DedupFile(in, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept != int64(len(unique)) || dropped != int64(2*len(original)-len(unique)) {
+		t.Errorf("kept %d, dropped %d; want %d, %d", kept, dropped, len(unique), 2*len(original)-len(unique))
+	}
+	for _, p := range readPacked(t, out) {
+		if p.Score >= 1000 {
+			t.Fatalf("kept a later duplicate")
+		}
+	}
+}
+
+func TestInterleaveFiles(t *testing.T) {
+	dir := t.TempDir()
+	a, b, out := filepath.Join(dir, "a.bin"), filepath.Join(dir, "b.bin"), filepath.Join(dir, "out.bin")
+	original := packedCorpus(t, a, 600)
+	writePacked(t, a, original[:200])
+	writePacked(t, b, original[200:])
+
+	if err := trainer.InterleaveFiles([]string{a, b}, out, rand.New(rand.NewSource(1))); err != nil {
+		t.Fatal(err)
+	}
+	mixed := readPacked(t, out)
+	if len(mixed) != len(original) {
+		t.Fatalf("wrote %d positions, want %d", len(mixed), len(original))
+	}
+	// each file's order is kept, and a's third is spread through the output
+	var fromA, fromB []engine.PackedPosition
+	for _, p := range mixed {
+		if p.Score < 200 {
+			fromA = append(fromA, p)
+		} else {
+			fromB = append(fromB, p)
+		}
+	}
+	if !slices.Equal(fromA, original[:200]) || !slices.Equal(fromB, original[200:]) {
+		t.Errorf("files' orders not kept")
+	}
+	firstHalf := 0
+	for _, p := range mixed[:300] {
+		if p.Score < 200 {
+			firstHalf++
+		}
+	}
+	if firstHalf < 70 || firstHalf > 130 {
+		t.Errorf("%d of a's 200 positions in the first half, want about 100", firstHalf)
+	}
+}
+
+func TestLoadPackedAndStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	positions, _ := labeledCorpus(t, 200)
+	packed := make([]engine.PackedPosition, len(positions))
+	for i := range positions {
+		packed[i] = positions[i].Pack(int32(i*20 - 2000))
+		packed[i].SetResult(engine.WhiteWins)
+	}
+	writePacked(t, path, packed)
+
+	samples, err := trainer.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range positions {
+		want, _ := trainer.NewSample(&positions[i], i*20-2000, 1)
+		if samples[i] != want {
+			t.Fatalf("position %d: loaded %+v, want %+v", i, samples[i], want)
+		}
+	}
+
+	stats, err := trainer.ComputeStats(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pieces, scores := int64(0), int64(0)
+	for _, n := range stats.Pieces {
+		pieces += n
+	}
+	for _, n := range stats.Scores {
+		scores += n
+	}
+	if stats.Positions != 200 || stats.Results[engine.PackedWhiteWins] != 200 || pieces != 200 || scores != 200 {
+		t.Errorf("stats %+v", stats)
+	}
+	if stats.MinScore != -2000 || stats.MaxScore != 1980 || stats.Pieces[32] == 0 {
+		t.Errorf("min %d, max %d, %d positions with 32 pieces", stats.MinScore, stats.MaxScore, stats.Pieces[32])
+	}
+	// 20-centipawn steps: five positions in each 100-centipawn bucket
+	if stats.Scores[0] != 0 || stats.Scores[1] != 5 || stats.Scores[len(stats.Scores)-2] != 5 {
+		t.Errorf("score histogram %v", stats.Scores)
+	}
+	var buf bytes.Buffer
+	stats.Write(&buf)
+	if !strings.Contains(buf.String(), "positions: 200") {
+		t.Errorf("stats written as:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,165 @@
+package trainer
+
+import (
+	"math"
+	"math/rand"
+
+	"silverfish/engine"
+)
+
+// The model is the engine's (768->L1)x2->1 architecture in float:
+//
+//	acc[p] = b1 + sum of w1[f] over perspective p's active features
+//	out    = w2 . [crelu(acc[us]), crelu(acc[them])] + b2
+//
+// with the output in units of Scale eval points. It's trained with the
+// clipped ReLU the quantized engine evaluates with, rather than the plain
+// ReLU the default net was trained with, so there's no clip to surprise
+// the exported net.
+
+// numInputs is the plain input layout's feature count.
+const numInputs = 768
+
+// model holds the parameters, or (in the same shape) their gradients.
+type model struct {
+	l1 int
+	w1 []float32 // [numInputs][l1]: feature-major, so a feature's column is contiguous
+	b1 []float32 // [l1]
+	w2 []float32 // [2*l1]: the side to move's half, then the other side's
+	b2 []float32 // [1]
+}
+
+func newModel(l1 int) *model {
+	return &model{
+		l1: l1,
+		w1: make([]float32, numInputs*l1),
+		b1: make([]float32, l1),
+		w2: make([]float32, 2*l1),
+		b2: make([]float32, 1),
+	}
+}
+
+// params returns the parameter slices, in a fixed order the optimizer and
+// checkpoints rely on.
+func (m *model) params() [][]float32 {
+	return [][]float32{m.w1, m.b1, m.w2, m.b2}
+}
+
+// randomize initializes the weights uniformly in +-1/sqrt(fan-in), as
+// PyTorch's Linear does, with zero biases.
+func (m *model) randomize(rng *rand.Rand) {
+	for _, layer := range []struct {
+		w     []float32
+		fanIn int
+	}{{m.w1, numInputs}, {m.w2, 2 * m.l1}} {
+		bound := 1 / math.Sqrt(float64(layer.fanIn))
+		for i := range layer.w {
+			layer.w[i] = float32((2*rng.Float64() - 1) * bound)
+		}
+	}
+}
+
+func (m *model) zero() {
+	for _, p := range m.params() {
+		clear(p)
+	}
+}
+
+// add adds other (the same shape) to m.
+func (m *model) add(other *model) {
+	theirs := other.params()
+	for k, p := range m.params() {
+		for i, v := range theirs[k] {
+			p[i] += v
+		}
+	}
+}
+
+func crelu(x float32) float32 {
+	return min(max(x, 0), 1)
+}
+
+// forward computes s's accumulators into acc (two l1-length buffers, side
+// to move first) and returns the model's output.
+func (m *model) forward(s *Sample, acc *[2][]float32) float32 {
+	out := m.b2[0]
+	for p := 0; p < 2; p++ {
+		a := acc[p]
+		copy(a, m.b1)
+		for _, f := range s.Features[p][:s.N] {
+			col := m.w1[int(f)*m.l1 : (int(f)+1)*m.l1]
+			for i, w := range col {
+				a[i] += w
+			}
+		}
+		w2 := m.w2[p*m.l1 : (p+1)*m.l1]
+		for i, v := range a {
+			out += w2[i] * crelu(v)
+		}
+	}
+	return out
+}
+
+// backward adds the gradient of the loss with respect to every parameter
+// to grad, given s's accumulators from forward and dOut, the loss's
+// derivative with respect to the output.
+func (m *model) backward(s *Sample, acc *[2][]float32, dOut float32, grad *model) {
+	grad.b2[0] += dOut
+	for p := 0; p < 2; p++ {
+		a := acc[p]
+		w2 := m.w2[p*m.l1 : (p+1)*m.l1]
+		gw2 := grad.w2[p*m.l1 : (p+1)*m.l1]
+		for i, v := range a {
+			gw2[i] += dOut * crelu(v)
+			// reuse the accumulator for its own gradient: the clip passes
+			// none through outside (0, 1)
+			if v > 0 && v < 1 {
+				a[i] = dOut * w2[i]
+			} else {
+				a[i] = 0
+			}
+		}
+		for i, g := range a {
+			grad.b1[i] += g
+		}
+		for _, f := range s.Features[p][:s.N] {
+			col := grad.w1[int(f)*m.l1 : (int(f)+1)*m.l1]
+			for i, g := range a {
+				col[i] += g
+			}
+		}
+	}
+}
+
+// Parameters are clipped so the exported network always quantizes at the
+// engine's default scales (see engine's checkQuantizedRanges): an
+// accumulator element, bias plus maxFeatures active columns, has to fit
+// in int16 at QA, and the output sum over 2*l1 clipped activations in
+// int32 at QA*QB. The 1% margin absorbs rounding.
+func clipBounds(l1 int) (first, output float32) {
+	first = 0.99 * math.MaxInt16 / engine.DefaultQA / (maxFeatures + 1)
+	output = 0.99 * math.MaxInt32 / (engine.DefaultQA * engine.DefaultQB) / float32(2*l1+1)
+	return first, output
+}
+
+// network returns m as an engine network: its float parameters, with the
+// first layer transposed to the engine's output-major order.
+func (m *model) network(info engine.NetworkInfo) *engine.Network {
+	net := &engine.Network{
+		Info:            info,
+		NumInputs:       numInputs,
+		L1:              m.l1,
+		OutputBuckets:   1,
+		FloatActivation: engine.ActivationCReLU,
+		WInput:          make([]float32, m.l1*numInputs),
+		BInput:          append([]float32(nil), m.b1...),
+		WOutput:         append([]float32(nil), m.w2...),
+		BOutput:         append([]float32(nil), m.b2...),
+	}
+	for f := 0; f < numInputs; f++ {
+		for o := 0; o < m.l1; o++ {
+			net.WInput[o*numInputs+f] = m.w1[f*m.l1+o]
+		}
+	}
+	return net
+}
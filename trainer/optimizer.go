@@ -0,0 +1,99 @@
+package trainer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// adam is the Adam optimizer's state: running averages of each
+// parameter's gradient (m) and squared gradient (v), in the same shape as
+// the model's params, and the number of steps taken.
+type adam struct {
+	m, v  [][]float32
+	steps int
+}
+
+func newAdam(params [][]float32) *adam {
+	opt := &adam{}
+	for _, p := range params {
+		opt.m = append(opt.m, make([]float32, len(p)))
+		opt.v = append(opt.v, make([]float32, len(p)))
+	}
+	return opt
+}
+
+// step applies one update with learning rate lr, then clips each
+// parameter slice to +-clip[k].
+func (opt *adam) step(params, grads [][]float32, lr float64, cfg *Config, clip []float32) {
+	opt.steps++
+	b1, b2 := float32(cfg.Beta1), float32(cfg.Beta2)
+	// fold the bias corrections of both averages into the step size
+	t := float64(opt.steps)
+	alpha := float32(lr * math.Sqrt(1-math.Pow(cfg.Beta2, t)) / (1 - math.Pow(cfg.Beta1, t)))
+	eps := float32(cfg.Epsilon)
+	for k, p := range params {
+		g, m, v := grads[k], opt.m[k], opt.v[k]
+		for i := range p {
+			m[i] = b1*m[i] + (1-b1)*g[i]
+			v[i] = b2*v[i] + (1-b2)*g[i]*g[i]
+			p[i] -= alpha * m[i] / (float32(math.Sqrt(float64(v[i]))) + eps)
+			p[i] = min(max(p[i], -clip[k]), clip[k])
+		}
+	}
+}
+
+// Schedule gives the learning rate for each epoch, counted from 0.
+type Schedule interface {
+	LR(epoch int) float64
+}
+
+// ConstantLR keeps the learning rate fixed.
+type ConstantLR float64
+
+func (s ConstantLR) LR(int) float64 { return float64(s) }
+
+// StepLR multiplies the learning rate by Gamma every Step epochs.
+type StepLR struct {
+	Start, Gamma float64
+	Step         int
+}
+
+func (s StepLR) LR(epoch int) float64 {
+	return s.Start * math.Pow(s.Gamma, float64(epoch/s.Step))
+}
+
+// CosineLR anneals the learning rate from Start to End over Epochs epochs
+// along half a cosine.
+type CosineLR struct {
+	Start, End float64
+	Epochs     int
+}
+
+func (s CosineLR) LR(epoch int) float64 {
+	progress := min(float64(epoch)/float64(max(s.Epochs-1, 1)), 1)
+	return s.End + (s.Start-s.End)*(1+math.Cos(math.Pi*progress))/2
+}
+
+// ParseSchedule parses a schedule description: "constant:LR",
+// "step:LR:GAMMA:STEP" or "cosine:LR:END" (annealing over epochs epochs).
+func ParseSchedule(desc string, epochs int) (Schedule, error) {
+	parts := strings.Split(desc, ":")
+	args := make([]float64, len(parts)-1)
+	for i, p := range parts[1:] {
+		var err error
+		if args[i], err = strconv.ParseFloat(p, 64); err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", desc, err)
+		}
+	}
+	switch {
+	case parts[0] == "constant" && len(args) == 1:
+		return ConstantLR(args[0]), nil
+	case parts[0] == "step" && len(args) == 3 && args[2] >= 1:
+		return StepLR{Start: args[0], Gamma: args[1], Step: int(args[2])}, nil
+	case parts[0] == "cosine" && len(args) == 2:
+		return CosineLR{Start: args[0], End: args[1], Epochs: epochs}, nil
+	}
+	return nil, fmt.Errorf("invalid schedule %q: want constant:LR, step:LR:GAMMA:STEP or cosine:LR:END", desc)
+}
@@ -0,0 +1,290 @@
+// Package trainer trains NNUE networks for the engine on the CPU: the
+// (768->L1)x2->1 architecture over engine.FeatureIndex's features, from
+// positions labeled with a search score and a game result, written
+// straight to the float network format engine.LoadNNUEFile reads.
+//
+// Training minimizes the squared error between the network's prediction
+// and a target, both as win probabilities: the output through a sigmoid,
+// and a blend of the game result and the search score through the same
+// sigmoid (see Config.WDL). The optimizer is Adam, over shuffled
+// mini-batches whose gradients are computed across Config.Threads
+// goroutines, with the learning rate following a Schedule. Runs can be
+// checkpointed every few epochs and resumed from a checkpoint exactly
+// where they left off.
+package trainer
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"silverfish/engine"
+)
+
+// Config describes a training run. Zero fields take the defaults noted.
+type Config struct {
+	L1        int // accumulator size, per perspective (256)
+	Epochs    int // passes over the training data (10)
+	BatchSize int // positions per optimizer step (16384)
+
+	Schedule Schedule // learning rate per epoch (ConstantLR(0.001))
+
+	// WDL is how much the target is the game result rather than the
+	// search score: 0 trains on scores alone, 1 on results alone.
+	WDL float64
+
+	// EvalScale is the centipawn scale of the sigmoid that turns scores
+	// and outputs into win probabilities, sigmoid(cp / EvalScale) (400).
+	EvalScale float64
+
+	// Scale is how many eval points one unit of output is worth, recorded
+	// in the exported network's metadata (engine.OutputScale).
+	Scale int
+
+	Beta1, Beta2, Epsilon float64 // Adam's (0.9, 0.999, 1e-8)
+
+	Threads int   // goroutines computing gradients (GOMAXPROCS)
+	Seed    int64 // for the initial weights and the shuffling
+
+	// CheckpointDir, if set, gets a checkpoint every CheckpointEvery
+	// epochs (1), named after the epoch (see CheckpointPath).
+	CheckpointDir   string
+	CheckpointEvery int
+}
+
+func (cfg Config) withDefaults() Config {
+	setInt := func(v *int, def int) {
+		if *v == 0 {
+			*v = def
+		}
+	}
+	setFloat := func(v *float64, def float64) {
+		if *v == 0 {
+			*v = def
+		}
+	}
+	setInt(&cfg.L1, 256)
+	setInt(&cfg.Epochs, 10)
+	setInt(&cfg.BatchSize, 16384)
+	setInt(&cfg.Scale, engine.OutputScale)
+	setInt(&cfg.Threads, runtime.GOMAXPROCS(0))
+	setInt(&cfg.CheckpointEvery, 1)
+	setFloat(&cfg.EvalScale, 400)
+	setFloat(&cfg.Beta1, 0.9)
+	setFloat(&cfg.Beta2, 0.999)
+	setFloat(&cfg.Epsilon, 1e-8)
+	if cfg.Schedule == nil {
+		cfg.Schedule = ConstantLR(0.001)
+	}
+	return cfg
+}
+
+// Trainer is a training run in progress.
+type Trainer struct {
+	cfg   Config
+	model *model
+	opt   *adam
+	epoch int // epochs completed
+	clip  []float32
+}
+
+// New starts a training run from randomly initialized weights.
+func New(cfg Config) (*Trainer, error) {
+	cfg = cfg.withDefaults()
+	if cfg.L1%16 != 0 || cfg.L1 <= 0 {
+		// the engine's accumulator updates are unrolled in steps of 16
+		return nil, errors.New("L1 must be a positive multiple of 16")
+	}
+	if cfg.WDL < 0 || cfg.WDL > 1 {
+		return nil, errors.New("WDL must be between 0 and 1")
+	}
+	t := &Trainer{cfg: cfg, model: newModel(cfg.L1)}
+	t.model.randomize(rand.New(rand.NewSource(cfg.Seed)))
+	t.opt = newAdam(t.model.params())
+	first, output := clipBounds(cfg.L1)
+	t.clip = []float32{first, first, output, output}
+	return t, nil
+}
+
+// Epoch returns the number of epochs completed.
+func (t *Trainer) Epoch() int {
+	return t.epoch
+}
+
+// EpochStats reports on one finished epoch.
+type EpochStats struct {
+	Epoch          int // counted from 1
+	LR             float64
+	TrainLoss      float64
+	ValidationLoss float64 // NaN without validation data
+	Duration       time.Duration
+	Checkpoint     string // the checkpoint written, if any
+}
+
+// Train trains on samples until Config.Epochs epochs are completed,
+// measuring the loss on validation (which may be empty) after each one and
+// reporting it to progress (which may be nil).
+func (t *Trainer) Train(samples, validation []Sample, progress func(EpochStats)) error {
+	if len(samples) == 0 {
+		return errors.New("no training data")
+	}
+	w := t.newWorkers()
+	for t.epoch < t.cfg.Epochs {
+		start := time.Now()
+		stats := EpochStats{Epoch: t.epoch + 1, LR: t.cfg.Schedule.LR(t.epoch)}
+
+		// each epoch shuffles with its own seed, so a resumed run shuffles
+		// exactly as the original would have
+		order := rand.New(rand.NewSource(t.cfg.Seed + int64(t.epoch) + 1)).Perm(len(samples))
+		var loss float64
+		for lo := 0; lo < len(order); lo += t.cfg.BatchSize {
+			batch := order[lo:min(lo+t.cfg.BatchSize, len(order))]
+			loss += w.run(samples, batch, true)
+			t.opt.step(t.model.params(), w.grads[0].params(), stats.LR, &t.cfg, t.clip)
+		}
+		t.epoch++
+
+		stats.TrainLoss = loss / float64(len(samples))
+		stats.ValidationLoss = t.loss(w, validation)
+		if t.cfg.CheckpointDir != "" && t.epoch%t.cfg.CheckpointEvery == 0 {
+			stats.Checkpoint = CheckpointPath(t.cfg.CheckpointDir, t.epoch)
+			if err := t.SaveCheckpoint(stats.Checkpoint); err != nil {
+				return err
+			}
+		}
+		stats.Duration = time.Since(start)
+		if progress != nil {
+			progress(stats)
+		}
+	}
+	return nil
+}
+
+// Loss returns the mean loss over samples (NaN for none).
+func (t *Trainer) Loss(samples []Sample) float64 {
+	return t.loss(t.newWorkers(), samples)
+}
+
+func (t *Trainer) loss(w *workers, samples []Sample) float64 {
+	if len(samples) == 0 {
+		return math.NaN()
+	}
+	var total float64
+	for lo := 0; lo < len(samples); lo += t.cfg.BatchSize {
+		batch := make([]int, 0, t.cfg.BatchSize)
+		for i := lo; i < min(lo+t.cfg.BatchSize, len(samples)); i++ {
+			batch = append(batch, i)
+		}
+		total += w.run(samples, batch, false)
+	}
+	return total / float64(len(samples))
+}
+
+// Predict returns the network's evaluation of s, in eval points from the
+// side to move's point of view: what the exported network's float
+// evaluation (engine.EvaluateFloat) gives for the position.
+func (t *Trainer) Predict(s *Sample) float64 {
+	acc := [2][]float32{make([]float32, t.cfg.L1), make([]float32, t.cfg.L1)}
+	return float64(t.model.forward(s, &acc)) * float64(t.cfg.Scale)
+}
+
+// Network returns the trained network's float parameters as an engine
+// network, with info as its metadata (its Scale and, if unset, Epochs are
+// filled in). It can be written with WriteFloat; to evaluate with it, load
+// the file back or Quantize it.
+func (t *Trainer) Network(info engine.NetworkInfo) *engine.Network {
+	info.Scale = t.cfg.Scale
+	if info.Epochs == 0 {
+		info.Epochs = t.epoch
+	}
+	return t.model.network(info)
+}
+
+// WriteNNUE writes the trained network to path as a float network file.
+func (t *Trainer) WriteNNUE(path string, info engine.NetworkInfo) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := t.Network(info).WriteFloat(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// workers compute a batch's loss and gradient in parallel, each over its
+// own share of the batch, with its own gradient buffer and accumulators.
+type workers struct {
+	t     *Trainer
+	grads []*model
+	accs  [][2][]float32
+	loss  []float64
+}
+
+func (t *Trainer) newWorkers() *workers {
+	w := &workers{t: t, loss: make([]float64, t.cfg.Threads)}
+	for i := 0; i < t.cfg.Threads; i++ {
+		w.grads = append(w.grads, newModel(t.cfg.L1))
+		w.accs = append(w.accs, [2][]float32{make([]float32, t.cfg.L1), make([]float32, t.cfg.L1)})
+	}
+	return w
+}
+
+// run computes the summed loss over the batch (indices into samples) and,
+// if backward is set, the gradient of the mean loss into grads[0]. Every
+// worker always takes the same share, and the gradients are summed in
+// worker order, so results don't depend on scheduling.
+func (w *workers) run(samples []Sample, batch []int, backward bool) float64 {
+	cfg := &w.t.cfg
+	m := w.t.model
+	// d(prediction)/d(output) is the sigmoid's slope times this
+	outScale := float32(float64(cfg.Scale) / cfg.EvalScale)
+	wdl := float32(cfg.WDL)
+	norm := 2 / float32(len(batch))
+
+	share := (len(batch) + len(w.grads) - 1) / len(w.grads)
+	var wg sync.WaitGroup
+	for i := range w.grads {
+		lo, hi := min(i*share, len(batch)), min((i+1)*share, len(batch))
+		wg.Add(1)
+		go func(i int, batch []int) {
+			defer wg.Done()
+			grad, acc := w.grads[i], &w.accs[i]
+			if backward {
+				grad.zero()
+			}
+			var loss float64
+			for _, k := range batch {
+				s := &samples[k]
+				out := m.forward(s, acc)
+				predicted := sigmoid(out * outScale)
+				target := wdl*s.Result + (1-wdl)*sigmoid(s.Score/float32(cfg.EvalScale))
+				diff := predicted - target
+				loss += float64(diff * diff)
+				if backward {
+					m.backward(s, acc, norm*diff*predicted*(1-predicted)*outScale, grad)
+				}
+			}
+			w.loss[i] = loss
+		}(i, batch[lo:hi])
+	}
+	wg.Wait()
+
+	var total float64
+	for i, l := range w.loss {
+		total += l
+		if backward && i > 0 {
+			w.grads[0].add(w.grads[i])
+		}
+	}
+	return total
+}
+
+func sigmoid(x float32) float32 {
+	return float32(1 / (1 + math.Exp(-float64(x))))
+}
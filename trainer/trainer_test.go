@@ -0,0 +1,259 @@
+package trainer_test
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"silverfish/engine"
+	"silverfish/trainer"
+)
+
+func TestMain(m *testing.M) {
+	engine.Init()
+	os.Exit(m.Run())
+}
+
+// labeledCorpus returns n random-playout positions labeled with the
+// hand-crafted eval as the score and its sign as the result, a target a
+// small network can learn in a few epochs.
+func labeledCorpus(t *testing.T, n int) ([]engine.Position, []trainer.Sample) {
+	rng := rand.New(rand.NewSource(1))
+	var positions []engine.Position
+	var samples []trainer.Sample
+	for len(samples) < n {
+		pos := engine.StartingPosition()
+		for ply := 0; ply < 80 && len(samples) < n; ply++ {
+			moves := pos.LegalMoves()
+			if len(moves) == 0 {
+				break
+			}
+			pos.DoMove(moves[rng.Intn(len(moves))])
+
+			score := int(engine.EvaluateHCE(&pos))
+			if pos.Turn == engine.Black {
+				score = -score
+			}
+			result := float32(0.5)
+			if score > 100 {
+				result = 1
+			} else if score < -100 {
+				result = 0
+			}
+			s, err := trainer.NewSample(&pos, score, result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			positions = append(positions, pos.Clone())
+			samples = append(samples, s)
+		}
+	}
+	return positions, samples
+}
+
+func testConfig() trainer.Config {
+	return trainer.Config{
+		L1:        32,
+		Epochs:    6,
+		BatchSize: 256,
+		Schedule:  trainer.CosineLR{Start: 0.01, End: 0.001, Epochs: 6},
+		WDL:       0.25,
+		Threads:   4,
+		Seed:      7,
+	}
+}
+
+func TestParseSample(t *testing.T) {
+	white, err := trainer.ParseSample("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 1 | 35 | 1-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if white.N != 32 || white.Score != 35 || white.Result != 1 {
+		t.Errorf("got %d features, score %v, result %v; want 32, 35, 1", white.N, white.Score, white.Result)
+	}
+
+	// labels are White's, samples the side to move's
+	black, err := trainer.ParseSample("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1 | 35 | 1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if black.Score != -35 || black.Result != 0 {
+		t.Errorf("black to move: got score %v, result %v; want -35, 0", black.Score, black.Result)
+	}
+	// the position is symmetric but for the e-pawn, so each side's own
+	// perspective is the other's mirrored
+	if white.Features[0] == black.Features[0] || white.Features[0] != black.Features[1] {
+		t.Errorf("perspectives are not ordered side to move first")
+	}
+
+	for _, line := range []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 | 0",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 | x | 0.5",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1 | 0 | 0.7",
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 | 0 | 0.5",
+	} {
+		if _, err := trainer.ParseSample(line); err == nil {
+			t.Errorf("%q: parsed without error", line)
+		}
+	}
+
+	samples, err := trainer.ReadText(strings.NewReader("# comment\n\n8/8/4k3/8/8/4K3/8/8 w - - 0 1 | 0 | 1/2-1/2\n"))
+	if err != nil || len(samples) != 1 || samples[0].N != 2 {
+		t.Errorf("ReadText: got %d samples, err %v", len(samples), err)
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	for _, tc := range []struct {
+		desc  string
+		epoch int
+		want  float64
+	}{
+		{"constant:0.001", 5, 0.001},
+		{"step:0.01:0.1:3", 2, 0.01},
+		{"step:0.01:0.1:3", 3, 0.001},
+		{"cosine:0.01:0.001", 0, 0.01},
+		{"cosine:0.01:0.001", 9, 0.001},
+		{"cosine:0.01:0.001", 20, 0.001},
+	} {
+		s, err := trainer.ParseSchedule(tc.desc, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.LR(tc.epoch); math.Abs(got-tc.want) > 1e-12 {
+			t.Errorf("%s at epoch %d: got %g, want %g", tc.desc, tc.epoch, got, tc.want)
+		}
+	}
+	if _, err := trainer.ParseSchedule("step:0.01:0.1", 10); err == nil {
+		t.Errorf("step schedule without a step parsed")
+	}
+}
+
+// Training has to actually learn: the validation loss of a small net on
+// the hand-crafted eval should fall well below where it started.
+func TestTrainingReducesLoss(t *testing.T) {
+	_, samples := labeledCorpus(t, 6000)
+	var train, validation []trainer.Sample
+	for i, s := range samples {
+		if i%6 == 0 {
+			validation = append(validation, s)
+		} else {
+			train = append(train, s)
+		}
+	}
+	tr, err := trainer.New(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial := tr.Loss(validation)
+	var last trainer.EpochStats
+	if err := tr.Train(train, validation, func(s trainer.EpochStats) {
+		t.Logf("epoch %d: lr %.4f, train loss %.5f, validation loss %.5f", s.Epoch, s.LR, s.TrainLoss, s.ValidationLoss)
+		last = s
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if last.Epoch != 6 || tr.Epoch() != 6 {
+		t.Fatalf("trained %d epochs, want 6", last.Epoch)
+	}
+	if last.ValidationLoss > initial/3 {
+		t.Errorf("validation loss went from %.5f to %.5f, want at most a third", initial, last.ValidationLoss)
+	}
+}
+
+// The written network has to load into the engine and evaluate like the
+// trainer's own model: exactly in float, and to within quantization error
+// once quantized.
+func TestWriteNNUE(t *testing.T) {
+	positions, samples := labeledCorpus(t, 3000)
+	cfg := testConfig()
+	cfg.Epochs = 2
+	tr, err := trainer.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Train(samples, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "trained.nnue")
+	if err := tr.WriteNNUE(path, engine.NetworkInfo{Name: "test", TrainingData: "random playouts"}); err != nil {
+		t.Fatal(err)
+	}
+	net, err := engine.LoadNNUEFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if net.Info.Name != "test" || net.Info.Epochs != 2 || net.Architecture() != "(768->32)x2->1" {
+		t.Errorf("loaded %s (%+v)", net.Describe(), net.Info)
+	}
+
+	var worst float64
+	for i := range positions {
+		pos := &positions[i]
+		pos.SetNetwork(net)
+		want := tr.Predict(&samples[i])
+		float, _ := engine.EvaluateFloat(pos)
+		if math.Abs(float64(float)-want) > 1 {
+			t.Fatalf("%s: float eval %d, trainer predicts %.2f", pos.ToFEN(), float, want)
+		}
+		worst = max(worst, math.Abs(float64(engine.EvaluateNNUE(pos))-want))
+	}
+	if worst > 10 {
+		t.Errorf("quantized eval differs from the trainer's by up to %.1f", worst)
+	}
+}
+
+// A run resumed from a checkpoint has to continue exactly as it would
+// have without stopping.
+func TestResumeFromCheckpoint(t *testing.T) {
+	_, samples := labeledCorpus(t, 2000)
+	cfg := testConfig()
+	cfg.Epochs = 3
+
+	straight, err := trainer.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := straight.Train(samples, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	interrupted := cfg
+	interrupted.Epochs = 2
+	interrupted.CheckpointDir = t.TempDir()
+	first, err := trainer.New(interrupted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var checkpoint string
+	if err := first.Train(samples, nil, func(s trainer.EpochStats) { checkpoint = s.Checkpoint }); err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint != trainer.CheckpointPath(interrupted.CheckpointDir, 2) {
+		t.Fatalf("last checkpoint %q", checkpoint)
+	}
+	cfg.L1 = 0 // taken from the checkpoint
+	resumed, err := trainer.Resume(cfg, checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Epoch() != 2 {
+		t.Fatalf("resumed at epoch %d, want 2", resumed.Epoch())
+	}
+	if err := resumed.Train(samples, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := range samples {
+		if a, b := straight.Predict(&samples[i]), resumed.Predict(&samples[i]); a != b {
+			t.Fatalf("sample %d: %v straight through, %v resumed", i, a, b)
+		}
+	}
+
+	cfg.L1 = 64
+	if _, err := trainer.Resume(cfg, checkpoint); err == nil {
+		t.Errorf("resumed a 32-wide checkpoint as 64-wide")
+	}
+}